@@ -0,0 +1,201 @@
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+)
+
+// Config is read from the `cache` section of the gateway config.
+type Config struct {
+	Enabled     bool          `mapstructure:"enabled"`
+	TTL         time.Duration `mapstructure:"ttl"`
+	MaxEntries  int           `mapstructure:"max_entries"`
+	MaxBytes    int           `mapstructure:"max_bytes"`
+	Dir         string        `mapstructure:"dir"`           // optional on-disk store
+	DirMaxBytes int64         `mapstructure:"dir_max_bytes"` // size of the on-disk store, 100 MiB by default
+}
+
+type entry struct {
+	key     string
+	data    []byte
+	expires time.Time
+}
+
+// Cache is a size bounded LRU cache of upstream responses with a TTL per
+// entry. With a directory configured, entries are also written to disk and
+// survive a restart of the gateway.
+type Cache struct {
+	config Config
+	disk   *diskStore
+	now    func() time.Time
+
+	mu         sync.Mutex
+	entries    map[string]*list.Element
+	lru        *list.List // front is the most recently used
+	size       int
+	stats      Stats
+	generation int64 // counts the clears, entries read or written before a clear are dropped
+}
+
+// Stats counts the lookups of a cache.
+type Stats struct {
+	Hits    int64
+	Misses  int64
+	Entries int
+	Bytes   int
+}
+
+func New(config Config) (*Cache, error) {
+	if config.TTL <= 0 {
+		config.TTL = 5 * time.Minute
+	}
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = 1000
+	}
+	if config.MaxBytes <= 0 {
+		config.MaxBytes = 10 << 20
+	}
+	if config.DirMaxBytes <= 0 {
+		config.DirMaxBytes = 100 << 20
+	}
+	c := &Cache{config: config, now: time.Now, entries: map[string]*list.Element{}, lru: list.New()}
+	if config.Dir != "" {
+		disk, err := newDiskStore(config.Dir, config.DirMaxBytes, c.now())
+		if err != nil {
+			return nil, err
+		}
+		c.disk = disk
+	}
+	return c, nil
+}
+
+// Key builds the cache key of a call. Arguments are canonicalized by encoding
+// them as JSON, which sorts the keys of all objects.
+func Key(upstream, kind, name string, arguments any) string {
+	canonical, err := json.Marshal(arguments)
+	if err != nil {
+		canonical = []byte("unencodable")
+	}
+	hash := sha256.New()
+	for _, part := range [][]byte{[]byte(upstream), []byte(kind), []byte(name), canonical} {
+		hash.Write(part)
+		hash.Write([]byte{0})
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Get returns the cached response for key. The disk is read outside the lock
+// of the cache in memory.
+func (c *Cache) Get(key string) ([]byte, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	if element, ok := c.entries[key]; ok {
+		e := element.Value.(*entry)
+		if c.now().Before(e.expires) {
+			c.lru.MoveToFront(element)
+			c.stats.Hits++
+			c.mu.Unlock()
+			return e.data, true
+		}
+		c.remove(element)
+	}
+	generation, now := c.generation, c.now()
+	c.mu.Unlock()
+
+	if c.disk != nil {
+		if data, expires, ok := c.disk.get(key, now); ok {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			// a clear since the lookup removed the entry
+			if generation == c.generation {
+				if element, ok := c.entries[key]; ok {
+					c.remove(element)
+				}
+				c.add(&entry{key: key, data: data, expires: expires})
+			}
+			c.stats.Hits++
+			return data, true
+		}
+	}
+	c.mu.Lock()
+	c.stats.Misses++
+	c.mu.Unlock()
+	return nil, false
+}
+
+func (c *Cache) Stats() Stats {
+	if c == nil {
+		return Stats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = c.lru.Len()
+	stats.Bytes = c.size
+	return stats
+}
+
+// Put stores a response for ttl, or the default TTL if ttl is zero.
+func (c *Cache) Put(key string, data []byte, ttl time.Duration) {
+	if c == nil || len(data) > c.config.MaxBytes {
+		return
+	}
+	if ttl <= 0 {
+		ttl = c.config.TTL
+	}
+	e := &entry{key: key, data: data, expires: c.now().Add(ttl)}
+
+	c.mu.Lock()
+	if element, ok := c.entries[key]; ok {
+		c.remove(element)
+	}
+	c.add(e)
+	generation, now := c.generation, c.now()
+	c.mu.Unlock()
+
+	if c.disk != nil {
+		if err := c.disk.put(key, data, e.expires, now, generation); err != nil {
+			log.Printf("failed to write cache entry: %v", err)
+		}
+	}
+}
+
+// Clear removes all entries, including the ones on disk.
+func (c *Cache) Clear() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	c.entries = map[string]*list.Element{}
+	c.lru.Init()
+	c.size = 0
+	c.generation++
+	generation := c.generation
+	c.mu.Unlock()
+
+	if c.disk != nil {
+		return c.disk.clear(generation)
+	}
+	return nil
+}
+
+func (c *Cache) add(e *entry) {
+	c.entries[e.key] = c.lru.PushFront(e)
+	c.size += len(e.data)
+	for c.lru.Len() > c.config.MaxEntries || c.size > c.config.MaxBytes {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *Cache) remove(element *list.Element) {
+	e := c.lru.Remove(element).(*entry)
+	delete(c.entries, e.key)
+	c.size -= len(e.data)
+}
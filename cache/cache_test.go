@@ -0,0 +1,146 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestKeyIgnoresArgumentOrder(t *testing.T) {
+	first := Key("docs", "tool", "lookup", map[string]any{"query": "go", "limit": 5.0})
+	second := Key("docs", "tool", "lookup", map[string]any{"limit": 5.0, "query": "go"})
+	if first != second {
+		t.Error("Expected the same key for the same arguments in a different order")
+	}
+	if first == Key("other", "tool", "lookup", map[string]any{"query": "go", "limit": 5.0}) {
+		t.Error("Expected different keys for different upstreams")
+	}
+}
+
+func TestEntriesExpire(t *testing.T) {
+	c, _ := New(Config{TTL: time.Minute})
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	c.Put("key", []byte(`{}`), 0)
+	if _, ok := c.Get("key"); !ok {
+		t.Fatal("Expected a cache hit")
+	}
+	now = now.Add(time.Minute)
+	if _, ok := c.Get("key"); ok {
+		t.Error("Expected the entry to be expired")
+	}
+	if stats := c.Stats(); stats.Hits != 1 || stats.Misses != 1 || stats.Entries != 0 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestLeastRecentlyUsedEntriesAreEvicted(t *testing.T) {
+	c, _ := New(Config{MaxEntries: 2, MaxBytes: 6})
+	c.Put("a", []byte("aa"), 0)
+	c.Put("b", []byte("bb"), 0)
+	c.Get("a")
+	c.Put("c", []byte("cc"), 0)
+	if _, ok := c.Get("b"); ok {
+		t.Error("Expected the least recently used entry to be evicted")
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Error("Expected the recently used entry to be kept")
+	}
+
+	c.Put("big", []byte("1234567"), 0)
+	if _, ok := c.Get("big"); ok {
+		t.Error("Expected entries larger than max_bytes not to be cached")
+	}
+}
+
+func TestDiskStoreSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	c, err := New(Config{Dir: dir})
+	if err != nil {
+		t.Fatalf("Failed to create cache: %v", err)
+	}
+	c.Put("key", []byte(`{"content":[]}`), time.Hour)
+
+	c, _ = New(Config{Dir: dir})
+	if data, ok := c.Get("key"); !ok || string(data) != `{"content":[]}` {
+		t.Fatalf("Expected the entry to be read from disk, got %s", data)
+	}
+
+	if err := c.Clear(); err != nil {
+		t.Fatalf("Failed to clear cache: %v", err)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("Expected an empty cache directory, found %d files", len(files))
+	}
+}
+
+func TestExpiredEntriesAreRemovedFromDisk(t *testing.T) {
+	dir := t.TempDir()
+	c, _ := New(Config{Dir: dir, TTL: time.Minute})
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	c.Put("memory", []byte(`{}`), 0)
+	c.Put("disk", []byte(`{}`), 0)
+	c, _ = New(Config{Dir: dir, TTL: time.Minute})
+	c.now = func() time.Time { return now }
+	c.Get("memory")
+
+	now = now.Add(time.Minute)
+	c.Get("memory") // expired in memory
+	c.Get("disk")   // only on disk
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("Expected the expired files to be removed, found %d", len(files))
+	}
+}
+
+func TestDiskStoreIsBounded(t *testing.T) {
+	dir := t.TempDir()
+	c, _ := New(Config{Dir: dir, MaxEntries: 1, DirMaxBytes: 1000})
+	for i := 0; i < 50; i++ {
+		c.Put(fmt.Sprint(i), []byte(`"0123456789012345678901234567890123456789"`), time.Hour)
+	}
+	var size int64
+	files, _ := os.ReadDir(dir)
+	for _, file := range files {
+		info, _ := file.Info()
+		size += info.Size()
+	}
+	if size > 1000 || len(files) == 0 {
+		t.Errorf("Expected at most 1000 bytes on disk, found %d in %d files", size, len(files))
+	}
+	if _, ok := c.Get("49"); !ok {
+		t.Error("Expected the newest entry to be kept")
+	}
+}
+
+func TestClearDirOnlyRemovesCacheEntries(t *testing.T) {
+	dir := t.TempDir()
+	c, _ := New(Config{Dir: dir})
+	c.Put("key", []byte(`{}`), time.Hour)
+	if err := os.WriteFile(dir+"/settings.json", []byte(`{}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ClearDir(dir); err != nil {
+		t.Fatalf("Failed to clear cache: %v", err)
+	}
+	files, _ := os.ReadDir(dir)
+	if len(files) != 1 || files[0].Name() != "settings.json" {
+		t.Errorf("Expected only the file the cache did not write to be kept, found %v", files)
+	}
+}
+
+func TestWriteBeforeClearIsDropped(t *testing.T) {
+	dir := t.TempDir()
+	c, _ := New(Config{Dir: dir})
+	c.Clear()
+	// a put that read the generation before the clear writes after it
+	if err := c.disk.put("key", []byte(`{}`), time.Now().Add(time.Hour), time.Now(), 0); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("Expected the write to be dropped, found %d files", len(files))
+	}
+}
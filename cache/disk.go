@@ -0,0 +1,178 @@
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type diskEntry struct {
+	Expires time.Time       `json:"expires"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// diskStore keeps one JSON file per cache entry in a directory. Expired files
+// are removed when they are read, and once the files exceed maxBytes the
+// expired and then the oldest ones are removed. It has a lock of its own, so
+// the files are read and written outside the lock of its cache.
+type diskStore struct {
+	dir        string
+	maxBytes   int64
+	mu         sync.Mutex
+	size       int64 // bytes of all files
+	generation int64 // generation of the cache at the last clear
+}
+
+// filePrefix starts the name of every file the cache writes, only those are
+// pruned and cleared.
+const filePrefix = "mcp-gate-cache-"
+
+func newDiskStore(dir string, maxBytes int64, now time.Time) (*diskStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	store := &diskStore{dir: dir, maxBytes: maxBytes}
+	// entries that expired while the gateway was stopped are removed right away
+	store.prune(now, 0)
+	return store, nil
+}
+
+func (store *diskStore) fileName(key string) string {
+	return filepath.Join(store.dir, filePrefix+key+".json")
+}
+
+func (store *diskStore) get(key string, now time.Time) ([]byte, time.Time, bool) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	data, err := os.ReadFile(store.fileName(key))
+	if err != nil {
+		return nil, time.Time{}, false
+	}
+	var e diskEntry
+	if err := json.Unmarshal(data, &e); err != nil || !now.Before(e.Expires) {
+		store.remove(key)
+		return nil, time.Time{}, false
+	}
+	return e.Data, e.Expires, true
+}
+
+// put writes the entry unless the cache was cleared since the generation.
+func (store *diskStore) put(key string, data []byte, expires time.Time, now time.Time, generation int64) error {
+	encoded, err := json.Marshal(diskEntry{Expires: expires, Data: data})
+	if err != nil {
+		return err
+	}
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if generation < store.generation {
+		return nil
+	}
+	store.remove(key)
+	if err := os.WriteFile(store.fileName(key), encoded, 0600); err != nil {
+		return err
+	}
+	store.size += int64(len(encoded))
+	if store.size > store.maxBytes {
+		// down to 90% so the next writes do not prune again
+		store.prune(now, store.maxBytes*9/10)
+	}
+	return nil
+}
+
+// remove deletes the file of an entry if there is one, under the lock.
+func (store *diskStore) remove(key string) {
+	name := store.fileName(key)
+	if info, err := os.Stat(name); err == nil && os.Remove(name) == nil {
+		store.size -= info.Size()
+	}
+}
+
+// prune removes the expired entries and then the oldest ones until the files
+// take at most limit bytes, no limit if it is 0. It recounts the size and is
+// called under the lock.
+func (store *diskStore) prune(now time.Time, limit int64) {
+	files, err := os.ReadDir(store.dir)
+	if err != nil {
+		return
+	}
+	type file struct {
+		name     string
+		size     int64
+		modified time.Time
+	}
+	var kept []file
+	store.size = 0
+	for _, entry := range files {
+		if !written(entry) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		name := filepath.Join(store.dir, entry.Name())
+		if expired(name, now) {
+			os.Remove(name)
+			continue
+		}
+		kept = append(kept, file{name: name, size: info.Size(), modified: info.ModTime()})
+		store.size += info.Size()
+	}
+	if limit <= 0 {
+		return
+	}
+	sort.Slice(kept, func(i, j int) bool { return kept[i].modified.Before(kept[j].modified) })
+	for _, file := range kept {
+		if store.size <= limit {
+			return
+		}
+		if os.Remove(file.name) == nil {
+			store.size -= file.size
+		}
+	}
+}
+
+// expired reports whether the entry in the file has expired or cannot be read.
+func expired(name string, now time.Time) bool {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return true
+	}
+	var e diskEntry
+	return json.Unmarshal(data, &e) != nil || !now.Before(e.Expires)
+}
+
+func (store *diskStore) clear(generation int64) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.size, store.generation = 0, generation
+	return ClearDir(store.dir)
+}
+
+// written reports whether the cache wrote the file.
+func written(file os.DirEntry) bool {
+	return !file.IsDir() && strings.HasPrefix(file.Name(), filePrefix) && strings.HasSuffix(file.Name(), ".json")
+}
+
+// ClearDir removes all cache entries stored in dir, other files are kept.
+func ClearDir(dir string) error {
+	files, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, file := range files {
+		if written(file) {
+			if err := os.Remove(filepath.Join(dir, file.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ebamberg/mcp-gate/repo"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+type BreakerState int
+
+const (
+	BREAKER_CLOSED BreakerState = iota
+	BREAKER_OPEN
+	BREAKER_HALF_OPEN
+)
+
+func (state BreakerState) String() string {
+	switch state {
+	case BREAKER_OPEN:
+		return "open"
+	case BREAKER_HALF_OPEN:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// breaker is a circuit breaker over a window of the most recent call outcomes.
+type breaker struct {
+	upstream string
+	config   repo.Breaker
+	now      func() time.Time
+	onChange func(BreakerState)
+
+	mu        sync.Mutex
+	state     BreakerState
+	outcomes  []bool // ring buffer, true for a failed call
+	next      int
+	count     int
+	openedAt  time.Time
+	trials    int
+	lastError error
+}
+
+// newBreaker returns nil if the circuit breaker of the upstream is disabled.
+func newBreaker(upstream string, config repo.Breaker, onChange func(BreakerState)) *breaker {
+	if !config.Enabled {
+		return nil
+	}
+	if config.Window <= 0 {
+		config.Window = 20
+	}
+	if config.MinCalls <= 0 {
+		config.MinCalls = min(5, config.Window)
+	}
+	if config.ErrorRate <= 0 {
+		config.ErrorRate = 0.5
+	}
+	if config.OpenFor <= 0 {
+		config.OpenFor = 30 * time.Second
+	}
+	if config.HalfOpenCalls <= 0 {
+		config.HalfOpenCalls = 1
+	}
+	return &breaker{
+		upstream: upstream,
+		config:   config,
+		now:      time.Now,
+		onChange: onChange,
+		outcomes: make([]bool, config.Window),
+	}
+}
+
+// allow returns an error while the breaker is open. After OpenFor has passed
+// it lets up to HalfOpenCalls trial calls through.
+func (b *breaker) allow() (trial bool, err error) {
+	if b == nil {
+		return false, nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BREAKER_OPEN {
+		if wait := b.config.OpenFor - b.now().Sub(b.openedAt); wait > 0 {
+			return false, fmt.Errorf("upstream %s: %w after %v, retry after %s", b.upstream, ErrCircuitOpen, b.lastError, wait.Round(time.Second))
+		}
+		b.setState(BREAKER_HALF_OPEN)
+	}
+	if b.state == BREAKER_HALF_OPEN {
+		if b.trials >= b.config.HalfOpenCalls {
+			return false, fmt.Errorf("upstream %s: %w, waiting for a trial call to finish", b.upstream, ErrCircuitOpen)
+		}
+		b.trials++
+		return true, nil
+	}
+	return false, nil
+}
+
+// record adds the outcome of a call that allow let through.
+func (b *breaker) record(trial bool, err error, latency time.Duration) {
+	if b == nil {
+		return
+	}
+	if err == nil && b.config.SlowCall > 0 && latency > b.config.SlowCall {
+		err = fmt.Errorf("call took %s", latency.Round(time.Millisecond))
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err != nil {
+		b.lastError = err
+	}
+
+	if trial {
+		b.trials--
+		if b.state != BREAKER_HALF_OPEN {
+			return
+		}
+		if err != nil {
+			b.open()
+		} else {
+			b.reset()
+			b.setState(BREAKER_CLOSED)
+		}
+		return
+	}
+
+	if b.state != BREAKER_CLOSED {
+		// a call that started before the breaker opened
+		return
+	}
+	b.outcomes[b.next] = err != nil
+	b.next = (b.next + 1) % len(b.outcomes)
+	b.count = min(b.count+1, len(b.outcomes))
+	if b.count >= b.config.MinCalls && b.errorRate() >= b.config.ErrorRate {
+		b.open()
+	}
+}
+
+// abort gives back the trial slot of a call that never reached the upstream.
+func (b *breaker) abort(trial bool) {
+	if b == nil || !trial {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trials--
+}
+
+func (b *breaker) errorRate() float64 {
+	failed := 0
+	for i := 0; i < b.count; i++ {
+		if b.outcomes[i] {
+			failed++
+		}
+	}
+	return float64(failed) / float64(b.count)
+}
+
+func (b *breaker) open() {
+	b.openedAt = b.now()
+	b.trials = 0
+	b.setState(BREAKER_OPEN)
+}
+
+func (b *breaker) reset() {
+	b.next, b.count = 0, 0
+	clear(b.outcomes)
+}
+
+func (b *breaker) setState(state BreakerState) {
+	if b.state == state {
+		return
+	}
+	b.state = state
+	if b.onChange != nil {
+		b.onChange(state)
+	}
+}
+
+func (b *breaker) State() BreakerState {
+	if b == nil {
+		return BREAKER_CLOSED
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (client *Client) onBreakerChange(state BreakerState) {
+	log.Printf("%s: circuit breaker %s", client.Name, state)
+	if client.GetStatus() == DISABLED {
+		// a call still running when the upstream was disabled
+		return
+	}
+	switch state {
+	case BREAKER_OPEN:
+		client.setStatus(CIRCUIT_OPEN)
+	case BREAKER_CLOSED:
+		client.setStatus(CONNECTED)
+	default:
+		return
+	}
+	if client.breaker.config.HideTools && client.server != nil {
+		client.server.SendNotificationToAllClients(mcp.MethodNotificationToolsListChanged, nil)
+	}
+}
+
+// hidesTools reports whether the tools of the upstream are hidden, which is
+// the case once the breakers of all its replicas are open.
+func (client *Client) hidesTools() bool {
+	if client.breaker == nil || !client.breaker.config.HideTools {
+		return false
+	}
+	for _, replica := range client.replicas() {
+		if replica.breaker.State() == BREAKER_CLOSED {
+			return false
+		}
+	}
+	return true
+}
+
+// FilterTools removes the tools of upstreams whose circuit breaker is open
+// and configured to hide them.
+func FilterTools(ctx context.Context, tools []mcp.Tool) []mcp.Tool {
+	hidden := map[string]bool{}
+	for _, client := range registeredClients() {
+		if client.hidesTools() {
+			client.catalogMu.RLock()
+			for _, name := range client.tools {
+				hidden[name] = true
+			}
+			client.catalogMu.RUnlock()
+		}
+	}
+	if len(hidden) == 0 {
+		return tools
+	}
+	var visible []mcp.Tool
+	for _, tool := range tools {
+		if !hidden[tool.Name] {
+			visible = append(visible, tool)
+		}
+	}
+	return visible
+}
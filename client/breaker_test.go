@@ -0,0 +1,96 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ebamberg/mcp-gate/repo"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func newTestBreaker(config repo.Breaker, now *time.Time) *breaker {
+	config.Enabled = true
+	b := newBreaker("upstream", config, nil)
+	b.now = func() time.Time { return *now }
+	return b
+}
+
+func TestBreakerOpensOnErrorRate(t *testing.T) {
+	now := time.Now()
+	b := newTestBreaker(repo.Breaker{Window: 4, MinCalls: 4, ErrorRate: 0.5, OpenFor: time.Minute}, &now)
+
+	failure := errors.New("broken pipe")
+	for _, err := range []error{nil, failure, nil} {
+		trial, _ := b.allow()
+		b.record(trial, err, time.Millisecond)
+	}
+	if b.State() != BREAKER_CLOSED {
+		t.Fatalf("Expected the breaker to stay closed below min calls, got %s", b.State())
+	}
+	b.record(false, failure, time.Millisecond)
+	if b.State() != BREAKER_OPEN {
+		t.Fatalf("Expected the breaker to open, got %s", b.State())
+	}
+
+	if _, err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected ErrCircuitOpen, got %v", err)
+	}
+}
+
+func TestBreakerHalfOpenTrial(t *testing.T) {
+	now := time.Now()
+	b := newTestBreaker(repo.Breaker{Window: 1, MinCalls: 1, OpenFor: time.Minute}, &now)
+	b.record(false, errors.New("timeout"), time.Millisecond)
+
+	now = now.Add(time.Minute)
+	trial, err := b.allow()
+	if err != nil || !trial {
+		t.Fatalf("Expected a trial call after open_for, got %v", err)
+	}
+	if _, err := b.allow(); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("Expected only one trial call, got %v", err)
+	}
+
+	b.record(trial, errors.New("timeout"), time.Millisecond)
+	if b.State() != BREAKER_OPEN {
+		t.Fatalf("Expected a failed trial to open the breaker again, got %s", b.State())
+	}
+
+	now = now.Add(time.Minute)
+	trial, _ = b.allow()
+	b.record(trial, nil, time.Millisecond)
+	if b.State() != BREAKER_CLOSED {
+		t.Errorf("Expected a successful trial to close the breaker, got %s", b.State())
+	}
+}
+
+func TestBreakerCountsSlowCalls(t *testing.T) {
+	now := time.Now()
+	b := newTestBreaker(repo.Breaker{Window: 2, MinCalls: 2, ErrorRate: 1, SlowCall: time.Second}, &now)
+	b.record(false, nil, 2*time.Second)
+	b.record(false, nil, 3*time.Second)
+	if b.State() != BREAKER_OPEN {
+		t.Errorf("Expected slow calls to open the breaker, got %s", b.State())
+	}
+}
+
+func TestFilterToolsHidesOpenUpstreams(t *testing.T) {
+	now := time.Now()
+	client := &Client{Name: "breaker-test", tools: []string{"flaky"}}
+	client.breaker = newTestBreaker(repo.Breaker{Window: 1, MinCalls: 1, HideTools: true}, &now)
+	registerClient(client)
+	defer registry.Delete(client.Name)
+
+	tools := []mcp.Tool{mcp.NewTool("flaky"), mcp.NewTool("stable")}
+	if visible := FilterTools(context.Background(), tools); len(visible) != 2 {
+		t.Fatalf("Expected all tools while the breaker is closed, got %d", len(visible))
+	}
+
+	client.breaker.record(false, errors.New("down"), time.Millisecond)
+	visible := FilterTools(context.Background(), tools)
+	if len(visible) != 1 || visible[0].Name != "stable" {
+		t.Errorf("Expected only the stable tool, got %v", visible)
+	}
+}
@@ -0,0 +1,101 @@
+package client
+
+import (
+	"encoding/json"
+	"log"
+	"path"
+
+	"github.com/ebamberg/mcp-gate/cache"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// ResponseCache caches the results of cacheable calls, nil disables caching.
+var ResponseCache *cache.Cache
+
+// isCacheable reports whether results of the tool may be served from the
+// cache, either because the upstream marks it read-only or idempotent or
+// because it matches one of the configured patterns.
+func (client *Client) isCacheable(tool mcp.Tool) bool {
+	if client.cacheConfig.Disabled {
+		return false
+	}
+	for _, pattern := range client.cacheConfig.Tools {
+		if ok, _ := path.Match(pattern, tool.Name); ok {
+			return true
+		}
+	}
+	return isRetryable(tool)
+}
+
+// isRetryable reports whether a failed call of the tool may be repeated on
+// another replica.
+func isRetryable(tool mcp.Tool) bool {
+	annotations := tool.Annotations
+	return (annotations.ReadOnlyHint != nil && *annotations.ReadOnlyHint) ||
+		(annotations.IdempotentHint != nil && *annotations.IdempotentHint)
+}
+
+func (client *Client) isToolRetryable(name string) bool {
+	owner := client.owner()
+	owner.catalogMu.RLock()
+	defer owner.catalogMu.RUnlock()
+	return owner.retryable[name]
+}
+
+func (client *Client) isToolCacheable(name string) bool {
+	owner := client.owner()
+	owner.catalogMu.RLock()
+	defer owner.catalogMu.RUnlock()
+	return owner.cacheable[name]
+}
+
+func (client *Client) cachedToolResult(key string) (*mcp.CallToolResult, bool) {
+	data, ok := ResponseCache.Get(key)
+	cacheLookup(client.Name, ok)
+	if !ok {
+		return nil, false
+	}
+	raw := json.RawMessage(data)
+	result, err := mcp.ParseCallToolResult(&raw)
+	if err != nil {
+		log.Printf("%s: ignoring unreadable cache entry: %v", client.Name, err)
+		return nil, false
+	}
+	return result, true
+}
+
+func (client *Client) cacheToolResult(key string, result *mcp.CallToolResult) {
+	if result.IsError {
+		return
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		log.Printf("%s: unable to cache result: %v", client.Name, err)
+		return
+	}
+	ResponseCache.Put(key, data, client.cacheConfig.TTL)
+}
+
+func (client *Client) cachedResource(key string) (*mcp.ReadResourceResult, bool) {
+	data, ok := ResponseCache.Get(key)
+	cacheLookup(client.Name, ok)
+	if !ok {
+		return nil, false
+	}
+	raw := json.RawMessage(data)
+	result, err := mcp.ParseReadResourceResult(&raw)
+	if err != nil {
+		log.Printf("%s: ignoring unreadable cache entry: %v", client.Name, err)
+		return nil, false
+	}
+	return result, true
+}
+
+func (client *Client) cacheResource(key string, result *mcp.ReadResourceResult) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		log.Printf("%s: unable to cache resource: %v", client.Name, err)
+		return
+	}
+	ResponseCache.Put(key, data, client.cacheConfig.TTL)
+}
@@ -0,0 +1,32 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/ebamberg/mcp-gate/repo"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestIsCacheable(t *testing.T) {
+	client := &Client{Name: "docs", cacheConfig: repo.Cache{Tools: []string{"schema_*"}}}
+
+	tests := map[string]struct {
+		tool     mcp.Tool
+		expected bool
+	}{
+		"default annotations": {mcp.NewTool("write_file"), false},
+		"read only":           {mcp.NewTool("lookup", mcp.WithReadOnlyHintAnnotation(true)), true},
+		"idempotent":          {mcp.NewTool("upsert", mcp.WithIdempotentHintAnnotation(true)), true},
+		"configured pattern":  {mcp.NewTool("schema_fetch"), true},
+	}
+	for name, test := range tests {
+		if cacheable := client.isCacheable(test.tool); cacheable != test.expected {
+			t.Errorf("%s: expected cacheable %v, got %v", name, test.expected, cacheable)
+		}
+	}
+
+	client.cacheConfig.Disabled = true
+	if client.isCacheable(mcp.NewTool("lookup", mcp.WithReadOnlyHintAnnotation(true))) {
+		t.Error("Expected no tool to be cacheable when the cache is disabled for the upstream")
+	}
+}
@@ -0,0 +1,300 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/ebamberg/mcp-gate/repo"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// CatalogDir is where the last known catalog of every upstream is kept, an
+// empty value disables the catalog cache.
+var CatalogDir string
+
+// catalog is what an upstream offers to the clients of the gateway. It is
+// persisted so it can be served while the upstream is still starting.
+type catalog struct {
+	Fingerprint string                `json:"fingerprint"`
+	ServerInfo  *mcp.InitializeResult `json:"serverInfo,omitempty"`
+	Tools       []mcp.Tool            `json:"tools,omitempty"`
+	Resources   []mcp.Resource        `json:"resources,omitempty"`
+	Prompts     []mcp.Prompt          `json:"prompts,omitempty"`
+}
+
+// fingerprint identifies the configuration a catalog was read with, a cached
+// catalog of a changed entry is not used.
+func fingerprint(config repo.RepositoryEntry) string {
+	data, _ := json.Marshal(config)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func catalogPath(name string) string {
+	return filepath.Join(CatalogDir, url.PathEscape(name)+".json")
+}
+
+func loadCatalog(config repo.RepositoryEntry) (*catalog, bool) {
+	if CatalogDir == "" {
+		return nil, false
+	}
+	data, err := os.ReadFile(catalogPath(config.Name))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("%s: unable to read cached catalog: %v", config.Name, err)
+		}
+		return nil, false
+	}
+	var cached catalog
+	if err := json.Unmarshal(data, &cached); err != nil {
+		log.Printf("%s: ignoring unreadable cached catalog: %v", config.Name, err)
+		return nil, false
+	}
+	if cached.Fingerprint != fingerprint(config) {
+		return nil, false
+	}
+	return &cached, true
+}
+
+func saveCatalog(name string, current *catalog) error {
+	if CatalogDir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(CatalogDir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(current, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := catalogPath(name)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// sameEntries compares what two catalogs offer, ignoring the server info.
+func (c *catalog) sameEntries(other *catalog) bool {
+	if other == nil {
+		return false
+	}
+	left, _ := json.Marshal([]any{c.Tools, c.Resources, c.Prompts})
+	right, _ := json.Marshal([]any{other.Tools, other.Resources, other.Prompts})
+	return bytes.Equal(left, right)
+}
+
+// StartMCPTool starts an upstream configured for the gateway in the
+// background. Its last known catalog is published right away, so clients see
+// its tools before the upstream has finished starting.
+func StartMCPTool(s *server.MCPServer, config repo.RepositoryEntry) *Client {
+	replicas := newReplicas(config, relayedCapabilities)
+	for _, client := range replicas {
+		client.server = s
+		registerClient(client)
+	}
+	owner := replicas[0]
+	if cached, ok := loadCatalog(config); ok {
+		log.Printf("%s: serving cached catalog", config.Name)
+		owner.publish(cached)
+	}
+
+	for _, client := range replicas {
+		go client.startInBackground()
+	}
+	return owner
+}
+
+func (client *Client) startInBackground() {
+	defer client.startHealthCheck()
+	client.restartMu.Lock()
+	defer client.restartMu.Unlock()
+	if client.removed.Load() {
+		client.setReady()
+		return
+	}
+	if err := client.open(); err != nil {
+		client.setStatus(FAILED)
+		client.setReady()
+		log.Printf("%s: failed to start: %v", client.Name, err)
+		return
+	}
+	if err := client.Connect(); err != nil {
+		log.Printf("%s: failed to connect: %v", client.Name, err)
+		return
+	}
+	if err := client.refreshCatalog(); err != nil {
+		log.Printf("%s: failed to list catalog: %v", client.Name, err)
+	}
+}
+
+// refreshCatalog reads the catalog of the connected upstream, publishes it if
+// it differs from what the gateway offers and persists it for the next start.
+// Replicas publish through the first replica of their pool.
+func (client *Client) refreshCatalog() error {
+	tools, err := client.ListTools()
+	if err != nil {
+		return err
+	}
+	resources, err := client.ListResources()
+	if err != nil {
+		log.Printf("%s: resources are not proxied: %v", client.Name, err)
+	}
+	prompts, err := client.ListPrompts()
+	if err != nil {
+		log.Printf("%s: prompts are not proxied: %v", client.Name, err)
+	}
+
+	owner := client.owner()
+	current := &catalog{
+		Fingerprint: fingerprint(client.entry()),
+		ServerInfo:  client.serverInfo,
+		Tools:       tools,
+		Resources:   resources,
+		Prompts:     prompts,
+	}
+	if !current.sameEntries(owner.published()) {
+		owner.publish(current)
+	}
+	if err := saveCatalog(client.Name, current); err != nil {
+		log.Printf("%s: unable to cache catalog: %v", client.Name, err)
+	}
+	return nil
+}
+
+func (client *Client) published() *catalog {
+	client.catalogMu.RLock()
+	defer client.catalogMu.RUnlock()
+	return client.catalog
+}
+
+// publish offers the catalog on the gateway server and withdraws whatever of
+// the previous catalog is gone. The server notifies the clients of changes.
+func (client *Client) publish(current *catalog) {
+	client.catalogMu.Lock()
+	previous := client.catalog
+	client.catalog = current
+	client.tools = nil
+	client.cacheable = map[string]bool{}
+	client.retryable = map[string]bool{}
+	for _, tool := range current.Tools {
+		client.tools = append(client.tools, tool.Name)
+		client.cacheable[tool.Name] = client.isCacheable(tool)
+		client.retryable[tool.Name] = isRetryable(tool)
+	}
+	client.catalogMu.Unlock()
+
+	s := client.server
+	if previous != nil {
+		var tools, prompts []string
+		for _, tool := range previous.Tools {
+			if !containsTool(current.Tools, tool.Name) {
+				tools = append(tools, tool.Name)
+			}
+		}
+		for _, prompt := range previous.Prompts {
+			if !containsPrompt(current.Prompts, prompt.Name) {
+				prompts = append(prompts, prompt.Name)
+			}
+		}
+		var uris []string
+		for _, resource := range previous.Resources {
+			if !containsResource(current.Resources, resource.URI) {
+				uris = append(uris, resource.URI)
+			}
+		}
+		if len(tools) > 0 {
+			s.DeleteTools(tools...)
+		}
+		if len(prompts) > 0 {
+			s.DeletePrompts(prompts...)
+		}
+		if len(uris) > 0 {
+			s.DeleteResources(uris...)
+		}
+	}
+
+	var tools []server.ServerTool
+	for _, tool := range current.Tools {
+		tools = append(tools, server.ServerTool{Tool: tool, Handler: client.proxyToolHandler})
+	}
+	if len(tools) > 0 {
+		s.AddTools(tools...)
+	}
+	var resources []server.ServerResource
+	for _, resource := range current.Resources {
+		resources = append(resources, server.ServerResource{Resource: resource, Handler: client.proxyResourceHandler})
+	}
+	if len(resources) > 0 {
+		s.AddResources(resources...)
+	}
+	var prompts []server.ServerPrompt
+	for _, prompt := range current.Prompts {
+		prompts = append(prompts, server.ServerPrompt{Prompt: prompt, Handler: client.proxyPromptHandler})
+	}
+	if len(prompts) > 0 {
+		s.AddPrompts(prompts...)
+	}
+}
+
+func containsTool(tools []mcp.Tool, name string) bool {
+	for _, tool := range tools {
+		if tool.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func containsPrompt(prompts []mcp.Prompt, name string) bool {
+	for _, prompt := range prompts {
+		if prompt.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func containsResource(resources []mcp.Resource, uri string) bool {
+	for _, resource := range resources {
+		if resource.URI == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// awaitConnection lets calls against a cached catalog wait until the upstream
+// has connected instead of failing while it is still starting.
+func (client *Client) awaitConnection(ctx context.Context) error {
+	if client.ready == nil {
+		return nil
+	}
+	select {
+	case <-client.ready:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("upstream %s is still starting: %w", client.Name, ctx.Err())
+	}
+}
+
+func (client *Client) setReady() {
+	client.readyOnce.Do(func() {
+		if client.ready != nil {
+			close(client.ready)
+		}
+		if client.pool != nil {
+			client.pool.replicaSettled(client.isConnected())
+		}
+	})
+}
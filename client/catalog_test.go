@@ -0,0 +1,67 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ebamberg/mcp-gate/repo"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func TestCatalogIsDiscardedWhenTheEntryChanges(t *testing.T) {
+	CatalogDir = t.TempDir()
+	defer func() { CatalogDir = "" }()
+
+	config := repo.RepositoryEntry{Name: "docs", Transport: "ipc", Command: "docs-server"}
+	cached := &catalog{Fingerprint: fingerprint(config), Tools: []mcp.Tool{mcp.NewTool("lookup")}}
+	if err := saveCatalog(config.Name, cached); err != nil {
+		t.Fatalf("Failed to save catalog: %v", err)
+	}
+
+	loaded, ok := loadCatalog(config)
+	if !ok || len(loaded.Tools) != 1 || loaded.Tools[0].Name != "lookup" {
+		t.Fatalf("Expected the cached catalog to be loaded, got %+v", loaded)
+	}
+	config.Args = []string{"--verbose"}
+	if _, ok := loadCatalog(config); ok {
+		t.Error("Expected the cached catalog of a changed entry to be discarded")
+	}
+}
+
+func TestPublishReplacesPreviousCatalog(t *testing.T) {
+	gateway := server.NewMCPServer("test", "1.0.0", server.WithToolCapabilities(true))
+	client := newClient(repo.RepositoryEntry{Name: "docs"}, mcp.ClientCapabilities{})
+	client.server = gateway
+
+	client.publish(&catalog{Tools: []mcp.Tool{mcp.NewTool("lookup"), mcp.NewTool("search")}})
+	current := &catalog{Tools: []mcp.Tool{mcp.NewTool("search"), mcp.NewTool("fetch", mcp.WithReadOnlyHintAnnotation(true))}}
+	if current.sameEntries(client.published()) {
+		t.Fatal("Expected the catalogs to differ")
+	}
+	client.publish(current)
+
+	tools := gateway.ListTools()
+	if _, ok := tools["lookup"]; ok {
+		t.Error("Expected the removed tool to be withdrawn")
+	}
+	if _, ok := tools["fetch"]; !ok || len(tools) != 2 {
+		t.Errorf("Expected the tools search and fetch, got %v", tools)
+	}
+	if !client.isToolCacheable("fetch") {
+		t.Error("Expected the read-only tool to be cacheable")
+	}
+}
+
+func TestAwaitConnectionHonoursContext(t *testing.T) {
+	client := newClient(repo.RepositoryEntry{Name: "docs"}, mcp.ClientCapabilities{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := client.awaitConnection(ctx); err == nil {
+		t.Error("Expected an error while the upstream is starting")
+	}
+	client.setReady()
+	if err := client.awaitConnection(context.Background()); err != nil {
+		t.Errorf("Expected no error once the upstream is ready, got %v", err)
+	}
+}
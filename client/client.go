@@ -2,13 +2,20 @@ package client
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ebamberg/mcp-gate/repo"
+	"github.com/ebamberg/mcp-gate/sandbox"
+	"github.com/ebamberg/mcp-gate/tracing"
 	mcpclient "github.com/mark3labs/mcp-go/client"
 	"github.com/mark3labs/mcp-go/client/transport"
 	"github.com/mark3labs/mcp-go/mcp"
@@ -22,26 +29,89 @@ const (
 	CONNECTED
 	STOPPED
 	FAILED
+	CIRCUIT_OPEN
+	DISABLED
 )
 
+func (status ClientStatus) String() string {
+	switch status {
+	case CONNECTED:
+		return "connected"
+	case STOPPED:
+		return "stopped"
+	case FAILED:
+		return "failed"
+	case CIRCUIT_OPEN:
+		return "circuit open"
+	case DISABLED:
+		return "disabled"
+	default:
+		return "uninitialized"
+	}
+}
+
 type Client struct {
 	Name           string `json:"name"`
 	Status         ClientStatus
-	proxied_client *mcpclient.Client
+	statusMu       sync.RWMutex
+	proxied_client atomic.Pointer[mcpclient.Client] // replaced on every restart, read through upstream()
 	serverInfo     *mcp.InitializeResult
+	calls          sync.Map // upstream progress token -> *upstreamCall
+	progressTokens atomic.Int64
+	capabilities   mcp.ClientCapabilities // relayed from the downstream client
+	active         sync.Map               // *upstreamCall of the tool calls in flight
+	timeouts       repo.Timeouts
+	limiter        *limiter
+	breaker        *breaker
+	server         *server.MCPServer
+	config         repo.RepositoryEntry
+	cacheConfig    repo.Cache
+	catalogMu      sync.RWMutex
+	catalog        *catalog        // published on the gateway server
+	tools          []string        // names of the published tools
+	cacheable      map[string]bool // tool name -> results may be cached
+	retryable      map[string]bool // tool name -> calls may be repeated on another replica
+	ready          chan struct{}   // closed once the first connection attempt is over
+	readyOnce      sync.Once
+	pool           *pool // nil unless the upstream has replicas
+	replica        int
+	unhealthy      atomic.Bool  // set while health checks fail
+	pending        atomic.Int64 // calls sent by the pool that have not finished
+	health         health       // guarded by statusMu
+	cmd            *exec.Cmd    // process of an ipc or container upstream, guarded by statusMu
+	container      string       // name of the container of a container upstream, guarded by statusMu
+	restarts       atomic.Int64
+	restartMu      sync.Mutex // held while the connection is opened or closed
+	removed        atomic.Bool
+	healthOnce     sync.Once
 }
 
-func RegisterMCPTool(server *server.MCPServer, config repo.RepositoryEntry) error {
+var errNotConnected = errors.New("Client is not initialized")
 
-	client, err := NewClient(config)
-	if err != nil {
-		return fmt.Errorf("Failed to build client for tool %s: %v", config.Name, err)
+func RegisterMCPTool(ctx context.Context, server *server.MCPServer, config repo.RepositoryEntry) error {
+
+	var connected *Client
+	var err error
+	replicas := newReplicas(config, downstreamCapabilities(ctx))
+	for _, client := range replicas {
+		client.server = server
+		if err = client.open(); err != nil {
+			client.setReady()
+			err = fmt.Errorf("Failed to build client for tool %s: %v", config.Name, err)
+			continue
+		}
+		if err = client.Connect(); err == nil && connected == nil {
+			connected = client
+		}
+		client.startHealthCheck()
 	}
-	err = client.Connect()
-	if err != nil {
-		LinkProxyClientToServer(server, client)
+	if connected == nil {
+		return err
 	}
-	return err
+	for _, client := range replicas {
+		registerClient(client)
+	}
+	return LinkProxyClientToServer(server, connected)
 }
 
 func (client *Client) addNotificationHandler() error {
@@ -49,15 +119,21 @@ func (client *Client) addNotificationHandler() error {
 		return reason
 	}
 	// Set up notification handler
-	client.proxied_client.OnNotification(func(notification mcp.JSONRPCNotification) {
-		log.Printf("Received notification: %s\n", notification.Method)
+	client.upstream().OnNotification(func(notification mcp.JSONRPCNotification) {
+		switch notification.Method {
+		case methodNotificationProgress:
+			client.forwardProgress(notification)
+		default:
+			log.Printf("Received notification: %s\n", notification.Method)
+		}
 	})
 	return nil
 }
 
 func (client *Client) Connect() error {
+	defer client.setReady()
 	var err error
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := withTimeout(context.Background(), client.timeouts.Initialize)
 	defer cancel()
 
 	// Initialize the client
@@ -70,10 +146,16 @@ func (client *Client) Connect() error {
 	}
 	initRequest.Params.Capabilities = mcp.ClientCapabilities{}
 
-	client.serverInfo, err = client.proxied_client.Initialize(ctx, initRequest)
+	client.serverInfo, err = client.upstream().Initialize(ctx, initRequest)
 	if err != nil {
-		client.Status = FAILED
-		return fmt.Errorf("Failed to initialize: %v", err)
+		client.setStatus(FAILED)
+		if timedOut(ctx, client.timeouts.Initialize) {
+			err = &TimeoutError{Upstream: client.Name, Operation: "initialize", Timeout: client.timeouts.Initialize}
+		} else {
+			err = fmt.Errorf("Failed to initialize: %v", err)
+		}
+		client.recordError(err)
+		return err
 	}
 
 	// Display server information
@@ -82,19 +164,48 @@ func (client *Client) Connect() error {
 		client.serverInfo.ServerInfo.Version)
 	log.Printf("Server capabilities: %+v\n", client.serverInfo.Capabilities)
 
-	client.Status = CONNECTED
+	client.setStatus(CONNECTED)
+	client.statusMu.Lock()
+	client.health.started = time.Now()
+	client.statusMu.Unlock()
 
 	log.Println("Client initialized successfully...")
-	return nil
+	return client.addNotificationHandler()
+}
+
+// Load returns the number of in-flight and queued calls of the upstream.
+func (client *Client) Load() LimiterStats {
+	return client.limiter.Stats()
+}
+
+func (client *Client) GetStatus() ClientStatus {
+	client.statusMu.RLock()
+	defer client.statusMu.RUnlock()
+	return client.Status
 }
 
+func (client *Client) setStatus(status ClientStatus) {
+	client.statusMu.Lock()
+	defer client.statusMu.Unlock()
+	client.Status = status
+}
+
+// upstream returns the current connection to the upstream, nil before the
+// first start.
+func (client *Client) upstream() *mcpclient.Client {
+	return client.proxied_client.Load()
+}
+
+// isConnected is also true while the circuit breaker is open, the connection
+// to the upstream is still there and trial calls need to get through.
 func (client *Client) isConnected() bool {
-	return client.proxied_client != nil && client.Status == CONNECTED
+	status := client.GetStatus()
+	return client.upstream() != nil && (status == CONNECTED || status == CIRCUIT_OPEN)
 }
 
 func (client *Client) exitOnNotConnected() (bool, error) {
 	if !client.isConnected() {
-		return true, fmt.Errorf("Client is not initialized")
+		return true, errNotConnected
 	} else {
 		return false, nil
 	}
@@ -106,12 +217,12 @@ func (client *Client) Stop() error {
 	}
 
 	log.Println("Stopping client...")
-	if err := client.proxied_client.Close(); err != nil {
-		client.Status = FAILED
+	if err := client.upstream().Close(); err != nil {
+		client.setStatus(FAILED)
 		return fmt.Errorf("Failed to stop client: %v", err)
 	}
 
-	client.Status = STOPPED
+	client.setStatus(STOPPED)
 	log.Println("Client stopped successfully")
 	return nil
 }
@@ -125,15 +236,19 @@ func (client *Client) ListTools() ([]mcp.Tool, error) {
 	var tools []mcp.Tool
 	var err error = nil
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := withTimeout(context.Background(), client.timeouts.List)
 	defer cancel()
 	// List available tools if the server supports them
 	if client.serverInfo.Capabilities.Tools != nil {
 		log.Println("Fetching available tools...")
 		toolsRequest := mcp.ListToolsRequest{}
-		toolsResult, err := client.proxied_client.ListTools(ctx, toolsRequest)
+		var toolsResult *mcp.ListToolsResult
+		toolsResult, err = client.upstream().ListTools(ctx, toolsRequest)
 		if err != nil {
 			log.Printf("Failed to list tools: %v", err)
+			if timedOut(ctx, client.timeouts.List) {
+				err = &TimeoutError{Upstream: client.Name, Operation: "tools/list", Timeout: client.timeouts.List}
+			}
 		} else {
 			for _, tool := range toolsResult.Tools {
 				tools = append(tools, tool)
@@ -151,15 +266,19 @@ func (client *Client) ListResources() ([]mcp.Resource, error) {
 
 	var resources []mcp.Resource
 	var err error = nil
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := withTimeout(context.Background(), client.timeouts.List)
 	defer cancel()
 	// List available resources if the server supports them
 	if client.serverInfo.Capabilities.Resources != nil {
 		log.Println("Fetching available resources...")
 		resourcesRequest := mcp.ListResourcesRequest{}
-		resourcesResult, err := client.proxied_client.ListResources(ctx, resourcesRequest)
+		var resourcesResult *mcp.ListResourcesResult
+		resourcesResult, err = client.upstream().ListResources(ctx, resourcesRequest)
 		if err != nil {
 			log.Printf("Failed to list resources: %v", err)
+			if timedOut(ctx, client.timeouts.List) {
+				err = &TimeoutError{Upstream: client.Name, Operation: "resources/list", Timeout: client.timeouts.List}
+			}
 		} else {
 			for _, resource := range resourcesResult.Resources {
 				resources = append(resources, resource)
@@ -169,46 +288,156 @@ func (client *Client) ListResources() ([]mcp.Resource, error) {
 	return resources, err
 }
 
-func NewClient(config repo.RepositoryEntry) (*Client, error) {
-	var client *Client
+func (client *Client) ListPrompts() ([]mcp.Prompt, error) {
+
+	if exit, reason := client.exitOnNotConnected(); exit {
+		return nil, reason
+	}
+
+	var prompts []mcp.Prompt
 	var err error = nil
-	if config.Transport == "ipc" {
-		client, err = NewIPCClient(config)
-	} else if config.Transport == "http" {
-		client, err = NewHTTPStreamingClient(config)
-	} else {
-		return nil, fmt.Errorf("Unsupported transport type: %s", config.Transport)
+	ctx, cancel := withTimeout(context.Background(), client.timeouts.List)
+	defer cancel()
+	// List available prompts if the server supports them
+	if client.serverInfo.Capabilities.Prompts != nil {
+		log.Println("Fetching available prompts...")
+		var promptsResult *mcp.ListPromptsResult
+		promptsResult, err = client.upstream().ListPrompts(ctx, mcp.ListPromptsRequest{})
+		if err != nil {
+			log.Printf("Failed to list prompts: %v", err)
+			if timedOut(ctx, client.timeouts.List) {
+				err = &TimeoutError{Upstream: client.Name, Operation: "prompts/list", Timeout: client.timeouts.List}
+			}
+		} else {
+			prompts = append(prompts, promptsResult.Prompts...)
+		}
 	}
-	return client, err
+	return prompts, err
 }
 
-func NewIPCClient(config repo.RepositoryEntry) (*Client, error) {
+func NewClient(config repo.RepositoryEntry, capabilities mcp.ClientCapabilities) (*Client, error) {
+	client := newClient(config, capabilities)
+	return client, client.open()
+}
+
+func NewIPCClient(config repo.RepositoryEntry, capabilities mcp.ClientCapabilities) (*Client, error) {
+	client := newClient(config, capabilities)
+	return client, client.openIPC()
+}
+
+func NewHTTPStreamingClient(config repo.RepositoryEntry, capabilities mcp.ClientCapabilities) (*Client, error) {
+	client := newClient(config, capabilities)
+	return client, client.openHTTP()
+}
+
+func newClient(config repo.RepositoryEntry, capabilities mcp.ClientCapabilities) *Client {
 	client := &Client{
-		Name:           config.Name,
-		Status:         UNINITIALIZED,
-		proxied_client: nil,
+		Name:         config.Name,
+		Status:       UNINITIALIZED,
+		capabilities: capabilities,
+		timeouts:     withDefaults(config.Timeouts),
+		limiter:      newLimiter(config.Name, config.Concurrency),
+		config:       config,
+		cacheConfig:  config.Cache,
+		cacheable:    map[string]bool{},
+		retryable:    map[string]bool{},
+		ready:        make(chan struct{}),
 	}
+	client.breaker = newBreaker(config.Name, config.Breaker, client.onBreakerChange)
+	return client
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-	var err error
+// open creates the transport of the configured upstream and starts it.
+func (client *Client) open() error {
+	// a missing program or an unsupported platform is reported up front
+	// instead of as a failed spawn
+	err := repo.CheckRequirements(client.config)
+	if err != nil {
+		client.setStatus(FAILED)
+		client.recordError(err)
+		return err
+	}
+	switch client.config.Transport {
+	case "ipc":
+		err = client.openIPC()
+	case "http":
+		err = client.openHTTP()
+	case "container":
+		err = client.openContainer()
+	default:
+		err = fmt.Errorf("Unsupported transport type: %s", client.config.Transport)
+	}
+	if err != nil {
+		client.recordError(err)
+	}
+	return err
+}
+
+func (client *Client) openIPC() error {
+	config, err := client.config.Resolve()
+	if err == nil {
+		// the package is verified before every start, not only when fetched
+		config, err = repo.Packages().Prepare(config)
+	}
+	if err != nil {
+		client.setStatus(FAILED)
+		return err
+	}
 
 	log.Println("Initializing stdio ipc client...")
+	return client.openStdio(config)
+}
+
+// openContainer starts the image of the upstream with the docker or podman
+// CLI and talks to it like to an ipc upstream.
+func (client *Client) openContainer() error {
+	config, err := client.config.Resolve()
+	if err != nil {
+		client.setStatus(FAILED)
+		return err
+	}
+	name := client.processName()
+	config.Command, config.Args, err = repo.ContainerCommand(config, name)
+	if err != nil {
+		client.setStatus(FAILED)
+		return err
+	}
+	client.statusMu.Lock()
+	client.container = name
+	client.statusMu.Unlock()
 
+	log.Printf("Starting container %s of %s...", name, config.Container.Image)
+	return client.openStdio(config)
+}
+
+// processName names the container or the sandbox of the upstream, the pid
+// keeps those of several gateways apart.
+func (client *Client) processName() string {
+	return fmt.Sprintf("mcp-gate-%s-%d", strings.ReplaceAll(client.key(), "#", "-"), os.Getpid())
+}
+
+// openStdio starts the command of the config and connects to it over stdin
+// and stdout.
+func (client *Client) openStdio(config repo.RepositoryEntry) error {
+	command := client.command
+	if config.Sandbox != nil {
+		command = client.sandboxed(*config.Sandbox)
+		log.Printf("%s: starting %s in a sandbox", client.key(), config.Command)
+	}
 	// Create stdio transport with verbose logging
-	stdioTransport := transport.NewStdio(config.Command, nil, config.Args...)
+	stdioTransport := transport.NewStdioWithOptions(config.Command, config.Env, config.Args, transport.WithCommandFunc(command))
 
 	// Create client with the transport
-	client.proxied_client = mcpclient.NewClient(stdioTransport)
+	client.proxied_client.Store(mcpclient.NewClient(newTrackingTransport(stdioTransport), relayOptions(client, client.capabilities)...))
 
 	// Start the client
-	if err = client.proxied_client.Start(ctx); err != nil {
-		client.Status = FAILED
-		return client, fmt.Errorf("Failed to start mcp client: %v", err)
+	if err := client.start(); err != nil {
+		client.setStatus(FAILED)
+		return fmt.Errorf("Failed to start mcp client: %w", err)
 	}
 
 	// Set up logging for stderr if available
-	if stderr, ok := mcpclient.GetStderr(client.proxied_client); ok {
+	if stderr := stdioTransport.Stderr(); stderr != nil {
 		go func() {
 			buf := make([]byte, 4096)
 			for {
@@ -228,19 +457,52 @@ func NewIPCClient(config repo.RepositoryEntry) (*Client, error) {
 		log.Printf("%s: No stderr available for logging", config.Name)
 	}
 
-	return client, nil
+	return nil
 }
 
-func NewHTTPStreamingClient(config repo.RepositoryEntry) (*Client, error) {
-	log.Println("Initializing HTTP client...")
+// command creates the process of an ipc upstream the way the stdio transport
+// does, but keeps it to report its pid.
+func (client *Client) command(ctx context.Context, command string, env []string, args []string) (*exec.Cmd, error) {
+	cmd := exec.CommandContext(ctx, command, args...)
+	cmd.Env = append(os.Environ(), env...)
+	ownProcessGroup(cmd)
+	client.statusMu.Lock()
+	client.cmd = cmd
+	client.statusMu.Unlock()
+	return cmd, nil
+}
 
-	client := &Client{
-		Name:           config.Name,
-		Status:         UNINITIALIZED,
-		proxied_client: nil,
+// sandboxed creates the process of a sandboxed ipc upstream, the sandbox
+// starts it in a process group of its own.
+func (client *Client) sandboxed(config repo.Sandbox) transport.CommandFunc {
+	return func(ctx context.Context, command string, env []string, args []string) (*exec.Cmd, error) {
+		var inherit []string
+		for _, required := range client.config.RequiredConfig {
+			inherit = append(inherit, required.Name)
+		}
+		cmd, err := sandbox.Command(ctx, client.processName(), config, command, env, inherit, args)
+		if err != nil {
+			return nil, err
+		}
+		client.statusMu.Lock()
+		client.cmd = cmd
+		client.statusMu.Unlock()
+		return cmd, nil
+	}
+}
+
+func (client *Client) openHTTP() error {
+	config, err := client.config.Resolve()
+	if err != nil {
+		client.setStatus(FAILED)
+		return err
 	}
+
+	log.Println("Initializing HTTP client...")
+
 	// Create HTTP transport
-	httpTransport, err := transport.NewStreamableHTTP(*config.URL)
+	httpTransport, err := transport.NewStreamableHTTP(*config.URL,
+		transport.WithHTTPHeaders(config.Headers), transport.WithHTTPHeaderFunc(tracing.Headers))
 	// NOTE: the default streamableHTTP transport is not 100% identical to the stdio client.
 	// By default, it could not receive global notifications (e.g. toolListChanged).
 	// You need to enable the `WithContinuousListening()` option to establish a long-live connection,
@@ -248,13 +510,49 @@ func NewHTTPStreamingClient(config repo.RepositoryEntry) (*Client, error) {
 	//
 	//   httpTransport, err := transport.NewStreamableHTTP(*httpURL, transport.WithContinuousListening())
 	if err != nil {
-		client.Status = FAILED
-		return client, fmt.Errorf("Failed to create HTTP transport: %v", err)
+		client.setStatus(FAILED)
+		return fmt.Errorf("Failed to create HTTP transport: %v", err)
 	}
 
 	// Create client with the transport
-	client.proxied_client = mcpclient.NewClient(httpTransport)
-	return client, nil
+	client.proxied_client.Store(mcpclient.NewClient(newTrackingTransport(httpTransport), relayOptions(client, client.capabilities)...))
+	if err = client.start(); err != nil {
+		client.setStatus(FAILED)
+		return fmt.Errorf("Failed to start mcp client: %w", err)
+	}
+	return nil
+}
+
+// start starts the transport of the upstream. The context of Start is bound to
+// the lifetime of the connection, so the connect timeout is enforced here: it
+// cancels the context, and a connection started after all is closed again.
+func (client *Client) start() error {
+	upstream := client.upstream()
+	if client.timeouts.Connect <= 0 {
+		return upstream.Start(context.Background())
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan error)
+	go func() {
+		err := upstream.Start(ctx)
+		select {
+		case started <- err:
+		case <-ctx.Done():
+			if err == nil {
+				upstream.Close()
+			}
+		}
+		if err != nil {
+			cancel()
+		}
+	}()
+	select {
+	case err := <-started:
+		return err
+	case <-time.After(client.timeouts.Connect):
+		cancel()
+		return &TimeoutError{Upstream: client.Name, Operation: "connect", Timeout: client.timeouts.Connect}
+	}
 }
 
 func buildToolSchema(config repo.RepositoryEntry) mcp.Tool {
@@ -269,19 +567,6 @@ func buildToolSchema(config repo.RepositoryEntry) mcp.Tool {
 }
 
 func LinkProxyClientToServer(server *server.MCPServer, client *Client) error {
-	tools, err := client.ListTools()
-	if err != nil {
-		return err
-	}
-	for _, tool := range tools {
-		server.AddTool(tool, proxyToolHandler)
-	}
-	return nil
-}
-
-func proxyToolHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-
-	// TODO: Forward the request to the client
-
-	return mcp.NewToolResultText(fmt.Sprintf("Tool %s called .\n\n ", request)), nil
+	client.server = server
+	return client.refreshCatalog()
 }
@@ -0,0 +1,153 @@
+package client
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/ebamberg/mcp-gate/repo"
+)
+
+// DefaultHealthCheck applies to upstreams that do not configure health checks.
+var DefaultHealthCheck = repo.HealthCheck{Interval: 30 * time.Second}
+
+// health is what the health checks found out about an upstream.
+type health struct {
+	started   time.Time // of the current connection
+	checked   time.Time
+	latency   time.Duration
+	failures  int // consecutive failed pings
+	lastError string
+}
+
+func (client *Client) healthCheckConfig() repo.HealthCheck {
+	defaultsMu.RLock()
+	defer defaultsMu.RUnlock()
+	config := client.config.HealthCheck
+	if config.Interval <= 0 {
+		config.Interval = DefaultHealthCheck.Interval
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultHealthCheck.Timeout
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = config.Interval
+	}
+	if config.RestartAfter <= 0 {
+		config.RestartAfter = DefaultHealthCheck.RestartAfter
+	}
+	return config
+}
+
+// startHealthCheck pings the upstream at the configured interval. Replicas
+// that do not answer get no calls, and after RestartAfter failed pings the
+// upstream is restarted.
+func (client *Client) startHealthCheck() {
+	config := client.healthCheckConfig()
+	if config.Interval <= 0 {
+		return
+	}
+	client.healthOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(config.Interval)
+			defer ticker.Stop()
+			for range ticker.C {
+				switch client.GetStatus() {
+				case STOPPED:
+					return
+				case DISABLED:
+					// checked again once enabled
+				case FAILED:
+					if config.RestartAfter > 0 {
+						client.restartLogged()
+					}
+				case UNINITIALIZED:
+					// still starting or restarting
+				default:
+					client.check(config)
+				}
+			}
+		}()
+	})
+}
+
+// check pings the upstream once.
+func (client *Client) check(config repo.HealthCheck) {
+	ctx, cancel := context.WithTimeout(context.Background(), config.Timeout)
+	started := time.Now()
+	err := client.upstream().Ping(ctx)
+	cancel()
+
+	client.statusMu.Lock()
+	client.health.checked = started
+	if err == nil {
+		client.health.latency = time.Since(started)
+		client.health.failures = 0
+	} else {
+		client.health.failures++
+		client.health.lastError = err.Error()
+	}
+	failures := client.health.failures
+	client.statusMu.Unlock()
+
+	if unhealthy := err != nil; client.unhealthy.Swap(unhealthy) != unhealthy {
+		if unhealthy {
+			log.Printf("%s: failed its health check: %v", client.key(), err)
+		} else {
+			log.Printf("%s: is healthy again", client.key())
+		}
+	}
+	if config.RestartAfter > 0 && failures >= config.RestartAfter {
+		client.restartLogged()
+	}
+}
+
+func (client *Client) recordError(err error) {
+	client.statusMu.Lock()
+	defer client.statusMu.Unlock()
+	client.health.lastError = err.Error()
+}
+
+// Restart closes the connection to the upstream, stopping its process, and
+// connects again.
+func (client *Client) Restart() error {
+	client.restartMu.Lock()
+	defer client.restartMu.Unlock()
+	if client.removed.Load() {
+		return errUpstreamRemoved
+	}
+	if client.GetStatus() == DISABLED {
+		return ErrDisabled
+	}
+
+	log.Printf("%s: restarting", client.key())
+	client.closeConnection()
+	client.restarts.Add(1)
+	restartsTotal.WithLabelValues(client.Name).Inc()
+	return client.reopen()
+}
+
+// reopen connects to the upstream again once its connection is closed. The
+// caller holds restartMu.
+func (client *Client) reopen() error {
+	client.setStatus(UNINITIALIZED)
+	client.unhealthy.Store(false)
+	client.statusMu.Lock()
+	client.health.failures = 0
+	client.statusMu.Unlock()
+
+	if err := client.open(); err != nil {
+		client.setStatus(FAILED)
+		return err
+	}
+	if err := client.Connect(); err != nil {
+		return err
+	}
+	return client.refreshCatalog()
+}
+
+func (client *Client) restartLogged() {
+	if err := client.Restart(); err != nil {
+		log.Printf("%s: restart failed: %v", client.key(), err)
+	}
+}
@@ -0,0 +1,63 @@
+package client
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ebamberg/mcp-gate/repo"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestHealthCheckDefaults(t *testing.T) {
+	client := newClient(repo.RepositoryEntry{Name: "docs"}, mcp.ClientCapabilities{})
+	config := client.healthCheckConfig()
+	if config.Interval != DefaultHealthCheck.Interval || config.Timeout != DefaultHealthCheck.Interval {
+		t.Errorf("Expected the default interval as interval and timeout, got %+v", config)
+	}
+	if config.RestartAfter != 0 {
+		t.Errorf("Expected no restarts by default, got %d", config.RestartAfter)
+	}
+
+	client = newClient(repo.RepositoryEntry{Name: "docs", HealthCheck: repo.HealthCheck{Interval: time.Second, RestartAfter: 3}}, mcp.ClientCapabilities{})
+	if config := client.healthCheckConfig(); config.Interval != time.Second || config.Timeout != time.Second || config.RestartAfter != 3 {
+		t.Errorf("Expected the configured health check, got %+v", config)
+	}
+}
+
+func TestStatusOfFailedReplica(t *testing.T) {
+	replicas := newReplicas(repo.RepositoryEntry{Name: "compute", Replicas: repo.Replicas{Count: 2}}, mcp.ClientCapabilities{})
+	replicas[0].publish(&catalog{})
+	replicas[1].setStatus(FAILED)
+	replicas[1].recordError(errors.New("exit status 1"))
+
+	status := replicas[1].status()
+	if status.Name != "compute" || status.Replica != 2 || status.State != "failed" || status.Healthy {
+		t.Errorf("Unexpected status %+v", status)
+	}
+	if status.LastError != "exit status 1" || status.Uptime != 0 || status.PID != 0 {
+		t.Errorf("Unexpected details in status %+v", status)
+	}
+}
+
+func TestReopenWhileCallsReadTheConnection(t *testing.T) {
+	url := "http://127.0.0.1:1/mcp"
+	client := newClient(repo.RepositoryEntry{Name: "docs", Transport: "http", URL: &url}, mcp.ClientCapabilities{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			client.isConnected()
+			if connection := client.upstream(); connection != nil {
+				connection.GetTransport()
+			}
+		}
+	}()
+	// a restart replaces the connection while calls and health checks use it
+	for i := 0; i < 10; i++ {
+		if err := client.openHTTP(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-done
+}
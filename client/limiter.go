@@ -0,0 +1,125 @@
+package client
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ebamberg/mcp-gate/repo"
+)
+
+var (
+	ErrQueueFull    = errors.New("too many concurrent calls, queue is full")
+	ErrQueueTimeout = errors.New("timed out waiting in queue")
+)
+
+// LimiterStats describes the load of an upstream.
+type LimiterStats struct {
+	InFlight     int
+	Queued       int
+	MaxQueued    int // highest queue depth seen so far
+	Rejected     int64
+	QueueTimeout int64
+}
+
+// limiter bounds the number of concurrent calls to an upstream. Calls that
+// find all slots taken wait in a FIFO queue and are granted slots in order.
+type limiter struct {
+	upstream string
+	config   repo.Concurrency
+
+	mu      sync.Mutex
+	waiting *list.List // of chan struct{}, closed when the slot is handed over
+	stats   LimiterStats
+}
+
+// newLimiter returns nil if the upstream has no concurrency limit.
+func newLimiter(upstream string, config repo.Concurrency) *limiter {
+	if config.MaxInFlight <= 0 {
+		return nil
+	}
+	return &limiter{upstream: upstream, config: config, waiting: list.New()}
+}
+
+// acquire waits for a free slot and returns the function to release it.
+func (l *limiter) acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	l.mu.Lock()
+	if l.stats.InFlight < l.config.MaxInFlight {
+		l.stats.InFlight++
+		l.mu.Unlock()
+		return l.release, nil
+	}
+	if l.waiting.Len() >= l.config.QueueSize {
+		l.stats.Rejected++
+		l.mu.Unlock()
+		return nil, fmt.Errorf("upstream %s: %w (%d in flight, %d queued)", l.upstream, ErrQueueFull, l.config.MaxInFlight, l.config.QueueSize)
+	}
+	granted := make(chan struct{})
+	element := l.waiting.PushBack(granted)
+	l.stats.Queued = l.waiting.Len()
+	l.stats.MaxQueued = max(l.stats.MaxQueued, l.stats.Queued)
+	l.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if l.config.QueueTimeout > 0 {
+		timer := time.NewTimer(l.config.QueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-granted:
+		return l.release, nil
+	case <-ctx.Done():
+		return nil, l.leave(element, ctx.Err())
+	case <-timeout:
+		return nil, l.leave(element, fmt.Errorf("upstream %s: %w after %s", l.upstream, ErrQueueTimeout, l.config.QueueTimeout))
+	}
+}
+
+// leave removes a waiting call from the queue. If the slot was handed over in
+// the meantime it is passed on, so it is not lost.
+func (l *limiter) leave(element *list.Element, err error) error {
+	l.mu.Lock()
+	select {
+	case <-element.Value.(chan struct{}):
+		l.mu.Unlock()
+		l.release()
+	default:
+		l.waiting.Remove(element)
+		l.stats.Queued = l.waiting.Len()
+		if errors.Is(err, ErrQueueTimeout) {
+			l.stats.QueueTimeout++
+		}
+		l.mu.Unlock()
+	}
+	return err
+}
+
+func (l *limiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if front := l.waiting.Front(); front != nil {
+		l.waiting.Remove(front)
+		l.stats.Queued = l.waiting.Len()
+		close(front.Value.(chan struct{}))
+		return
+	}
+	l.stats.InFlight--
+}
+
+func (l *limiter) Stats() LimiterStats {
+	if l == nil {
+		return LimiterStats{}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.stats
+}
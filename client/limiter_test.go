@@ -0,0 +1,125 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ebamberg/mcp-gate/ratelimit"
+	"github.com/ebamberg/mcp-gate/repo"
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestLimiterUnlimited(t *testing.T) {
+	l := newLimiter("upstream", repo.Concurrency{})
+	if l != nil {
+		t.Fatal("Expected no limiter without max_in_flight")
+	}
+	release, err := l.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Expected unlimited acquire to succeed: %v", err)
+	}
+	release()
+}
+
+func TestLimiterRejectsWhenQueueIsFull(t *testing.T) {
+	l := newLimiter("upstream", repo.Concurrency{MaxInFlight: 1})
+	release, err := l.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to acquire first slot: %v", err)
+	}
+	defer release()
+
+	if _, err := l.acquire(context.Background()); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Expected ErrQueueFull, got %v", err)
+	}
+	if stats := l.Stats(); stats.Rejected != 1 || stats.InFlight != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestRejectedCallIsNotCharged(t *testing.T) {
+	limiter, err := ratelimit.NewLimiter(ratelimit.Config{Rules: []ratelimit.Rule{{DailyQuota: 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func(previous *ratelimit.Limiter) { RateLimiter = previous }(RateLimiter)
+	RateLimiter = limiter
+
+	client := &Client{Name: "upstream", Status: CONNECTED, limiter: newLimiter("upstream", repo.Concurrency{MaxInFlight: 1})}
+	client.proxied_client.Store(mcpclient.NewClient(&slowTransport{}))
+	release, _ := client.limiter.acquire(context.Background())
+	defer release()
+
+	request := mcp.CallToolRequest{}
+	request.Params.Name = "search"
+	result, err := client.proxyToolHandler(context.Background(), request)
+	if err != nil || result == nil || !result.IsError {
+		t.Fatalf("Expected the full queue to be reported as a tool error, got %v, %v", result, err)
+	}
+	if err := RateLimiter.Allow("anonymous", "upstream", "search"); err != nil {
+		t.Errorf("Expected the rejected call not to count against the quota, got %v", err)
+	}
+}
+
+func TestLimiterQueueTimeout(t *testing.T) {
+	l := newLimiter("upstream", repo.Concurrency{MaxInFlight: 1, QueueSize: 1, QueueTimeout: 10 * time.Millisecond})
+	release, _ := l.acquire(context.Background())
+	defer release()
+
+	if _, err := l.acquire(context.Background()); !errors.Is(err, ErrQueueTimeout) {
+		t.Errorf("Expected ErrQueueTimeout, got %v", err)
+	}
+	if stats := l.Stats(); stats.Queued != 0 || stats.QueueTimeout != 1 || stats.MaxQueued != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+func TestLimiterGrantsSlotsInOrder(t *testing.T) {
+	l := newLimiter("upstream", repo.Concurrency{MaxInFlight: 1, QueueSize: 3})
+	release, _ := l.acquire(context.Background())
+
+	order := make(chan int, 3)
+	for i := 0; i < 3; i++ {
+		go func(i int) {
+			release, err := l.acquire(context.Background())
+			if err != nil {
+				t.Errorf("Failed to acquire slot %d: %v", i, err)
+				return
+			}
+			order <- i
+			release()
+		}(i)
+		// wait until the call is queued to get a defined order
+		for l.Stats().Queued != i+1 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	release()
+
+	for i := 0; i < 3; i++ {
+		if got := <-order; got != i {
+			t.Errorf("Expected call %d to get the slot, got %d", i, got)
+		}
+	}
+	if stats := l.Stats(); stats.InFlight != 0 || stats.Queued != 0 {
+		t.Errorf("Expected an idle limiter, got %+v", stats)
+	}
+}
+
+func TestLimiterCancelledWhileQueued(t *testing.T) {
+	l := newLimiter("upstream", repo.Concurrency{MaxInFlight: 1, QueueSize: 1})
+	release, _ := l.acquire(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := l.acquire(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %v", err)
+	}
+	release()
+	if stats := l.Stats(); stats.InFlight != 0 || stats.Queued != 0 {
+		t.Errorf("Expected an idle limiter, got %+v", stats)
+	}
+}
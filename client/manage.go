@@ -0,0 +1,308 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/ebamberg/mcp-gate/repo"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+var (
+	ErrUnknownUpstream   = errors.New("upstream is not installed")
+	ErrAlreadyInstalled  = errors.New("upstream is already installed")
+	ErrDisabled          = errors.New("upstream is disabled")
+	ErrConfigured        = errors.New("upstream is part of the configuration, remove it from config.yaml or disable it")
+	errUpstreamRemoved   = errors.New("upstream was removed")
+	errNoReplicaStarted  = errors.New("no replica could be started")
+	configuredUpstreamMu sync.Mutex
+	configuredUpstreams  = map[string]string{} // upstreams started from the configuration -> fingerprint of their definition
+)
+
+// defaultsMu guards DefaultTimeouts and DefaultHealthCheck once the gateway
+// is running.
+var defaultsMu sync.RWMutex
+
+// SetDefaults replaces the timeouts and health checks used by upstreams that
+// do not configure their own. Running upstreams keep theirs until Reconcile
+// restarts them.
+func SetDefaults(timeouts repo.Timeouts, healthCheck repo.HealthCheck) {
+	defaultsMu.Lock()
+	defer defaultsMu.Unlock()
+	DefaultTimeouts = timeouts
+	DefaultHealthCheck = healthCheck
+}
+
+func defaultsFingerprint() string {
+	defaultsMu.RLock()
+	defer defaultsMu.RUnlock()
+	data, _ := json.Marshal([]any{DefaultTimeouts, DefaultHealthCheck})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Changes lists what Reconcile did to the upstreams.
+type Changes struct {
+	Added     []string `json:"added,omitempty"`
+	Removed   []string `json:"removed,omitempty"`
+	Restarted []string `json:"restarted,omitempty"`
+}
+
+// lookup returns the upstream with the name, the first replica for a pool.
+func lookup(name string) *Client {
+	if value, ok := registry.Load(name); ok {
+		return value.(*Client)
+	}
+	if value, ok := registry.Load(name + "#1"); ok {
+		return value.(*Client)
+	}
+	return nil
+}
+
+// Install starts an upstream and waits until it has connected. An upstream
+// that misses inputs is not started, one that cannot be started is removed
+// again.
+func Install(ctx context.Context, s *server.MCPServer, config repo.RepositoryEntry) error {
+	if lookup(config.Name) != nil {
+		return fmt.Errorf("%s: %w", config.Name, ErrAlreadyInstalled)
+	}
+	if _, err := config.Resolve(); err != nil {
+		return err
+	}
+	owner := StartMCPTool(s, config)
+	if err := owner.awaitStarted(ctx); err != nil {
+		return err
+	}
+	for _, replica := range owner.replicas() {
+		if replica.isConnected() {
+			return nil
+		}
+	}
+	err := errNoReplicaStarted
+	if status := owner.status(); status.LastError != "" {
+		err = errors.New(status.LastError)
+	}
+	Remove(config.Name)
+	return fmt.Errorf("%s: %w", config.Name, err)
+}
+
+// awaitStarted waits until the first connection attempt of every replica is
+// over, or one of them has connected.
+func (client *Client) awaitStarted(ctx context.Context) error {
+	if client.pool != nil {
+		return client.pool.awaitConnection(ctx)
+	}
+	return client.awaitConnection(ctx)
+}
+
+// Remove stops all replicas of an upstream and withdraws its tools, resources
+// and prompts from the gateway.
+func Remove(name string) error {
+	owner := lookup(name)
+	if owner == nil {
+		return fmt.Errorf("%s: %w", name, ErrUnknownUpstream)
+	}
+	for _, replica := range owner.replicas() {
+		registry.Delete(replica.key())
+		replica.shutdown()
+	}
+	if owner.server != nil {
+		owner.publish(&catalog{})
+	}
+	configuredUpstreamMu.Lock()
+	delete(configuredUpstreams, name)
+	configuredUpstreamMu.Unlock()
+	log.Printf("%s: removed", name)
+	return nil
+}
+
+// Uninstall removes an upstream installed at runtime. An upstream of the
+// configuration is refused, the next reload would start it again.
+func Uninstall(name string) error {
+	configuredUpstreamMu.Lock()
+	_, configured := configuredUpstreams[name]
+	configuredUpstreamMu.Unlock()
+	if configured {
+		return fmt.Errorf("%s: %w", name, ErrConfigured)
+	}
+	return Remove(name)
+}
+
+// shutdown closes the connection for good, the health checks stop with it.
+func (client *Client) shutdown() {
+	client.restartMu.Lock()
+	defer client.restartMu.Unlock()
+	client.removed.Store(true)
+	if client.GetStatus() != STOPPED {
+		client.closeConnection()
+	}
+	client.setStatus(STOPPED)
+	client.setReady()
+}
+
+// Disable stops all replicas of an upstream and withdraws its tools, resources
+// and prompts, but keeps it installed with its configuration until Enable
+// starts it again.
+func Disable(name string) error {
+	owner := lookup(name)
+	if owner == nil {
+		return fmt.Errorf("%s: %w", name, ErrUnknownUpstream)
+	}
+	if owner.GetStatus() == DISABLED {
+		return nil
+	}
+	for _, replica := range owner.replicas() {
+		replica.restartMu.Lock()
+		if replica.GetStatus() != STOPPED {
+			replica.closeConnection()
+		}
+		replica.setStatus(DISABLED)
+		replica.setReady()
+		replica.restartMu.Unlock()
+	}
+	if owner.server != nil {
+		owner.publish(&catalog{})
+	}
+	log.Printf("%s: disabled", name)
+	return nil
+}
+
+// Enable starts the replicas of a disabled upstream again and publishes its
+// catalog once they are connected.
+func Enable(name string) error {
+	owner := lookup(name)
+	if owner == nil {
+		return fmt.Errorf("%s: %w", name, ErrUnknownUpstream)
+	}
+	var errs []error
+	for _, replica := range owner.replicas() {
+		replica.restartMu.Lock()
+		if replica.GetStatus() == DISABLED && !replica.removed.Load() {
+			if err := replica.reopen(); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", replica.key(), err))
+			}
+		}
+		replica.restartMu.Unlock()
+	}
+	log.Printf("%s: enabled", name)
+	return errors.Join(errs...)
+}
+
+// InstalledUpstream describes an upstream installed in the gateway.
+type InstalledUpstream struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Transport   string   `json:"transport"`
+	State       string   `json:"state"` // of the first replica
+	Enabled     bool     `json:"enabled"`
+	Configured  bool     `json:"configured"` // started from the configuration, installed at runtime otherwise
+	Replicas    int      `json:"replicas,omitempty"`
+	Tools       []string `json:"tools"`
+}
+
+// Installed lists the upstreams installed in the gateway by their name.
+func Installed() []InstalledUpstream {
+	configuredUpstreamMu.Lock()
+	configured := make(map[string]bool, len(configuredUpstreams))
+	for name := range configuredUpstreams {
+		configured[name] = true
+	}
+	configuredUpstreamMu.Unlock()
+
+	installed := []InstalledUpstream{}
+	for _, client := range registeredClients() {
+		if client.owner() != client {
+			continue
+		}
+		entry := client.entry()
+		upstream := InstalledUpstream{
+			Name:        client.Name,
+			Description: entry.Description,
+			Transport:   entry.Transport,
+			State:       client.GetStatus().String(),
+			Enabled:     client.GetStatus() != DISABLED,
+			Configured:  configured[client.Name],
+			Tools:       []string{},
+		}
+		if client.pool != nil {
+			upstream.Replicas = len(client.pool.replicas)
+		}
+		client.catalogMu.RLock()
+		upstream.Tools = append(upstream.Tools, client.tools...)
+		client.catalogMu.RUnlock()
+		installed = append(installed, upstream)
+	}
+	return installed
+}
+
+// RestartUpstream restarts every replica of an upstream.
+func RestartUpstream(name string) error {
+	owner := lookup(name)
+	if owner == nil {
+		return fmt.Errorf("%s: %w", name, ErrUnknownUpstream)
+	}
+	var errs []error
+	for _, replica := range owner.replicas() {
+		if err := replica.Restart(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", replica.key(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Reconcile brings the upstreams started from the configuration in line with
+// entries: new ones are started, missing ones removed and changed ones
+// restarted with their new definition. A change of the default timeouts or
+// health checks restarts all of them. Upstreams installed at runtime are left
+// alone.
+func Reconcile(s *server.MCPServer, entries []repo.RepositoryEntry) Changes {
+	configuredUpstreamMu.Lock()
+	previous := make(map[string]string, len(configuredUpstreams))
+	for name, definition := range configuredUpstreams {
+		previous[name] = definition
+	}
+	configuredUpstreamMu.Unlock()
+
+	var changes Changes
+	wanted := map[string]bool{}
+	for _, entry := range entries {
+		wanted[entry.Name] = true
+	}
+	// remove first, a new upstream may offer tools of the same name
+	for name := range previous {
+		if !wanted[name] && Remove(name) == nil {
+			changes.Removed = append(changes.Removed, name)
+		}
+	}
+	sort.Strings(changes.Removed)
+
+	defaults := defaultsFingerprint()
+	for _, entry := range entries {
+		definition := fingerprint(entry) + defaults
+		current := lookup(entry.Name)
+		configured, wasConfigured := previous[entry.Name]
+		switch {
+		case current == nil:
+			changes.Added = append(changes.Added, entry.Name)
+			StartMCPTool(s, entry)
+		case wasConfigured && configured == definition:
+		case !wasConfigured && fingerprint(current.entry()) == fingerprint(entry):
+			// installed at runtime and now part of the configuration
+		default:
+			Remove(entry.Name)
+			changes.Restarted = append(changes.Restarted, entry.Name)
+			StartMCPTool(s, entry)
+		}
+		configuredUpstreamMu.Lock()
+		configuredUpstreams[entry.Name] = definition
+		configuredUpstreamMu.Unlock()
+	}
+	return changes
+}
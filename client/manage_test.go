@@ -0,0 +1,136 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ebamberg/mcp-gate/repo"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func TestReconcile(t *testing.T) {
+	gateway := server.NewMCPServer("test", "1.0.0", server.WithToolCapabilities(true))
+	kept := repo.RepositoryEntry{Name: "kept", Transport: "none"}
+	changed := repo.RepositoryEntry{Name: "changed", Transport: "none"}
+	dropped := repo.RepositoryEntry{Name: "dropped", Transport: "none"}
+	defer func() {
+		for _, name := range []string{"kept", "changed", "dropped", "added"} {
+			Remove(name)
+		}
+	}()
+
+	changes := Reconcile(gateway, []repo.RepositoryEntry{kept, changed, dropped})
+	if len(changes.Added) != 3 {
+		t.Fatalf("Expected 3 upstreams to be added, got %+v", changes)
+	}
+
+	changed.Command = "other"
+	changes = Reconcile(gateway, []repo.RepositoryEntry{kept, changed, {Name: "added", Transport: "none"}})
+	if len(changes.Added) != 1 || changes.Added[0] != "added" {
+		t.Errorf("Expected added to be added, got %v", changes.Added)
+	}
+	if len(changes.Removed) != 1 || changes.Removed[0] != "dropped" {
+		t.Errorf("Expected dropped to be removed, got %v", changes.Removed)
+	}
+	if len(changes.Restarted) != 1 || changes.Restarted[0] != "changed" {
+		t.Errorf("Expected changed to be restarted, got %v", changes.Restarted)
+	}
+	if lookup("dropped") != nil {
+		t.Error("Expected dropped to be unregistered")
+	}
+	if lookup("changed").entry().Command != "other" {
+		t.Error("Expected changed to run with its new definition")
+	}
+}
+
+func TestUninstallRefusesConfiguredUpstream(t *testing.T) {
+	gateway := server.NewMCPServer("test", "1.0.0", server.WithToolCapabilities(true))
+	defer Remove("configured")
+	Reconcile(gateway, []repo.RepositoryEntry{{Name: "configured", Transport: "none"}})
+
+	if err := Uninstall("configured"); !errors.Is(err, ErrConfigured) {
+		t.Errorf("Expected the configured upstream to be refused, got %v", err)
+	}
+	if lookup("configured") == nil {
+		t.Error("Expected the configured upstream to stay installed")
+	}
+	if err := Uninstall("missing"); !errors.Is(err, ErrUnknownUpstream) {
+		t.Errorf("Expected an unknown upstream, got %v", err)
+	}
+}
+
+func TestInstallRemovesFailedUpstream(t *testing.T) {
+	gateway := server.NewMCPServer("test", "1.0.0", server.WithToolCapabilities(true))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err := Install(ctx, gateway, repo.RepositoryEntry{Name: "broken", Transport: "none"})
+	if err == nil {
+		t.Fatal("Expected the install of an upstream that cannot start to fail")
+	}
+	if lookup("broken") != nil {
+		t.Error("Expected the failed upstream to be removed")
+	}
+	if err := Remove("broken"); !errors.Is(err, ErrUnknownUpstream) {
+		t.Errorf("Expected ErrUnknownUpstream, got %v", err)
+	}
+}
+
+func TestReconcileRestartsOnChangedDefaults(t *testing.T) {
+	gateway := server.NewMCPServer("test", "1.0.0", server.WithToolCapabilities(true))
+	timeouts, healthCheck := DefaultTimeouts, DefaultHealthCheck
+	defer SetDefaults(timeouts, healthCheck)
+	defer Remove("docs")
+
+	entries := []repo.RepositoryEntry{{Name: "docs", Transport: "none"}}
+	Reconcile(gateway, entries)
+	if changes := Reconcile(gateway, entries); len(changes.Restarted) != 0 {
+		t.Errorf("Expected nothing to restart without changes, got %v", changes.Restarted)
+	}
+
+	changed := timeouts
+	changed.Call = time.Minute
+	SetDefaults(changed, healthCheck)
+	if changes := Reconcile(gateway, entries); len(changes.Restarted) != 1 {
+		t.Errorf("Expected docs to restart with the new default timeouts, got %+v", changes)
+	}
+	if lookup("docs").timeouts.Call != time.Minute {
+		t.Error("Expected the restarted upstream to use the new call timeout")
+	}
+}
+
+func TestDisableAndEnable(t *testing.T) {
+	gateway := server.NewMCPServer("test", "1.0.0", server.WithToolCapabilities(true))
+	defer Remove("docs")
+	owner := StartMCPTool(gateway, repo.RepositoryEntry{Name: "docs", Transport: "none"})
+	owner.awaitConnection(context.Background())
+	owner.publish(&catalog{Tools: []mcp.Tool{mcp.NewTool("lookup")}})
+
+	if err := Disable("docs"); err != nil {
+		t.Fatalf("Failed to disable docs: %v", err)
+	}
+	if gateway.GetTool("lookup") != nil {
+		t.Error("Expected the tools of a disabled upstream to be withdrawn")
+	}
+	installed := Installed()
+	if len(installed) != 1 || installed[0].Enabled || installed[0].State != "disabled" {
+		t.Errorf("Expected docs to be listed as disabled, got %+v", installed)
+	}
+	if err := RestartUpstream("docs"); !errors.Is(err, ErrDisabled) {
+		t.Errorf("Expected a disabled upstream not to restart, got %v", err)
+	}
+
+	// the upstream cannot start, but it is enabled again
+	if err := Enable("docs"); err == nil {
+		t.Error("Expected the start of the upstream to fail")
+	}
+	if state := lookup("docs").GetStatus(); state != FAILED {
+		t.Errorf("Expected docs to be enabled and failed, got %s", state)
+	}
+	if err := Disable("unknown"); !errors.Is(err, ErrUnknownUpstream) {
+		t.Errorf("Expected ErrUnknownUpstream, got %v", err)
+	}
+}
@@ -0,0 +1,139 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/ebamberg/mcp-gate/metrics"
+	"github.com/ebamberg/mcp-gate/ratelimit"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// outcomes of proxied requests
+const (
+	OUTCOME_SUCCESS  = "success"
+	OUTCOME_ERROR    = "error"
+	OUTCOME_TIMEOUT  = "timeout"
+	OUTCOME_REJECTED = "rejected" // by a rate limit, the queue or the circuit breaker
+	OUTCOME_CANCELED = "canceled"
+)
+
+var (
+	requestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mcp_gate_requests_total",
+		Help: "Requests proxied to upstreams by method, upstream, tool and outcome.",
+	}, []string{"method", "upstream", "tool", "outcome"})
+	requestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "mcp_gate_request_duration_seconds",
+		Help:    "Duration of requests proxied to upstreams.",
+		Buckets: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600},
+	}, []string{"method", "upstream", "tool"})
+	inFlight = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "mcp_gate_in_flight_requests",
+		Help: "Requests to upstreams that have not finished, including queued ones.",
+	}, []string{"upstream"})
+	restartsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mcp_gate_upstream_restarts_total",
+		Help: "Restarts of upstreams.",
+	}, []string{"upstream"})
+	cacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "mcp_gate_cache_requests_total",
+		Help: "Response cache lookups by upstream and result (hit or miss).",
+	}, []string{"upstream", "result"})
+	sessions = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "mcp_gate_sessions",
+		Help: "Connected client sessions.",
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(requestsTotal, requestDuration, inFlight, restartsTotal, cacheRequests, sessions, upstreamCollector{})
+}
+
+// observe records a proxied request that started at started.
+func observe(method string, upstream string, tool string, started time.Time, outcome string) {
+	requestsTotal.WithLabelValues(method, upstream, tool, outcome).Inc()
+	requestDuration.WithLabelValues(method, upstream, tool).Observe(time.Since(started).Seconds())
+}
+
+// outcomeOf classifies the error a proxied request ended with.
+func outcomeOf(err error) string {
+	var timeout *TimeoutError
+	var limit *ratelimit.LimitError
+	switch {
+	case err == nil:
+		return OUTCOME_SUCCESS
+	case errors.As(err, &timeout):
+		return OUTCOME_TIMEOUT
+	case errors.As(err, &limit), errors.Is(err, ErrQueueFull), errors.Is(err, ErrQueueTimeout), errors.Is(err, ErrCircuitOpen):
+		return OUTCOME_REJECTED
+	case errors.Is(err, context.Canceled):
+		return OUTCOME_CANCELED
+	default:
+		return OUTCOME_ERROR
+	}
+}
+
+func toolOutcome(result *mcp.CallToolResult, err error) string {
+	if err == nil && result != nil && result.IsError {
+		return OUTCOME_ERROR
+	}
+	return outcomeOf(err)
+}
+
+func cacheLookup(upstream string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	cacheRequests.WithLabelValues(upstream, result).Inc()
+}
+
+func addSessionMetrics(hooks *server.Hooks) {
+	hooks.AddOnRegisterSession(func(ctx context.Context, session server.ClientSession) {
+		sessions.Inc()
+	})
+	hooks.AddOnUnregisterSession(func(ctx context.Context, session server.ClientSession) {
+		sessions.Dec()
+	})
+}
+
+var (
+	upDesc       = prometheus.NewDesc("mcp_gate_upstream_up", "Whether the upstream replica is connected and healthy.", []string{"upstream", "replica"}, nil)
+	inFlightDesc = prometheus.NewDesc("mcp_gate_upstream_in_flight", "Calls in flight to the upstream replica, with a concurrency limit.", []string{"upstream", "replica"}, nil)
+	queuedDesc   = prometheus.NewDesc("mcp_gate_upstream_queue_depth", "Calls waiting in the queue of the upstream replica.", []string{"upstream", "replica"}, nil)
+	rejectedDesc = prometheus.NewDesc("mcp_gate_upstream_queue_rejected_total", "Calls rejected because the queue of the upstream replica was full.", []string{"upstream", "replica"}, nil)
+)
+
+// upstreamCollector reports the state of all registered upstreams when the
+// metrics are scraped.
+type upstreamCollector struct{}
+
+func (upstreamCollector) Describe(descriptions chan<- *prometheus.Desc) {
+	descriptions <- upDesc
+	descriptions <- inFlightDesc
+	descriptions <- queuedDesc
+	descriptions <- rejectedDesc
+}
+
+func (upstreamCollector) Collect(collected chan<- prometheus.Metric) {
+	for _, client := range registeredClients() {
+		replica := "0"
+		if client.pool != nil {
+			replica = strconv.Itoa(client.replica + 1)
+		}
+		up := 0.0
+		if client.isConnected() && !client.unhealthy.Load() {
+			up = 1
+		}
+		load := client.Load()
+		collected <- prometheus.MustNewConstMetric(upDesc, prometheus.GaugeValue, up, client.Name, replica)
+		collected <- prometheus.MustNewConstMetric(inFlightDesc, prometheus.GaugeValue, float64(load.InFlight), client.Name, replica)
+		collected <- prometheus.MustNewConstMetric(queuedDesc, prometheus.GaugeValue, float64(load.Queued), client.Name, replica)
+		collected <- prometheus.MustNewConstMetric(rejectedDesc, prometheus.CounterValue, float64(load.Rejected), client.Name, replica)
+	}
+}
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ebamberg/mcp-gate/ratelimit"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestOutcomeOf(t *testing.T) {
+	tests := map[string]struct {
+		err      error
+		expected string
+	}{
+		"success":      {nil, OUTCOME_SUCCESS},
+		"timeout":      {&TimeoutError{Upstream: "docs", Operation: "tool lookup", Timeout: time.Second}, OUTCOME_TIMEOUT},
+		"rate limit":   {fmt.Errorf("upstream docs: %w", &ratelimit.LimitError{Scope: "docs"}), OUTCOME_REJECTED},
+		"queue full":   {ErrQueueFull, OUTCOME_REJECTED},
+		"circuit open": {fmt.Errorf("upstream docs: %w", ErrCircuitOpen), OUTCOME_REJECTED},
+		"canceled":     {context.Canceled, OUTCOME_CANCELED},
+		"failed call":  {&callError{Upstream: "docs", Err: errors.New("boom")}, OUTCOME_ERROR},
+	}
+	for name, test := range tests {
+		if outcome := outcomeOf(test.err); outcome != test.expected {
+			t.Errorf("%s: expected outcome %s, got %s", name, test.expected, outcome)
+		}
+	}
+	if outcome := toolOutcome(mcp.NewToolResultError("failed"), nil); outcome != OUTCOME_ERROR {
+		t.Errorf("Expected a tool result with isError to count as error, got %s", outcome)
+	}
+}
+
+func TestObserveCountsRequests(t *testing.T) {
+	counter := requestsTotal.WithLabelValues("tools/call", "metrics-test", "lookup", OUTCOME_SUCCESS)
+	before := testutil.ToFloat64(counter)
+	observe("tools/call", "metrics-test", "lookup", time.Now(), OUTCOME_SUCCESS)
+	if after := testutil.ToFloat64(counter); after != before+1 {
+		t.Errorf("Expected the request counter to increase by 1, got %v -> %v", before, after)
+	}
+}
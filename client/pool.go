@@ -0,0 +1,251 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ebamberg/mcp-gate/repo"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	STRATEGY_ROUND_ROBIN  = "round_robin"
+	STRATEGY_LEAST_LOADED = "least_loaded"
+)
+
+var errNoReplica = errors.New("no healthy replica available")
+
+// pool spreads the calls to an upstream over equivalent replicas. Every
+// replica is a client of its own; the first one publishes the catalog.
+type pool struct {
+	config   repo.RepositoryEntry
+	replicas []*Client
+	next     atomic.Uint64
+	sessions sync.Map // downstream session id -> *Client, with affinity
+
+	ready     chan struct{} // closed once a replica is connected or all have failed
+	readyOnce sync.Once
+	settled   atomic.Int64
+}
+
+// replicaConfigs returns one entry per replica of an upstream, nil if the
+// upstream is not replicated.
+func replicaConfigs(config repo.RepositoryEntry) []repo.RepositoryEntry {
+	var configs []repo.RepositoryEntry
+	for _, url := range config.Replicas.URLs {
+		replica := config
+		replica.URL = &url
+		configs = append(configs, replica)
+	}
+	if len(configs) == 0 && config.Replicas.Count > 1 {
+		for i := 0; i < config.Replicas.Count; i++ {
+			configs = append(configs, config)
+		}
+	}
+	return configs
+}
+
+// newReplicas creates the clients of an upstream, one per replica. An
+// upstream without replicas is a single client.
+func newReplicas(config repo.RepositoryEntry, capabilities mcp.ClientCapabilities) []*Client {
+	configs := replicaConfigs(config)
+	if len(configs) == 0 {
+		return []*Client{newClient(config, capabilities)}
+	}
+	p := &pool{config: config, ready: make(chan struct{})}
+	for i, replicaConfig := range configs {
+		client := newClient(replicaConfig, capabilities)
+		client.pool = p
+		client.replica = i
+		p.replicas = append(p.replicas, client)
+	}
+	return p.replicas
+}
+
+// replicaSettled is called once per replica when its first connection
+// attempt is over.
+func (p *pool) replicaSettled(connected bool) {
+	if connected || p.settled.Add(1) == int64(len(p.replicas)) {
+		p.readyOnce.Do(func() { close(p.ready) })
+	}
+}
+
+func (p *pool) awaitConnection(ctx context.Context) error {
+	select {
+	case <-p.ready:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("upstream %s is still starting: %w", p.config.Name, ctx.Err())
+	}
+}
+
+// available reports whether calls may be sent to the replica.
+func (client *Client) available() bool {
+	return client.isConnected() && !client.unhealthy.Load() && client.breaker.State() != BREAKER_OPEN
+}
+
+// candidates returns the available replicas in the order they are tried.
+func (p *pool) candidates(ctx context.Context) []*Client {
+	var candidates []*Client
+	for _, replica := range p.replicas {
+		if replica.available() {
+			candidates = append(candidates, replica)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	switch p.config.Replicas.Strategy {
+	case STRATEGY_LEAST_LOADED:
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return candidates[i].pending.Load() < candidates[j].pending.Load()
+		})
+	default:
+		start := int(p.next.Add(1)-1) % len(candidates)
+		candidates = append(append([]*Client{}, candidates[start:]...), candidates[:start]...)
+	}
+
+	if p.config.Replicas.Affinity {
+		if pinned, ok := p.sessions.Load(sessionIDFromContext(ctx)); ok {
+			for i, replica := range candidates {
+				if replica == pinned {
+					candidates = append([]*Client{replica}, append(candidates[:i:i], candidates[i+1:]...)...)
+					break
+				}
+			}
+		}
+	}
+	return candidates
+}
+
+func (p *pool) served(ctx context.Context, replica *Client) {
+	if sessionID := sessionIDFromContext(ctx); p.config.Replicas.Affinity && sessionID != "" {
+		p.sessions.Store(sessionID, replica)
+	}
+}
+
+// forgetSession drops the replica a session that left the gateway was kept
+// on, in every pool.
+func forgetSession(sessionID string) {
+	for _, client := range registeredClients() {
+		if client.pool != nil {
+			client.pool.sessions.Delete(sessionID)
+		}
+	}
+}
+
+// failover reports whether a call that failed on one replica may be sent to
+// the next one. Calls that never reached the replica can always be retried,
+// calls that failed upstream only if they are safe to repeat.
+func failover(ctx context.Context, err error, retryable bool) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if errors.Is(err, errNotConnected) || errors.Is(err, ErrCircuitOpen) || errors.Is(err, ErrQueueFull) {
+		return true
+	}
+	var timeout *TimeoutError
+	return retryable && !errors.As(err, &timeout)
+}
+
+func (p *pool) callTool(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	if err := p.awaitConnection(ctx); err != nil {
+		return nil, err
+	}
+	err := error(&callError{Upstream: p.config.Name, Err: errNoReplica})
+	for _, replica := range p.candidates(ctx) {
+		var result *mcp.CallToolResult
+		p.send(replica, func() { result, err = replica.callTool(ctx, request) })
+		if err == nil {
+			p.served(ctx, replica)
+			return result, nil
+		}
+		var failed *callError
+		retryable := errors.As(err, &failed) && replica.isToolRetryable(request.Params.Name)
+		if !failover(ctx, err, retryable) {
+			break
+		}
+	}
+	return nil, err
+}
+
+func (p *pool) readResource(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	if err := p.awaitConnection(ctx); err != nil {
+		return nil, err
+	}
+	err := fmt.Errorf("upstream %s: %w", p.config.Name, errNoReplica)
+	for _, replica := range p.candidates(ctx) {
+		var contents []mcp.ResourceContents
+		p.send(replica, func() { contents, err = replica.readResource(ctx, request) })
+		if err == nil {
+			p.served(ctx, replica)
+			return contents, nil
+		}
+		if !failover(ctx, err, true) {
+			break
+		}
+	}
+	return nil, err
+}
+
+func (p *pool) getPrompt(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	if err := p.awaitConnection(ctx); err != nil {
+		return nil, err
+	}
+	err := fmt.Errorf("upstream %s: %w", p.config.Name, errNoReplica)
+	for _, replica := range p.candidates(ctx) {
+		var result *mcp.GetPromptResult
+		p.send(replica, func() { result, err = replica.getPrompt(ctx, request) })
+		if err == nil {
+			p.served(ctx, replica)
+			return result, nil
+		}
+		if !failover(ctx, err, true) {
+			break
+		}
+	}
+	return nil, err
+}
+
+// send makes a call to the replica and keeps count of its pending calls for
+// the least loaded strategy.
+func (p *pool) send(replica *Client, call func()) {
+	replica.pending.Add(1)
+	defer replica.pending.Add(-1)
+	call()
+}
+
+// owner is the client that publishes the catalog of the upstream.
+func (client *Client) owner() *Client {
+	if client.pool != nil {
+		return client.pool.replicas[0]
+	}
+	return client
+}
+
+// entry is the catalog entry the upstream was configured with.
+func (client *Client) entry() repo.RepositoryEntry {
+	if client.pool != nil {
+		return client.pool.config
+	}
+	return client.config
+}
+
+func (client *Client) key() string {
+	if client.pool != nil {
+		return fmt.Sprintf("%s#%d", client.Name, client.replica+1)
+	}
+	return client.Name
+}
+
+func (client *Client) replicas() []*Client {
+	if client.pool != nil {
+		return client.pool.replicas
+	}
+	return []*Client{client}
+}
@@ -0,0 +1,118 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ebamberg/mcp-gate/repo"
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func newTestPool(replicas repo.Replicas) *pool {
+	clients := newReplicas(repo.RepositoryEntry{Name: "compute", Transport: "ipc", Replicas: replicas}, mcp.ClientCapabilities{})
+	for _, client := range clients {
+		client.proxied_client.Store(mcpclient.NewClient(nil))
+		client.setStatus(CONNECTED)
+	}
+	return clients[0].pool
+}
+
+func TestReplicaConfigs(t *testing.T) {
+	if configs := replicaConfigs(repo.RepositoryEntry{Name: "single"}); configs != nil {
+		t.Errorf("Expected no replicas for a single upstream, got %d", len(configs))
+	}
+	configs := replicaConfigs(repo.RepositoryEntry{Name: "search", Replicas: repo.Replicas{URLs: []string{"http://a/mcp", "http://b/mcp"}}})
+	if len(configs) != 2 || *configs[0].URL != "http://a/mcp" || *configs[1].URL != "http://b/mcp" {
+		t.Errorf("Expected one replica per url, got %+v", configs)
+	}
+	if configs := replicaConfigs(repo.RepositoryEntry{Name: "compute", Replicas: repo.Replicas{Count: 3}}); len(configs) != 3 {
+		t.Errorf("Expected 3 replicas, got %d", len(configs))
+	}
+}
+
+func TestRoundRobinSkipsUnavailableReplicas(t *testing.T) {
+	p := newTestPool(repo.Replicas{Count: 3})
+	p.replicas[1].unhealthy.Store(true)
+
+	var picked []int
+	for i := 0; i < 4; i++ {
+		picked = append(picked, p.candidates(context.Background())[0].replica)
+	}
+	if fmt.Sprint(picked) != "[0 2 0 2]" {
+		t.Errorf("Expected replicas [0 2 0 2], got %v", picked)
+	}
+}
+
+func TestLeastLoadedPicksIdleReplica(t *testing.T) {
+	p := newTestPool(repo.Replicas{Count: 3, Strategy: STRATEGY_LEAST_LOADED})
+	p.replicas[0].pending.Store(2)
+	p.replicas[1].pending.Store(1)
+	p.replicas[2].pending.Store(3)
+
+	if replica := p.candidates(context.Background())[0].replica; replica != 1 {
+		t.Errorf("Expected the least loaded replica 1, got %d", replica)
+	}
+}
+
+func TestAffinityKeepsSessionOnReplica(t *testing.T) {
+	p := newTestPool(repo.Replicas{Count: 3, Affinity: true})
+	ctx := server.NewMCPServer("test", "1.0.0").WithContext(context.Background(), newTestSession("session-1"))
+
+	p.served(ctx, p.replicas[2])
+	for i := 0; i < 3; i++ {
+		if replica := p.candidates(ctx)[0].replica; replica != 2 {
+			t.Fatalf("Expected the session to stay on replica 2, got %d", replica)
+		}
+	}
+
+	p.replicas[2].unhealthy.Store(true)
+	if replica := p.candidates(ctx)[0].replica; replica == 2 {
+		t.Error("Expected the session to move off the unhealthy replica")
+	}
+}
+
+func TestAffinityEndsWithTheSession(t *testing.T) {
+	p := newTestPool(repo.Replicas{Count: 2, Affinity: true})
+	for _, replica := range p.replicas {
+		registerClient(replica)
+		defer registry.Delete(replica.key())
+	}
+	hooks := &server.Hooks{}
+	trackSessions(hooks)
+	gateway := server.NewMCPServer("test", "1.0.0", server.WithHooks(hooks))
+	session := newTestSession("session-1")
+	if err := gateway.RegisterSession(context.Background(), session); err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+
+	p.served(gateway.WithContext(context.Background(), session), p.replicas[1])
+	gateway.UnregisterSession(context.Background(), session.SessionID())
+	if _, ok := p.sessions.Load(session.SessionID()); ok {
+		t.Error("Expected the affinity of the session to be removed with the session")
+	}
+}
+
+func TestFailover(t *testing.T) {
+	ctx := context.Background()
+	upstreamError := &callError{Upstream: "compute", Err: fmt.Errorf("boom")}
+	tests := map[string]struct {
+		err       error
+		retryable bool
+		expected  bool
+	}{
+		"not connected":        {fmt.Errorf("compute: %w", errNotConnected), false, true},
+		"queue full":           {ErrQueueFull, false, true},
+		"circuit open":         {fmt.Errorf("upstream compute: %w", ErrCircuitOpen), false, true},
+		"failed call":          {upstreamError, false, false},
+		"failed idempotent":    {upstreamError, true, true},
+		"timed out idempotent": {&TimeoutError{Upstream: "compute", Operation: "tool run"}, true, false},
+	}
+	for name, test := range tests {
+		if retry := failover(ctx, test.err, test.retryable); retry != test.expected {
+			t.Errorf("%s: expected failover %v, got %v", name, test.expected, retry)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+//go:build !windows
+
+package client
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// ownProcessGroup starts the upstream in a process group of its own, so the
+// processes it spawns, like the node process of npx, can be stopped with it.
+func ownProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// terminate asks the process group of the upstream to exit.
+func terminate(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+}
+
+// kill stops the process group of the upstream.
+func kill(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,16 @@
+//go:build windows
+
+package client
+
+import "os/exec"
+
+func ownProcessGroup(cmd *exec.Cmd) {}
+
+// terminate has no gentler way on windows than to kill the process.
+func terminate(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
+
+func kill(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
@@ -0,0 +1,448 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ebamberg/mcp-gate/cache"
+	"github.com/ebamberg/mcp-gate/ratelimit"
+	"github.com/ebamberg/mcp-gate/tracing"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	methodNotificationProgress  = "notifications/progress"
+	methodNotificationCancelled = "notifications/cancelled"
+
+	// requestIDMetaKey is used to hand the JSON-RPC id of a downstream tool call
+	// from the server hooks to the proxy handler. It is never sent upstream.
+	requestIDMetaKey = "mcp-gate/requestId"
+)
+
+// upstreamCall links a tool call forwarded to an upstream server with the
+// downstream session that issued it.
+type upstreamCall struct {
+	server        *server.MCPServer
+	session       server.ClientSession
+	sessionID     string
+	progressToken mcp.ProgressToken
+	upstreamID    mcp.RequestId
+}
+
+type upstreamCallKey struct{}
+
+type inflightKey struct {
+	sessionID string
+	requestID string
+}
+
+// RateLimiter is applied to every proxied tool call, nil disables rate limits.
+var RateLimiter *ratelimit.Limiter
+
+// inflightCalls holds the cancel functions of all proxied tool calls, keyed by
+// downstream session and request id.
+var inflightCalls sync.Map
+
+// NewProxyHooks returns the server hooks needed to relay cancellations of
+// proxied tool calls and to keep track of the client sessions.
+func NewProxyHooks() *server.Hooks {
+	hooks := &server.Hooks{}
+	hooks.AddBeforeCallTool(tagRequestID)
+	addSessionMetrics(hooks)
+	trackSessions(hooks)
+	return hooks
+}
+
+// RegisterProxyNotificationHandlers adds the handlers for client notifications
+// that need to be forwarded to the upstream servers.
+func RegisterProxyNotificationHandlers(s *server.MCPServer) {
+	s.AddNotificationHandler(methodNotificationCancelled, handleCancelledNotification)
+	s.AddNotificationHandler(mcp.MethodNotificationRootsListChanged, handleRootsListChanged)
+}
+
+func tagRequestID(ctx context.Context, id any, request *mcp.CallToolRequest) {
+	if request.Params.Meta == nil {
+		request.Params.Meta = &mcp.Meta{}
+	}
+	if request.Params.Meta.AdditionalFields == nil {
+		request.Params.Meta.AdditionalFields = map[string]any{}
+	}
+	request.Params.Meta.AdditionalFields[requestIDMetaKey] = id
+}
+
+func handleCancelledNotification(ctx context.Context, notification mcp.JSONRPCNotification) {
+	requestID, ok := notification.Params.AdditionalFields["requestId"]
+	if !ok {
+		return
+	}
+	key := inflightKey{sessionID: sessionIDFromContext(ctx), requestID: fmt.Sprint(requestID)}
+	if cancel, ok := inflightCalls.Load(key); ok {
+		log.Printf("Cancelling proxied request %v: %v", requestID, notification.Params.AdditionalFields["reason"])
+		cancel.(context.CancelFunc)()
+	}
+}
+
+// principalFromContext identifies the calling client by the name it sent in
+// its client info, falling back to the session id.
+func principalFromContext(ctx context.Context) string {
+	session := server.ClientSessionFromContext(ctx)
+	if withInfo, ok := session.(server.SessionWithClientInfo); ok && withInfo.GetClientInfo().Name != "" {
+		return withInfo.GetClientInfo().Name
+	}
+	if session != nil {
+		return session.SessionID()
+	}
+	return "anonymous"
+}
+
+func sessionIDFromContext(ctx context.Context) string {
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		return session.SessionID()
+	}
+	return ""
+}
+
+// callError is a tool call that failed at the upstream. It is reported to the
+// client as a tool result with isError set.
+type callError struct {
+	Upstream string
+	Err      error
+}
+
+func (e *callError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Upstream, e.Err)
+}
+
+func (e *callError) Unwrap() error {
+	return e.Err
+}
+
+func (client *Client) proxyToolHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	started := time.Now()
+	inFlight.WithLabelValues(client.Name).Inc()
+	defer inFlight.WithLabelValues(client.Name).Dec()
+
+	var result *mcp.CallToolResult
+	var err error
+	if client.pool != nil {
+		result, err = client.pool.callTool(ctx, request)
+	} else {
+		result, err = client.callTool(ctx, request)
+	}
+	observe(string(mcp.MethodToolsCall), client.Name, request.Params.Name, started, toolOutcome(result, err))
+	var failed *callError
+	var limited *ratelimit.LimitError
+	if errors.As(err, &failed) {
+		return mcp.NewToolResultError(failed.Error()), nil
+	}
+	if errors.As(err, &limited) || errors.Is(err, ErrQueueFull) || errors.Is(err, ErrQueueTimeout) {
+		// the call was refused by a policy of the gateway, reported like a failed call
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	return result, err
+}
+
+func (client *Client) callTool(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	if err := client.awaitConnection(ctx); err != nil {
+		return nil, err
+	}
+	if exit, reason := client.exitOnNotConnected(); exit {
+		return nil, &callError{Upstream: client.Name, Err: reason}
+	}
+
+	cacheable := client.isToolCacheable(request.Params.Name)
+	cacheKey := cache.Key(client.Name, "tool", request.Params.Name, request.Params.Arguments)
+	if cacheable {
+		_, span := tracing.Start(ctx, "cache lookup")
+		result, ok := client.cachedToolResult(cacheKey)
+		span.SetAttributes(attribute.Bool("cache.hit", ok))
+		span.End()
+		if ok {
+			return result, nil
+		}
+	}
+
+	_, span := tracing.Start(ctx, "policy")
+	trial, err := client.breaker.allow()
+	if err != nil {
+		tracing.End(span, err)
+		return nil, err
+	}
+	span.End()
+
+	timeout := client.callTimeout(request.Params.Name)
+	ctx, cancel := withTimeout(ctx, timeout)
+	defer cancel()
+
+	call := &upstreamCall{
+		server:    server.ServerFromContext(ctx),
+		session:   server.ClientSessionFromContext(ctx),
+		sessionID: sessionIDFromContext(ctx),
+	}
+	client.active.Store(call, struct{}{})
+	defer client.active.Delete(call)
+	upstreamRequest := mcp.CallToolRequest{}
+	upstreamRequest.Params.Name = request.Params.Name
+	upstreamRequest.Params.Arguments = request.Params.Arguments
+
+	upstreamMeta := &mcp.Meta{AdditionalFields: map[string]any{}}
+	if meta := request.Params.Meta; meta != nil {
+		for name, value := range meta.AdditionalFields {
+			if name == requestIDMetaKey {
+				key := inflightKey{sessionID: call.sessionID, requestID: fmt.Sprint(value)}
+				inflightCalls.Store(key, cancel)
+				defer inflightCalls.Delete(key)
+			} else {
+				upstreamMeta.AdditionalFields[name] = value
+			}
+		}
+		if meta.ProgressToken != nil {
+			call.progressToken = meta.ProgressToken
+			token := fmt.Sprintf("mcp-gate-%d", client.progressTokens.Add(1))
+			client.calls.Store(token, call)
+			defer client.calls.Delete(token)
+			upstreamMeta.ProgressToken = token
+		}
+	}
+
+	_, span = tracing.Start(ctx, "queue")
+	release, err := client.limiter.acquire(ctx)
+	tracing.End(span, err)
+	if err != nil {
+		client.breaker.abort(trial)
+		if timedOut(ctx, timeout) {
+			return nil, &TimeoutError{Upstream: client.Name, Operation: "tool " + request.Params.Name, Timeout: timeout}
+		}
+		return nil, err
+	}
+	defer release()
+	// only a call that is sent counts against the rate limits and quotas
+	_, span = tracing.Start(ctx, "rate limit")
+	err = RateLimiter.Allow(principalFromContext(ctx), client.Name, request.Params.Name)
+	tracing.End(span, err)
+	if err != nil {
+		client.breaker.abort(trial)
+		return nil, fmt.Errorf("upstream %s: %w", client.Name, err)
+	}
+
+	ctx, span = tracing.StartUpstream(ctx, string(mcp.MethodToolsCall)+" "+request.Params.Name, client.key())
+	tracing.InjectMeta(ctx, upstreamMeta.AdditionalFields)
+	upstreamRequest.Params.Meta = upstreamMeta
+	started := time.Now()
+	result, err := client.upstream().CallTool(context.WithValue(ctx, upstreamCallKey{}, call), upstreamRequest)
+	tracing.End(span, err)
+	if err != nil && ctx.Err() == context.Canceled {
+		// a call cancelled by the client says nothing about the health of the upstream
+		client.breaker.abort(trial)
+	} else {
+		client.breaker.record(trial, err, time.Since(started))
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			client.cancelUpstreamCall(call, ctx.Err())
+		}
+		if timedOut(ctx, timeout) {
+			return nil, &TimeoutError{Upstream: client.Name, Operation: "tool " + request.Params.Name, Timeout: timeout}
+		}
+		client.recordError(err)
+		return nil, &callError{Upstream: client.Name, Err: err}
+	}
+	if cacheable {
+		client.cacheToolResult(cacheKey, result)
+	}
+	return result, nil
+}
+
+func (client *Client) proxyResourceHandler(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	started := time.Now()
+	inFlight.WithLabelValues(client.Name).Inc()
+	defer inFlight.WithLabelValues(client.Name).Dec()
+
+	var contents []mcp.ResourceContents
+	var err error
+	if client.pool != nil {
+		contents, err = client.pool.readResource(ctx, request)
+	} else {
+		contents, err = client.readResource(ctx, request)
+	}
+	observe(string(mcp.MethodResourcesRead), client.Name, "", started, outcomeOf(err))
+	return contents, err
+}
+
+func (client *Client) readResource(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	if err := client.awaitConnection(ctx); err != nil {
+		return nil, err
+	}
+	if exit, reason := client.exitOnNotConnected(); exit {
+		return nil, fmt.Errorf("%s: %w", client.Name, reason)
+	}
+
+	cacheKey := cache.Key(client.Name, "resource", request.Params.URI, request.Params.Arguments)
+	if client.cacheConfig.Resources && !client.cacheConfig.Disabled {
+		if result, ok := client.cachedResource(cacheKey); ok {
+			return result.Contents, nil
+		}
+	}
+
+	timeout := client.timeouts.Call
+	ctx, cancel := withTimeout(ctx, timeout)
+	defer cancel()
+
+	release, err := client.limiter.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	upstreamRequest := mcp.ReadResourceRequest{}
+	upstreamRequest.Params.URI = request.Params.URI
+	upstreamRequest.Params.Arguments = request.Params.Arguments
+	ctx, span := tracing.StartUpstream(ctx, string(mcp.MethodResourcesRead), client.key())
+	result, err := client.upstream().ReadResource(ctx, upstreamRequest)
+	tracing.End(span, err)
+	if err != nil {
+		if timedOut(ctx, timeout) {
+			return nil, &TimeoutError{Upstream: client.Name, Operation: "resource " + request.Params.URI, Timeout: timeout}
+		}
+		return nil, fmt.Errorf("upstream %s: %w", client.Name, err)
+	}
+	if client.cacheConfig.Resources && !client.cacheConfig.Disabled {
+		client.cacheResource(cacheKey, result)
+	}
+	return result.Contents, nil
+}
+
+func (client *Client) proxyPromptHandler(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	ctx, span := tracing.StartPrompt(ctx, request)
+	started := time.Now()
+	inFlight.WithLabelValues(client.Name).Inc()
+	defer inFlight.WithLabelValues(client.Name).Dec()
+
+	var result *mcp.GetPromptResult
+	var err error
+	if client.pool != nil {
+		result, err = client.pool.getPrompt(ctx, request)
+	} else {
+		result, err = client.getPrompt(ctx, request)
+	}
+	observe(string(mcp.MethodPromptsGet), client.Name, request.Params.Name, started, outcomeOf(err))
+	tracing.End(span, err)
+	return result, err
+}
+
+func (client *Client) getPrompt(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	if err := client.awaitConnection(ctx); err != nil {
+		return nil, err
+	}
+	if exit, reason := client.exitOnNotConnected(); exit {
+		return nil, fmt.Errorf("%s: %w", client.Name, reason)
+	}
+
+	timeout := client.timeouts.Call
+	ctx, cancel := withTimeout(ctx, timeout)
+	defer cancel()
+
+	release, err := client.limiter.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	upstreamRequest := mcp.GetPromptRequest{}
+	upstreamRequest.Params.Name = request.Params.Name
+	upstreamRequest.Params.Arguments = request.Params.Arguments
+	ctx, span := tracing.StartUpstream(ctx, string(mcp.MethodPromptsGet)+" "+request.Params.Name, client.key())
+	result, err := client.upstream().GetPrompt(ctx, upstreamRequest)
+	tracing.End(span, err)
+	if err != nil {
+		if timedOut(ctx, timeout) {
+			return nil, &TimeoutError{Upstream: client.Name, Operation: "prompt " + request.Params.Name, Timeout: timeout}
+		}
+		return nil, fmt.Errorf("upstream %s: %w", client.Name, err)
+	}
+	return result, nil
+}
+
+// forwardProgress relays a progress notification of an upstream server to the
+// client session that started the call, restoring the original progress token.
+func (client *Client) forwardProgress(notification mcp.JSONRPCNotification) {
+	token, ok := notification.Params.AdditionalFields["progressToken"]
+	if !ok {
+		return
+	}
+	value, ok := client.calls.Load(token)
+	if !ok {
+		log.Printf("%s: dropping progress for unknown token %v", client.Name, token)
+		return
+	}
+	call := value.(*upstreamCall)
+	if call.server == nil || call.sessionID == "" {
+		return
+	}
+
+	params := make(map[string]any, len(notification.Params.AdditionalFields))
+	for name, value := range notification.Params.AdditionalFields {
+		params[name] = value
+	}
+	params["progressToken"] = call.progressToken
+	if err := call.server.SendNotificationToSpecificClient(call.sessionID, methodNotificationProgress, params); err != nil {
+		log.Printf("%s: failed to forward progress: %v", client.Name, err)
+	}
+}
+
+func (client *Client) cancelUpstreamCall(call *upstreamCall, reason error) {
+	if call.upstreamID.IsNil() {
+		return
+	}
+	notification := mcp.JSONRPCNotification{
+		JSONRPC: mcp.JSONRPC_VERSION,
+		Notification: mcp.Notification{
+			Method: methodNotificationCancelled,
+			Params: mcp.NotificationParams{
+				AdditionalFields: map[string]any{
+					"requestId": call.upstreamID,
+					"reason":    reason.Error(),
+				},
+			},
+		},
+	}
+	if err := client.upstream().GetTransport().SendNotification(context.Background(), notification); err != nil {
+		log.Printf("%s: failed to cancel request %s: %v", client.Name, call.upstreamID.String(), err)
+	}
+}
+
+// trackingTransport records the upstream request id of proxied calls so they
+// can be cancelled later on.
+type trackingTransport struct {
+	transport.Interface
+}
+
+func newTrackingTransport(inner transport.Interface) *trackingTransport {
+	return &trackingTransport{Interface: inner}
+}
+
+func (t *trackingTransport) SendRequest(ctx context.Context, request transport.JSONRPCRequest) (*transport.JSONRPCResponse, error) {
+	if call, ok := ctx.Value(upstreamCallKey{}).(*upstreamCall); ok {
+		call.upstreamID = request.ID
+	}
+	return t.Interface.SendRequest(ctx, request)
+}
+
+func (t *trackingTransport) SetRequestHandler(handler transport.RequestHandler) {
+	if bidirectional, ok := t.Interface.(transport.BidirectionalInterface); ok {
+		bidirectional.SetRequestHandler(handler)
+	}
+}
+
+func (t *trackingTransport) SetProtocolVersion(version string) {
+	if httpConn, ok := t.Interface.(transport.HTTPConnection); ok {
+		httpConn.SetProtocolVersion(version)
+	}
+}
@@ -0,0 +1,116 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+type testSession struct {
+	id            string
+	notifications chan mcp.JSONRPCNotification
+}
+
+func newTestSession(id string) *testSession {
+	return &testSession{id: id, notifications: make(chan mcp.JSONRPCNotification, 10)}
+}
+
+func (s *testSession) Initialize()                                         {}
+func (s *testSession) Initialized() bool                                   { return true }
+func (s *testSession) NotificationChannel() chan<- mcp.JSONRPCNotification { return s.notifications }
+func (s *testSession) SessionID() string                                   { return s.id }
+
+func TestForwardProgressRestoresToken(t *testing.T) {
+	gateway := server.NewMCPServer("test", "1.0.0")
+	session := newTestSession("session-1")
+	if err := gateway.RegisterSession(context.Background(), session); err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+
+	client := &Client{Name: "upstream"}
+	client.calls.Store("mcp-gate-1", &upstreamCall{server: gateway, sessionID: "session-1", progressToken: "client-token"})
+
+	client.forwardProgress(mcp.JSONRPCNotification{
+		JSONRPC: mcp.JSONRPC_VERSION,
+		Notification: mcp.Notification{
+			Method: methodNotificationProgress,
+			Params: mcp.NotificationParams{
+				AdditionalFields: map[string]any{"progressToken": "mcp-gate-1", "progress": 5, "total": 10},
+			},
+		},
+	})
+
+	select {
+	case notification := <-session.notifications:
+		if notification.Method != methodNotificationProgress {
+			t.Errorf("Expected method %s, got %s", methodNotificationProgress, notification.Method)
+		}
+		if token := notification.Params.AdditionalFields["progressToken"]; token != "client-token" {
+			t.Errorf("Expected progress token 'client-token', got '%v'", token)
+		}
+		if progress := notification.Params.AdditionalFields["progress"]; progress != 5 {
+			t.Errorf("Expected progress 5, got %v", progress)
+		}
+	default:
+		t.Fatal("Expected a progress notification for the session, but found none.")
+	}
+}
+
+func TestForwardProgressIgnoresUnknownToken(t *testing.T) {
+	gateway := server.NewMCPServer("test", "1.0.0")
+	session := newTestSession("session-1")
+	if err := gateway.RegisterSession(context.Background(), session); err != nil {
+		t.Fatalf("Failed to register session: %v", err)
+	}
+
+	client := &Client{Name: "upstream"}
+	client.calls.Store("mcp-gate-1", &upstreamCall{server: gateway, sessionID: "session-1", progressToken: "client-token"})
+
+	client.forwardProgress(mcp.JSONRPCNotification{
+		JSONRPC: mcp.JSONRPC_VERSION,
+		Notification: mcp.Notification{
+			Method: methodNotificationProgress,
+			Params: mcp.NotificationParams{
+				AdditionalFields: map[string]any{"progressToken": "unknown", "progress": 5},
+			},
+		},
+	})
+
+	select {
+	case notification := <-session.notifications:
+		t.Errorf("Expected no notification for an unknown token, got %+v", notification)
+	default:
+	}
+}
+
+func TestCancelledNotificationCancelsCall(t *testing.T) {
+	gateway := server.NewMCPServer("test", "1.0.0")
+	session := newTestSession("session-1")
+
+	request := mcp.CallToolRequest{}
+	tagRequestID(context.Background(), float64(7), &request)
+	if id := request.Params.Meta.AdditionalFields[requestIDMetaKey]; id != float64(7) {
+		t.Fatalf("Expected request id 7 in meta, got %v", id)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	key := inflightKey{sessionID: "session-1", requestID: "7"}
+	inflightCalls.Store(key, cancel)
+	defer inflightCalls.Delete(key)
+
+	handleCancelledNotification(gateway.WithContext(context.Background(), session), mcp.JSONRPCNotification{
+		Notification: mcp.Notification{
+			Method: methodNotificationCancelled,
+			Params: mcp.NotificationParams{
+				AdditionalFields: map[string]any{"requestId": float64(7), "reason": "user abort"},
+			},
+		},
+	})
+
+	if ctx.Err() == nil {
+		t.Error("Expected the proxied call to be cancelled")
+	}
+}
@@ -0,0 +1,151 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// registry holds all upstream clients linked to the gateway, keyed by name
+// and replica.
+var registry sync.Map
+
+func registerClient(client *Client) {
+	registry.Store(client.key(), client)
+}
+
+func registeredClients() []*Client {
+	var clients []*Client
+	registry.Range(func(_, value any) bool {
+		clients = append(clients, value.(*Client))
+		return true
+	})
+	sort.Slice(clients, func(i, j int) bool { return clients[i].key() < clients[j].key() })
+	return clients
+}
+
+// downstreamCapabilities returns the capabilities the client session in ctx
+// declared during initialization.
+func downstreamCapabilities(ctx context.Context) mcp.ClientCapabilities {
+	if session, ok := server.ClientSessionFromContext(ctx).(server.SessionWithClientInfo); ok {
+		return session.GetClientCapabilities()
+	}
+	return mcp.ClientCapabilities{}
+}
+
+// relayedCapabilities are offered to upstreams started with the gateway,
+// before any client has connected. Requests the client turns out not to
+// support fail when they are relayed.
+var relayedCapabilities = mcp.ClientCapabilities{
+	Sampling:    &struct{}{},
+	Elicitation: &struct{}{},
+	Roots: &struct {
+		ListChanged bool `json:"listChanged,omitempty"`
+	}{ListChanged: true},
+}
+
+// relayOptions configures the upstream client to forward sampling, elicitation
+// and roots requests, but only for the capabilities the downstream client has.
+func relayOptions(client *Client, capabilities mcp.ClientCapabilities) []mcpclient.ClientOption {
+	relay := &downstreamRelay{client: client}
+	var options []mcpclient.ClientOption
+	if capabilities.Sampling != nil {
+		options = append(options, mcpclient.WithSamplingHandler(relay))
+	}
+	if capabilities.Elicitation != nil {
+		options = append(options, mcpclient.WithElicitationHandler(relay))
+	}
+	if capabilities.Roots != nil {
+		options = append(options, mcpclient.WithRootsHandler(relay))
+	}
+	return options
+}
+
+// downstreamRelay implements the client side handlers of the upstream
+// connection by passing each request on to the downstream session.
+type downstreamRelay struct {
+	client *Client
+}
+
+// context returns the client session of the tool call the request of the
+// upstream belongs to. MCP does not tie server-to-client requests to a call,
+// so a request is only relayed while the calls in flight to the upstream all
+// come from one session.
+func (relay *downstreamRelay) context(ctx context.Context) (*server.MCPServer, context.Context, error) {
+	var target *upstreamCall
+	ambiguous := false
+	relay.client.active.Range(func(key, _ any) bool {
+		call := key.(*upstreamCall)
+		if target != nil && call.sessionID != target.sessionID {
+			ambiguous = true
+			return false
+		}
+		target = call
+		return true
+	})
+	switch {
+	case ambiguous:
+		return nil, ctx, fmt.Errorf("%s: calls of several client sessions are in flight, the request cannot be relayed", relay.client.Name)
+	case target == nil || target.server == nil || target.session == nil:
+		return nil, ctx, fmt.Errorf("%s: no tool call in flight to relay the request to", relay.client.Name)
+	}
+	return target.server, target.server.WithContext(ctx, target.session), nil
+}
+
+func (relay *downstreamRelay) unsupported(feature string) error {
+	return fmt.Errorf("%s: the client does not support %s", relay.client.Name, feature)
+}
+
+func (relay *downstreamRelay) CreateMessage(ctx context.Context, request mcp.CreateMessageRequest) (*mcp.CreateMessageResult, error) {
+	s, ctx, err := relay.context(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if downstreamCapabilities(ctx).Sampling == nil {
+		return nil, relay.unsupported("sampling")
+	}
+	log.Printf("%s: relaying sampling request", relay.client.Name)
+	return s.RequestSampling(ctx, request)
+}
+
+func (relay *downstreamRelay) Elicit(ctx context.Context, request mcp.ElicitationRequest) (*mcp.ElicitationResult, error) {
+	s, ctx, err := relay.context(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if downstreamCapabilities(ctx).Elicitation == nil {
+		return nil, relay.unsupported("elicitation")
+	}
+	log.Printf("%s: relaying elicitation request", relay.client.Name)
+	return s.RequestElicitation(ctx, request)
+}
+
+func (relay *downstreamRelay) ListRoots(ctx context.Context, request mcp.ListRootsRequest) (*mcp.ListRootsResult, error) {
+	s, ctx, err := relay.context(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if downstreamCapabilities(ctx).Roots == nil {
+		return nil, relay.unsupported("roots")
+	}
+	return s.RequestRoots(ctx, request)
+}
+
+// handleRootsListChanged tells every upstream that relays roots that the
+// roots of the downstream client have changed.
+func handleRootsListChanged(ctx context.Context, notification mcp.JSONRPCNotification) {
+	for _, client := range registeredClients() {
+		if !client.isConnected() || client.capabilities.Roots == nil {
+			continue
+		}
+		if err := client.upstream().RootListChanges(ctx); err != nil {
+			log.Printf("%s: failed to forward roots change: %v", client.Name, err)
+		}
+	}
+}
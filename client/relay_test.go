@@ -0,0 +1,67 @@
+package client
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+func TestRelayOptionsFollowDownstreamCapabilities(t *testing.T) {
+	client := &Client{Name: "upstream"}
+	if options := relayOptions(client, mcp.ClientCapabilities{}); len(options) != 0 {
+		t.Errorf("Expected no relay options without downstream capabilities, got %d", len(options))
+	}
+
+	capabilities := mcp.ClientCapabilities{Sampling: &struct{}{}, Elicitation: &struct{}{}}
+	if options := relayOptions(client, capabilities); len(options) != 2 {
+		t.Errorf("Expected 2 relay options, got %d", len(options))
+	}
+}
+
+func TestRelayWithoutDownstreamFails(t *testing.T) {
+	relay := &downstreamRelay{client: &Client{Name: "upstream"}}
+	if _, err := relay.CreateMessage(context.Background(), mcp.CreateMessageRequest{}); err == nil {
+		t.Error("Expected an error when no client session is available")
+	}
+}
+
+func TestRelayFollowsTheCallInFlight(t *testing.T) {
+	gateway := server.NewMCPServer("test", "1.0.0")
+	client := &Client{Name: "upstream"}
+	relay := &downstreamRelay{client: client}
+
+	first := &upstreamCall{server: gateway, session: newTestSession("session-1"), sessionID: "session-1"}
+	client.active.Store(first, struct{}{})
+	_, ctx, err := relay.context(context.Background())
+	if err != nil || sessionIDFromContext(ctx) != "session-1" {
+		t.Fatalf("Expected the request to go to session-1, got %q, %v", sessionIDFromContext(ctx), err)
+	}
+
+	// another call of the same session does not make it ambiguous
+	client.active.Store(&upstreamCall{server: gateway, session: first.session, sessionID: "session-1"}, struct{}{})
+	if _, _, err := relay.context(context.Background()); err != nil {
+		t.Errorf("Expected calls of one session to be relayed, got %v", err)
+	}
+
+	client.active.Store(&upstreamCall{server: gateway, session: newTestSession("session-2"), sessionID: "session-2"}, struct{}{})
+	if _, _, err := relay.context(context.Background()); err == nil {
+		t.Error("Expected the request to be rejected while calls of two sessions are in flight")
+	}
+}
+
+func TestRelayedRequestNeedsTheDownstreamCapability(t *testing.T) {
+	gateway := server.NewMCPServer("test", "1.0.0")
+	client := &Client{Name: "upstream"}
+	client.active.Store(&upstreamCall{server: gateway, session: newTestSession("session-1"), sessionID: "session-1"}, struct{}{})
+
+	relay := &downstreamRelay{client: client}
+	if _, err := relay.CreateMessage(context.Background(), mcp.CreateMessageRequest{}); err == nil || !strings.Contains(err.Error(), "does not support sampling") {
+		t.Errorf("Expected sampling to be refused for a client without it, got %v", err)
+	}
+	if _, err := relay.ListRoots(context.Background(), mcp.ListRootsRequest{}); err == nil || !strings.Contains(err.Error(), "does not support roots") {
+		t.Errorf("Expected roots to be refused for a client without them, got %v", err)
+	}
+}
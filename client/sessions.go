@@ -0,0 +1,65 @@
+package client
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// SessionInfo describes a client session connected to the gateway.
+type SessionInfo struct {
+	ID            string    `json:"id"`
+	Client        string    `json:"client,omitempty"`
+	ClientVersion string    `json:"clientVersion,omitempty"`
+	Connected     time.Time `json:"connected"`
+	InFlight      int       `json:"inFlight"` // tool calls that have not finished
+}
+
+type trackedSession struct {
+	session   server.ClientSession
+	connected time.Time
+}
+
+// connectedSessions holds the connected client sessions, keyed by session id.
+var connectedSessions sync.Map
+
+func trackSessions(hooks *server.Hooks) {
+	hooks.AddOnRegisterSession(func(ctx context.Context, session server.ClientSession) {
+		connectedSessions.Store(session.SessionID(), trackedSession{session: session, connected: time.Now()})
+	})
+	hooks.AddOnUnregisterSession(func(ctx context.Context, session server.ClientSession) {
+		connectedSessions.Delete(session.SessionID())
+		forgetSession(session.SessionID())
+	})
+}
+
+// Sessions returns the client sessions connected to the gateway, the oldest
+// first.
+func Sessions() []SessionInfo {
+	inFlight := map[string]int{}
+	inflightCalls.Range(func(key, _ any) bool {
+		inFlight[key.(inflightKey).sessionID]++
+		return true
+	})
+
+	var sessions []SessionInfo
+	connectedSessions.Range(func(_, value any) bool {
+		tracked := value.(trackedSession)
+		info := SessionInfo{
+			ID:        tracked.session.SessionID(),
+			Connected: tracked.connected,
+			InFlight:  inFlight[tracked.session.SessionID()],
+		}
+		if withInfo, ok := tracked.session.(server.SessionWithClientInfo); ok {
+			info.Client = withInfo.GetClientInfo().Name
+			info.ClientVersion = withInfo.GetClientInfo().Version
+		}
+		sessions = append(sessions, info)
+		return true
+	})
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Connected.Before(sessions[j].Connected) })
+	return sessions
+}
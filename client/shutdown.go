@@ -0,0 +1,83 @@
+package client
+
+import (
+	"log"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/ebamberg/mcp-gate/repo"
+	"github.com/ebamberg/mcp-gate/sandbox"
+)
+
+// StopTimeout is how long an upstream gets to exit once its connection is
+// closed, and once more after SIGTERM, before its processes are killed.
+var StopTimeout = 5 * time.Second
+
+// Shutdown stops all upstreams at once and returns when they are gone.
+func Shutdown() {
+	var wg sync.WaitGroup
+	for _, client := range registeredClients() {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			registry.Delete(client.key())
+			client.shutdown()
+		}()
+	}
+	wg.Wait()
+}
+
+// closeConnection closes the connection to the upstream. The process of an
+// ipc upstream is closed as the MCP spec describes it: stdin is closed first,
+// then SIGTERM is sent and at last SIGKILL, to its whole process group. The
+// container of a killed container upstream is removed, as is the cgroup of a
+// sandboxed one.
+func (client *Client) closeConnection() {
+	if client.upstream() == nil {
+		return
+	}
+	client.statusMu.RLock()
+	cmd, container := client.cmd, client.container
+	client.statusMu.RUnlock()
+
+	if client.config.Sandbox != nil {
+		defer sandbox.Cleanup(client.processName())
+	}
+	closed := make(chan error, 1)
+	go func() { closed <- client.upstream().Close() }()
+	for i, stop := range []func(*exec.Cmd){terminate, kill, nil} {
+		if i == 2 && container != "" {
+			// the killed CLI cannot take its container along
+			removeContainer(client.config, container)
+		}
+		select {
+		case err := <-closed:
+			if err != nil {
+				log.Printf("%s: %v", client.key(), err)
+			}
+			return
+		case <-time.After(StopTimeout):
+		}
+		if stop == nil || cmd == nil || cmd.Process == nil {
+			break
+		}
+		log.Printf("%s: still running after %s, stopping its processes", client.key(), StopTimeout)
+		stop(cmd)
+	}
+	log.Printf("%s: connection did not close", client.key())
+}
+
+// removeContainer force removes the container of the upstream.
+func removeContainer(config repo.RepositoryEntry, name string) {
+	if config.Container == nil {
+		return
+	}
+	runtime, err := config.Container.CLI()
+	if err != nil {
+		return
+	}
+	if output, err := exec.Command(runtime, "rm", "-f", name).CombinedOutput(); err != nil {
+		log.Printf("%s: unable to remove container %s: %v %s", config.Name, name, err, output)
+	}
+}
@@ -0,0 +1,60 @@
+package client
+
+import "time"
+
+// UpstreamStatus describes an upstream, or one replica of it.
+type UpstreamStatus struct {
+	Name      string        `json:"name"`
+	Replica   int           `json:"replica,omitempty"`
+	State     string        `json:"state"`
+	Healthy   bool          `json:"healthy"`
+	PID       int           `json:"pid,omitempty"`
+	Uptime    time.Duration `json:"uptime,omitempty"`
+	Restarts  int64         `json:"restarts"`
+	Tools     int           `json:"tools"`
+	Latency   time.Duration `json:"latency,omitempty"` // of the last successful ping
+	LastCheck time.Time     `json:"lastCheck"`
+	LastError string        `json:"lastError,omitempty"`
+}
+
+// Statuses returns the status of every upstream linked to the gateway.
+func Statuses() []UpstreamStatus {
+	var statuses []UpstreamStatus
+	for _, client := range registeredClients() {
+		statuses = append(statuses, client.status())
+	}
+	return statuses
+}
+
+func (client *Client) status() UpstreamStatus {
+	owner := client.owner()
+	owner.catalogMu.RLock()
+	tools := len(owner.tools)
+	owner.catalogMu.RUnlock()
+
+	state := client.GetStatus()
+	connected := state == CONNECTED || state == CIRCUIT_OPEN
+	status := UpstreamStatus{
+		Name:     client.Name,
+		State:    state.String(),
+		Healthy:  client.isConnected() && !client.unhealthy.Load(),
+		Restarts: client.restarts.Load(),
+		Tools:    tools,
+	}
+	if client.pool != nil {
+		status.Replica = client.replica + 1
+	}
+
+	client.statusMu.RLock()
+	defer client.statusMu.RUnlock()
+	if client.cmd != nil && client.cmd.Process != nil && connected {
+		status.PID = client.cmd.Process.Pid
+	}
+	if !client.health.started.IsZero() && connected {
+		status.Uptime = time.Since(client.health.started).Round(time.Second)
+	}
+	status.Latency = client.health.latency
+	status.LastCheck = client.health.checked
+	status.LastError = client.health.lastError
+	return status
+}
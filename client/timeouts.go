@@ -0,0 +1,91 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/ebamberg/mcp-gate/repo"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// DefaultTimeouts are used for every timeout an upstream does not configure.
+// A call timeout of zero lets tool calls run as long as the client waits.
+var DefaultTimeouts = repo.Timeouts{
+	Connect:    30 * time.Second,
+	Initialize: 30 * time.Second,
+	List:       30 * time.Second,
+}
+
+// TimeoutError is returned when an upstream does not answer in time.
+type TimeoutError struct {
+	Upstream  string
+	Operation string
+	Timeout   time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("upstream %s: %s timed out after %s", e.Upstream, e.Operation, e.Timeout)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return mcp.ErrRequestInterrupted
+}
+
+// withDefaults fills every unset timeout from DefaultTimeouts.
+func withDefaults(timeouts repo.Timeouts) repo.Timeouts {
+	defaultsMu.RLock()
+	defer defaultsMu.RUnlock()
+	if timeouts.Connect == 0 {
+		timeouts.Connect = DefaultTimeouts.Connect
+	}
+	if timeouts.Initialize == 0 {
+		timeouts.Initialize = DefaultTimeouts.Initialize
+	}
+	if timeouts.List == 0 {
+		timeouts.List = DefaultTimeouts.List
+	}
+	if timeouts.Call == 0 {
+		timeouts.Call = DefaultTimeouts.Call
+	}
+	tools := map[string]time.Duration{}
+	for pattern, timeout := range DefaultTimeouts.Tools {
+		tools[pattern] = timeout
+	}
+	for pattern, timeout := range timeouts.Tools {
+		tools[pattern] = timeout
+	}
+	timeouts.Tools = tools
+	return timeouts
+}
+
+// callTimeout returns the timeout for a call of the named tool. An exact name
+// wins over patterns, and the longest matching pattern wins over shorter ones.
+func (client *Client) callTimeout(tool string) time.Duration {
+	if timeout, ok := client.timeouts.Tools[tool]; ok {
+		return timeout
+	}
+	timeout, matched := client.timeouts.Call, ""
+	for pattern, patternTimeout := range client.timeouts.Tools {
+		if ok, _ := path.Match(pattern, tool); ok && len(pattern) > len(matched) {
+			timeout, matched = patternTimeout, pattern
+		}
+	}
+	return timeout
+}
+
+// withTimeout returns a context for the operation that ends after timeout. A
+// zero timeout leaves the deadline of ctx untouched.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// timedOut reports whether an operation ran into its own timeout rather than
+// being cancelled from outside.
+func timedOut(ctx context.Context, timeout time.Duration) bool {
+	return timeout > 0 && ctx.Err() == context.DeadlineExceeded
+}
@@ -0,0 +1,132 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ebamberg/mcp-gate/repo"
+	mcpclient "github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestWithDefaultsKeepsConfiguredTimeouts(t *testing.T) {
+	timeouts := withDefaults(repo.Timeouts{List: 5 * time.Second})
+	if timeouts.List != 5*time.Second {
+		t.Errorf("Expected list timeout 5s, got %s", timeouts.List)
+	}
+	if timeouts.Initialize != DefaultTimeouts.Initialize {
+		t.Errorf("Expected default initialize timeout %s, got %s", DefaultTimeouts.Initialize, timeouts.Initialize)
+	}
+}
+
+func TestCallTimeoutPrefersMostSpecificPattern(t *testing.T) {
+	client := &Client{Name: "upstream", timeouts: withDefaults(repo.Timeouts{
+		Call: time.Minute,
+		Tools: map[string]time.Duration{
+			"*":            2 * time.Minute,
+			"search*":      5 * time.Second,
+			"search_index": 10 * time.Minute,
+		},
+	})}
+
+	tests := map[string]time.Duration{
+		"search_index": 10 * time.Minute,
+		"search_docs":  5 * time.Second,
+		"build":        2 * time.Minute,
+	}
+	for tool, expected := range tests {
+		if timeout := client.callTimeout(tool); timeout != expected {
+			t.Errorf("Expected timeout %s for tool %s, got %s", expected, tool, timeout)
+		}
+	}
+}
+
+func TestTimeoutErrorNamesUpstream(t *testing.T) {
+	err := &TimeoutError{Upstream: "indexer", Operation: "tool build", Timeout: 5 * time.Second}
+	if !strings.Contains(err.Error(), "indexer") {
+		t.Errorf("Expected the error to name the upstream, got '%s'", err.Error())
+	}
+	if !errors.Is(err, mcp.ErrRequestInterrupted) {
+		t.Error("Expected the timeout error to be a request interrupted error")
+	}
+}
+
+// slowTransport starts once its context is cancelled or release is closed.
+type slowTransport struct {
+	release chan struct{}
+	closed  chan struct{}
+}
+
+func (slow *slowTransport) Start(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-slow.release:
+		return nil
+	}
+}
+
+func (slow *slowTransport) SendRequest(ctx context.Context, request transport.JSONRPCRequest) (*transport.JSONRPCResponse, error) {
+	return nil, errors.New("not connected")
+}
+
+func (slow *slowTransport) SendNotification(ctx context.Context, notification mcp.JSONRPCNotification) error {
+	return nil
+}
+
+func (slow *slowTransport) SetNotificationHandler(handler func(notification mcp.JSONRPCNotification)) {
+}
+
+func (slow *slowTransport) Close() error {
+	close(slow.closed)
+	return nil
+}
+
+func (slow *slowTransport) GetSessionId() string { return "" }
+
+func TestConnectTimeoutCancelsStart(t *testing.T) {
+	slow := &slowTransport{release: make(chan struct{}), closed: make(chan struct{})}
+	client := &Client{Name: "upstream", timeouts: repo.Timeouts{Connect: 10 * time.Millisecond}}
+	client.proxied_client.Store(mcpclient.NewClient(slow))
+	var timeout *TimeoutError
+	if err := client.start(); !errors.As(err, &timeout) {
+		t.Fatalf("Expected a connect timeout, got %v", err)
+	}
+	select {
+	case <-slow.closed:
+		t.Error("Expected a start that failed not to be closed")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestConnectionStartedAfterTheTimeoutIsClosed(t *testing.T) {
+	slow := &slowTransport{release: make(chan struct{}), closed: make(chan struct{})}
+	// the start ignores the cancelled context
+	started := make(chan struct{})
+	client := &Client{Name: "upstream", timeouts: repo.Timeouts{Connect: 10 * time.Millisecond}}
+	client.proxied_client.Store(mcpclient.NewClient(&lateTransport{slowTransport: slow, started: started}))
+	if err := client.start(); err == nil {
+		t.Fatal("Expected a connect timeout")
+	}
+	close(started)
+	select {
+	case <-slow.closed:
+	case <-time.After(time.Second):
+		t.Error("Expected the connection started after the timeout to be closed")
+	}
+}
+
+// lateTransport starts after the connect timeout, whatever the context says.
+type lateTransport struct {
+	*slowTransport
+	started chan struct{}
+}
+
+func (late *lateTransport) Start(ctx context.Context) error {
+	<-late.started
+	return nil
+}
@@ -0,0 +1,57 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/ebamberg/mcp-gate/cache"
+	"github.com/ebamberg/mcp-gate/control"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// cacheCmd represents the cache command
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "manage the response cache",
+	Long:  `manage the cache of tool call results and resource reads of mcp-gate.`,
+}
+
+// cacheClearCmd represents the cache clear command
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "removes all cached responses",
+	Long: `removes all cached responses. A running server empties its in-memory cache and the
+	on-disk cache configured as cache.dir through its control api. Without a running server
+	only the files in cache.dir are removed.
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := controlConn().ClearCache()
+		if err == nil {
+			fmt.Println("Cache of the running server cleared.")
+			return
+		}
+		if !errors.Is(err, control.ErrNoGateway) {
+			log.Fatalf("Error clearing the cache of the running server: %v\n", err)
+		}
+		dir := viper.GetString("cache.dir")
+		if dir == "" {
+			fmt.Println("No running server and no cache directory configured, nothing to clear.")
+			return
+		}
+		if err := cache.ClearDir(dir); err != nil {
+			log.Fatalf("Error clearing cache in %s: %v\n", dir, err)
+		}
+		fmt.Printf("Cache in %s cleared.\n", dir)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheClearCmd)
+	controlFlags(cacheClearCmd)
+}
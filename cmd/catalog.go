@@ -0,0 +1,200 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ebamberg/mcp-gate/repo"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// catalogCmd represents the catalog command
+var catalogCmd = &cobra.Command{
+	Use:   "catalog",
+	Short: "inspect the catalog of mcp-servers",
+	Long: `inspects the catalog mcp-gate installs mcp-servers from. The catalog is read
+	from the sources configured as catalog.sources, the catalog built into mcp-gate by default.
+	`,
+}
+
+// catalogSourcesCmd represents the catalog sources command
+var catalogSourcesCmd = &cobra.Command{
+	Use:   "sources",
+	Short: "lists the catalog sources and what they contribute",
+	Long: `lists the configured catalog sources in order of precedence, the number of entries
+	each of them contributes and the entries replaced by a later source.
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := configureCatalog(); err != nil {
+			log.Fatalf("%v\n", err)
+		}
+		table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, "#\tSOURCE\tENTRIES\tOVERRIDDEN\tERROR")
+		for i, result := range repo.LoadSources() {
+			overridden, failure := "-", ""
+			if len(result.Overridden) > 0 {
+				overridden = strings.Join(result.Overridden, ", ")
+			}
+			var invalid *repo.ValidationError
+			if errors.As(result.Err, &invalid) {
+				failure = countProblems(invalid) + ", see mcp-gate catalog validate"
+			} else if result.Err != nil {
+				failure = result.Err.Error()
+			}
+			fmt.Fprintf(table, "%d\t%s\t%d\t%s\t%s\n", i+1, result.Source.Describe(), len(result.Entries), overridden, failure)
+		}
+		if err := table.Flush(); err != nil {
+			log.Fatalf("Error writing sources: %v\n", err)
+		}
+	},
+}
+
+// catalogValidateCmd represents the catalog validate command
+var catalogValidateCmd = &cobra.Command{
+	Use:   "validate [file...]",
+	Short: "checks catalog files for mistakes",
+	Long: `checks catalog files, or all catalog files of a directory, for unknown or empty fields,
+	entries without what their transport needs, invalid and duplicate names. Every problem is
+	listed with its file and line. Without files the configured catalog sources are checked.
+	example: "mcp-gate catalog validate my-catalog.yaml"
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		type checked struct {
+			name    string
+			entries []repo.RepositoryEntry
+			err     error
+		}
+		var results []checked
+		if len(args) == 0 {
+			if err := configureCatalog(); err != nil {
+				log.Fatalf("%v\n", err)
+			}
+			for _, result := range repo.LoadSources() {
+				results = append(results, checked{result.Source.Describe(), result.Entries, result.Err})
+			}
+		}
+		for _, file := range args {
+			entries, err := repo.ValidateFile(file)
+			results = append(results, checked{file, entries, err})
+		}
+		failed := false
+		for _, result := range results {
+			if result.err != nil {
+				failed = true
+				var invalid *repo.ValidationError
+				if errors.As(result.err, &invalid) {
+					fmt.Printf("%s: %s\n%v\n", result.name, countProblems(invalid), invalid)
+				} else {
+					fmt.Printf("%s: %v\n", result.name, result.err)
+				}
+				continue
+			}
+			fmt.Printf("%s: %d entries, ok\n", result.name, len(result.entries))
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+// catalogSearchCmd represents the catalog search command
+var catalogSearchCmd = &cobra.Command{
+	Use:   "search [query]",
+	Short: "searches the catalog",
+	Long: `lists the catalog entries whose name, description, tags or author contain every word of
+	the query, the best matches first. Without a query every entry is listed.
+	example: "mcp-gate catalog search weather --tag api --platform linux"
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := configureCatalog(); err != nil {
+			log.Fatalf("%v\n", err)
+		}
+		entries, err := repo.ListAvailableTools()
+		if err != nil {
+			log.Fatalf("Error reading the catalog: %v\n", err)
+		}
+		tags, _ := cmd.Flags().GetStringSlice("tag")
+		platform, _ := cmd.Flags().GetString("platform")
+		matches := repo.Search(entries, repo.Query{Text: strings.Join(args, " "), Tags: tags, Platform: platform})
+		if asJSON(cmd) {
+			listings := []repo.Listing{}
+			for _, entry := range matches {
+				listings = append(listings, entry.Listing())
+			}
+			printJSON(listings)
+			return
+		}
+		if len(matches) == 0 {
+			fmt.Println("no matching catalog entries")
+			return
+		}
+		table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, "NAME\tVERSION\tTAGS\tDESCRIPTION")
+		for _, entry := range matches {
+			version := entry.Version
+			if version == "" {
+				version = "-"
+			}
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", entry.Name, version, strings.Join(entry.Tags, ","), shorten(entry.Description, 70))
+		}
+		if err := table.Flush(); err != nil {
+			log.Fatalf("Error writing entries: %v\n", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(catalogCmd)
+	catalogCmd.AddCommand(catalogSourcesCmd, catalogValidateCmd, catalogSearchCmd)
+	catalogSearchCmd.Flags().StringSlice("tag", nil, "only entries with the tag, can be repeated")
+	catalogSearchCmd.Flags().String("platform", "", "only entries that run on the os or os/arch, for example linux or darwin/arm64")
+	catalogSearchCmd.Flags().Bool("json", false, "print the entries as json")
+}
+
+// shorten cuts the first line of a text to at most max characters.
+func shorten(text string, max int) string {
+	text, _, _ = strings.Cut(text, "\n")
+	if runes := []rune(text); len(runes) > max {
+		return string(runes[:max-3]) + "..."
+	}
+	return text
+}
+
+// configureCatalog sets the catalog sources of config.yaml.
+func configureCatalog() error {
+	sources, err := catalogSources(viper.GetViper())
+	if err != nil {
+		return err
+	}
+	repo.SetSources(sources)
+	return nil
+}
+
+// catalogSources creates the catalog sources of config.yaml without using
+// them yet.
+func catalogSources(config *viper.Viper) ([]repo.Source, error) {
+	var configs []repo.SourceConfig
+	if err := config.UnmarshalKey("catalog.sources", &configs); err != nil {
+		return nil, fmt.Errorf("invalid catalog.sources in config: %w", err)
+	}
+	cacheDir := config.GetString("catalog.cache_dir")
+	if cacheDir == "" {
+		cacheDir = "mcp_gate_sources"
+	}
+	return repo.SourcesFromConfig(configs, cacheDir)
+}
+
+func countProblems(invalid *repo.ValidationError) string {
+	if len(invalid.Problems) == 1 {
+		return "1 problem"
+	}
+	return fmt.Sprintf("%d problems", len(invalid.Problems))
+}
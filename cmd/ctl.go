@@ -0,0 +1,218 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/ebamberg/mcp-gate/control"
+	"github.com/ebamberg/mcp-gate/repo"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+)
+
+// ctlCmd represents the ctl command
+var ctlCmd = &cobra.Command{
+	Use:   "ctl",
+	Short: "manage the running gateway",
+	Long: `manages the upstreams of a running mcp-gate server through its control api.
+	The server answers on the unix socket mcp_gate.sock in $XDG_RUNTIME_DIR, set control.socket to change it
+	or --url to reach a control api served over http.
+	`,
+}
+
+// ctlListCmd represents the ctl list command
+var ctlListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "lists the upstreams and their status",
+	Run: func(cmd *cobra.Command, args []string) {
+		statuses, err := controlConn().Status()
+		if err != nil {
+			log.Fatalf("Error listing upstreams: %v\n", err)
+		}
+		if asJSON(cmd) {
+			printJSON(statuses)
+			return
+		}
+		if err := control.WriteStatus(os.Stdout, statuses); err != nil {
+			log.Fatalf("Error writing status: %v\n", err)
+		}
+	},
+}
+
+// ctlInstallCmd represents the ctl install command
+var ctlInstallCmd = &cobra.Command{
+	Use:   "install [name]",
+	Short: "installs an upstream",
+	Long: `installs an upstream of the catalog by its name, or the upstream defined in
+	the yaml file given with --file, and waits until it is connected. Values for the inputs
+	of the upstream are given with --input, the missing ones are asked for on the terminal.
+	example: "mcp-gate ctl install fetch" or "mcp-gate ctl install mcp-hfspace --input work_dir=~/spaces"
+	`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		entry := map[string]any{}
+		if file, _ := cmd.Flags().GetString("file"); file != "" {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				log.Fatalf("Error reading %s: %v\n", file, err)
+			}
+			if err := yaml.Unmarshal(data, &entry); err != nil {
+				log.Fatalf("Error parsing %s: %v\n", file, err)
+			}
+		}
+		if len(args) == 1 {
+			entry["name"] = args[0]
+		}
+		if entry["name"] == nil {
+			log.Fatalln("Name the upstream to install or give its definition with --file")
+		}
+		with := map[string]string{}
+		if values, ok := entry["with"].(map[string]any); ok {
+			for name, value := range values {
+				with[name] = fmt.Sprint(value)
+			}
+		}
+		inputs, _ := cmd.Flags().GetStringArray("input")
+		for _, input := range inputs {
+			name, value, ok := strings.Cut(input, "=")
+			if !ok {
+				log.Fatalf("Invalid --input %s, use name=value\n", input)
+			}
+			with[name] = value
+		}
+		if isTerminal() {
+			if err := configureCatalog(); err != nil {
+				log.Fatalf("%v\n", err)
+			}
+			// the gateway may not know the entry, then it answers with the error
+			if entries, err := repo.EntriesFromConfig([]any{entry}); err == nil {
+				if err := promptInputs(entries[0], with); err != nil {
+					log.Fatalf("%v\n", err)
+				}
+			}
+		}
+		if len(with) > 0 {
+			entry["with"] = with
+		}
+		if _, err := controlConn().Install(entry); err != nil {
+			log.Fatalf("Error installing %v: %v\n", entry["name"], err)
+		}
+		fmt.Printf("Upstream %v installed.\n", entry["name"])
+	},
+}
+
+// ctlRemoveCmd represents the ctl remove command
+var ctlRemoveCmd = &cobra.Command{
+	Use:   "remove name",
+	Short: "stops an upstream and removes its tools",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := controlConn().Remove(args[0]); err != nil {
+			log.Fatalf("Error removing %s: %v\n", args[0], err)
+		}
+		fmt.Printf("Upstream %s removed.\n", args[0])
+	},
+}
+
+// ctlRestartCmd represents the ctl restart command
+var ctlRestartCmd = &cobra.Command{
+	Use:   "restart name",
+	Short: "restarts all replicas of an upstream",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if _, err := controlConn().Restart(args[0]); err != nil {
+			log.Fatalf("Error restarting %s: %v\n", args[0], err)
+		}
+		fmt.Printf("Upstream %s restarted.\n", args[0])
+	},
+}
+
+// ctlReloadCmd represents the ctl reload command
+var ctlReloadCmd = &cobra.Command{
+	Use:   "reload",
+	Short: "makes the server read config.yaml again",
+	Long: `makes the running server read config.yaml again. Upstreams added to the configuration
+	are started, removed ones stopped and changed ones restarted.
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		changes, err := controlConn().Reload()
+		if err != nil {
+			log.Fatalf("Error reloading configuration: %v\n", err)
+		}
+		if asJSON(cmd) {
+			printJSON(changes)
+			return
+		}
+		fmt.Println("Configuration reloaded.")
+		for _, change := range []struct {
+			label string
+			names []string
+		}{{"added", changes.Added}, {"removed", changes.Removed}, {"restarted", changes.Restarted}} {
+			if len(change.names) > 0 {
+				fmt.Printf("%s: %s\n", change.label, strings.Join(change.names, ", "))
+			}
+		}
+	},
+}
+
+// ctlSessionsCmd represents the ctl sessions command
+var ctlSessionsCmd = &cobra.Command{
+	Use:   "sessions",
+	Short: "lists the connected client sessions",
+	Run: func(cmd *cobra.Command, args []string) {
+		sessions, err := controlConn().Sessions()
+		if err != nil {
+			log.Fatalf("Error listing sessions: %v\n", err)
+		}
+		if asJSON(cmd) {
+			printJSON(sessions)
+			return
+		}
+		if err := control.WriteSessions(os.Stdout, sessions); err != nil {
+			log.Fatalf("Error writing sessions: %v\n", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(ctlCmd)
+	ctlCmd.AddCommand(ctlListCmd, ctlInstallCmd, ctlRemoveCmd, ctlRestartCmd, ctlReloadCmd, ctlSessionsCmd)
+	controlFlags(ctlCmd)
+	ctlInstallCmd.Flags().StringP("file", "f", "", "yaml file with the definition of the upstream")
+	ctlInstallCmd.Flags().StringArrayP("input", "i", nil, "value of an input of the upstream as name=value, can be repeated")
+}
+
+// controlFlags adds the flags reaching the control api to a command and its
+// subcommands. They are bound once the command runs, as ctl and tools share
+// the keys.
+func controlFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().String("socket", "", "unix socket of the control api, defaults to control.socket or mcp_gate.sock in $XDG_RUNTIME_DIR")
+	cmd.PersistentFlags().String("url", "", "url of a control api served over http, for example http://127.0.0.1:9465")
+	cmd.PersistentFlags().String("token", "", "token of the control api, defaults to control.token")
+	cmd.PersistentFlags().Bool("json", false, "print the answer of the gateway as json")
+	cmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		viper.BindPFlag("control.socket", cmd.Flags().Lookup("socket"))
+		viper.BindPFlag("control.url", cmd.Flags().Lookup("url"))
+		viper.BindPFlag("control.token", cmd.Flags().Lookup("token"))
+	}
+}
+
+func asJSON(cmd *cobra.Command) bool {
+	value, _ := cmd.Flags().GetBool("json")
+	return value
+}
+
+func printJSON(value any) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(value); err != nil {
+		log.Fatalf("Error writing json: %v\n", err)
+	}
+}
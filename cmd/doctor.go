@@ -0,0 +1,90 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/ebamberg/mcp-gate/repo"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// doctorCmd represents the doctor command
+var doctorCmd = &cobra.Command{
+	Use:   "doctor [name...]",
+	Short: "checks that the mcp-servers can run on this machine",
+	Long: `checks for every mcp-server of the configuration that it supports this platform and that
+	the programs it needs are installed in the required versions. Name mcp-servers of the
+	configuration or the catalog to only check them.
+	example: "mcp-gate doctor" or "mcp-gate doctor mcp-hfspace"
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := configureCatalog(); err != nil {
+			log.Fatalf("%v\n", err)
+		}
+		entries, err := repo.EntriesFromConfig(viper.Get("upstreams"))
+		if err != nil {
+			log.Fatalf("Error reading upstreams: %v\n", err)
+		}
+		if len(args) > 0 {
+			entries, err = selectEntries(entries, args)
+			if err != nil {
+				log.Fatalf("%v\n", err)
+			}
+		}
+		fmt.Printf("mcp-gate runs on %s\n", repo.Platform())
+		if len(entries) == 0 {
+			fmt.Println("no mcp-servers configured")
+			return
+		}
+		failed := false
+		for _, entry := range entries {
+			var missing *repo.RequirementsError
+			if err := repo.CheckRequirements(entry); errors.As(err, &missing) {
+				failed = true
+				fmt.Printf("%s: cannot run here\n", entry.Name)
+				for _, problem := range missing.Problems {
+					fmt.Printf("  - %s\n", problem)
+				}
+				continue
+			}
+			fmt.Printf("%s: ok\n", entry.Name)
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+}
+
+// selectEntries returns the named upstreams of the configuration, or the
+// catalog entries of that name.
+func selectEntries(configured []repo.RepositoryEntry, names []string) ([]repo.RepositoryEntry, error) {
+	var selected []repo.RepositoryEntry
+	for _, name := range names {
+		found := false
+		for _, entry := range configured {
+			if entry.Name == name {
+				selected, found = append(selected, entry), true
+				break
+			}
+		}
+		if found {
+			continue
+		}
+		entries, err := repo.EntriesFromConfig([]any{map[string]any{"name": name}})
+		if err != nil {
+			return nil, err
+		}
+		selected = append(selected, entries...)
+	}
+	return selected, nil
+}
@@ -0,0 +1,164 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/ebamberg/mcp-gate/repo"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// fetchCmd represents the fetch command
+var fetchCmd = &cobra.Command{
+	Use:   "fetch [name...]",
+	Short: "fetches the packages of the mcp-servers into the package store",
+	Long: `downloads the npm and pypi packages the mcp-servers of the configuration run into
+	packages.cache_dir, verifies them and locks the fetched versions, so starting the gateway
+	needs no download. Name mcp-servers of the configuration or the catalog to only fetch theirs.
+	example: "mcp-gate fetch" or "mcp-gate fetch mcp-hfspace"
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		failed := false
+		for _, entry := range packageEntries(args) {
+			locked, err := repo.Packages().Fetch(*entry.Package)
+			if err != nil {
+				failed = true
+				fmt.Printf("%s: %v\n", entry.Name, err)
+				continue
+			}
+			fmt.Printf("%s: %s %s\n", entry.Name, entry.Package.Name, locked.Version)
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+// outdatedCmd represents the outdated command
+var outdatedCmd = &cobra.Command{
+	Use:   "outdated [name...]",
+	Short: "lists the mcp-servers whose package has a newer version",
+	Long: `compares the locked version of the package of every mcp-server of the configuration with
+	the latest version in its registry. Only the packages themselves are locked, their dependencies
+	are resolved by npx or uvx when the mcp-server starts.
+	example: "mcp-gate outdated"
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		table := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, "NAME\tPACKAGE\tCURRENT\tLATEST")
+		for _, entry := range packageEntries(args) {
+			current := entry.Package.Version
+			locked, ok, err := repo.Packages().Locked(*entry.Package)
+			if err != nil {
+				log.Fatalf("%v\n", err)
+			}
+			if ok {
+				current = locked.Version
+			}
+			latest := "-"
+			if release, err := repo.Packages().Release(*entry.Package, ""); err != nil {
+				log.Printf("%s: %v", entry.Name, err)
+			} else {
+				latest = release.Version
+			}
+			if current == latest {
+				continue
+			}
+			if current == "" {
+				current = "not fetched"
+			}
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", entry.Name, entry.Package.Name, current, latest)
+		}
+		if err := table.Flush(); err != nil {
+			log.Fatalf("Error writing packages: %v\n", err)
+		}
+		fmt.Fprintln(os.Stderr, "Only the packages are locked, their dependencies are resolved by npx or uvx when the mcp-server starts.")
+	},
+}
+
+// upgradeCmd represents the upgrade command
+var upgradeCmd = &cobra.Command{
+	Use:   "upgrade [name...]",
+	Short: "locks the latest version of the packages of the mcp-servers",
+	Long: `fetches the latest version of the package of every mcp-server of the configuration, or
+	the named ones, and locks it. The mcp-servers run the new version once they are restarted.
+	The lock holds until the catalog pins another version.
+	example: "mcp-gate upgrade mcp-hfspace" and "mcp-gate ctl restart mcp-hfspace"
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		failed := false
+		for _, entry := range packageEntries(args) {
+			previous, _, _ := repo.Packages().Locked(*entry.Package)
+			locked, err := repo.Packages().Upgrade(*entry.Package)
+			if err != nil {
+				failed = true
+				fmt.Printf("%s: %v\n", entry.Name, err)
+				continue
+			}
+			if previous.Version == locked.Version {
+				fmt.Printf("%s: %s is up to date\n", entry.Name, locked.Version)
+				continue
+			}
+			fmt.Printf("%s: %s -> %s\n", entry.Name, previous.Version, locked.Version)
+		}
+		if failed {
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(fetchCmd, outdatedCmd, upgradeCmd)
+}
+
+// configurePackages sets up the store the packages of the mcp-servers are
+// fetched into.
+func configurePackages() {
+	repo.SetPackageStore(packageStore(viper.GetViper()))
+}
+
+// packageStore creates the package store of config.yaml without using it yet.
+func packageStore(config *viper.Viper) *repo.PackageStore {
+	store := &repo.PackageStore{
+		Dir:         config.GetString("packages.cache_dir"),
+		NPMRegistry: config.GetString("packages.npm_registry"),
+		PyPIIndex:   config.GetString("packages.pypi_index"),
+	}
+	if store.Dir == "" {
+		store.Dir = "mcp_gate_packages"
+	}
+	return store
+}
+
+// packageEntries returns the upstreams of the configuration, or the named
+// ones, that run a package.
+func packageEntries(names []string) []repo.RepositoryEntry {
+	if err := configureCatalog(); err != nil {
+		log.Fatalf("%v\n", err)
+	}
+	configurePackages()
+	entries, err := repo.EntriesFromConfig(viper.Get("upstreams"))
+	if err != nil {
+		log.Fatalf("Error reading upstreams: %v\n", err)
+	}
+	if len(names) > 0 {
+		if entries, err = selectEntries(entries, names); err != nil {
+			log.Fatalf("%v\n", err)
+		}
+	}
+	var packaged []repo.RepositoryEntry
+	for _, entry := range entries {
+		if entry.Package != nil {
+			packaged = append(packaged, entry)
+		} else if len(names) > 0 {
+			fmt.Printf("%s: runs no package\n", entry.Name)
+		}
+	}
+	return packaged
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/ebamberg/mcp-gate/repo"
+)
+
+// isTerminal reports whether stdin is a terminal someone can answer prompts on.
+func isTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// promptInputs asks on the terminal for every input of the entry that has no
+// value in with yet. An empty answer keeps the default.
+func promptInputs(entry repo.RepositoryEntry, with map[string]string) error {
+	reader := bufio.NewReader(os.Stdin)
+	for _, input := range entry.Inputs {
+		if _, ok := with[input.Name]; ok {
+			continue
+		}
+		label := input.Name
+		if input.Description != "" {
+			label += " - " + input.Description
+		}
+		if len(input.Options) > 0 {
+			label += " [" + strings.Join(input.Options, "|") + "]"
+		}
+		if input.Default != "" {
+			label += " (default " + input.Default + ")"
+		}
+		for {
+			fmt.Fprintf(os.Stderr, "%s: ", label)
+			value, err := readLine(reader, input.Type == repo.INPUT_SECRET)
+			if err != nil {
+				return fmt.Errorf("reading %s: %w", input.Name, err)
+			}
+			if value == "" && input.Required() {
+				fmt.Fprintf(os.Stderr, "%s is required\n", input.Name)
+				continue
+			}
+			if err := input.Check(value); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				continue
+			}
+			if value != "" {
+				with[input.Name] = value
+			}
+			break
+		}
+	}
+	return nil
+}
+
+// readLine reads an answer, without echoing it for secrets. Hiding the input
+// relies on stty, on systems without it the secret stays visible.
+func readLine(reader *bufio.Reader, secret bool) (string, error) {
+	if secret && stty("-echo") == nil {
+		defer func() {
+			stty("echo")
+			fmt.Fprintln(os.Stderr)
+		}()
+	}
+	line, err := reader.ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimSpace(line), nil
+}
+
+func stty(setting string) error {
+	command := exec.Command("stty", setting)
+	command.Stdin = os.Stdin
+	return command.Run()
+}
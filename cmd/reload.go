@@ -0,0 +1,205 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/ebamberg/mcp-gate/client"
+	"github.com/ebamberg/mcp-gate/ratelimit"
+	"github.com/ebamberg/mcp-gate/repo"
+	"github.com/fsnotify/fsnotify"
+	mcpserver "github.com/mark3labs/mcp-go/server"
+	"github.com/spf13/viper"
+)
+
+// builtinTimeouts and builtinHealthCheck are what config.yaml overrides.
+var (
+	builtinTimeouts    = client.DefaultTimeouts
+	builtinHealthCheck = client.DefaultHealthCheck
+)
+
+// reloadDelay is how long the configuration has to stay unchanged before it
+// is reloaded.
+const reloadDelay = 500 * time.Millisecond
+
+// reloadMu makes concurrent reloads wait for each other.
+var reloadMu sync.Mutex
+
+// policies are the gateway wide timeouts, health checks and rate limits of
+// config.yaml.
+type policies struct {
+	timeouts    repo.Timeouts
+	healthCheck repo.HealthCheck
+	rateLimits  ratelimit.Config
+}
+
+// readPolicies reads the policies of the configuration without applying them.
+// The timeouts are decoded from the raw config.yaml.
+func readPolicies(config *viper.Viper, data []byte) (policies, error) {
+	read := policies{timeouts: builtinTimeouts, healthCheck: builtinHealthCheck}
+	var err error
+	if read.timeouts, err = repo.ConfigTimeouts(data, builtinTimeouts); err != nil {
+		return policies{}, fmt.Errorf("invalid timeouts in config: %w", err)
+	}
+	if err := config.UnmarshalKey("health_check", &read.healthCheck); err != nil {
+		return policies{}, fmt.Errorf("invalid health_check in config: %w", err)
+	}
+	if err := config.UnmarshalKey("ratelimits", &read.rateLimits); err != nil {
+		return policies{}, fmt.Errorf("invalid ratelimits in config: %w", err)
+	}
+	return read, nil
+}
+
+// apply makes the gateway use the policies. The rate limiter has to exist.
+func (p policies) apply() {
+	client.RateLimiter.SetRules(p.rateLimits.Rules)
+	client.SetDefaults(p.timeouts, p.healthCheck)
+}
+
+// applyPolicies applies the gateway wide timeouts, health checks and rate
+// limits of config.yaml at start and loads the quotas.
+func applyPolicies() error {
+	data, err := configData()
+	if err != nil {
+		return err
+	}
+	read, err := readPolicies(viper.GetViper(), data)
+	if err != nil {
+		return err
+	}
+	rateLimits := read.rateLimits
+	if rateLimits.QuotaFile == "" {
+		rateLimits.QuotaFile = "mcp_gate_quota.json"
+	}
+	limiter, err := ratelimit.NewLimiter(rateLimits)
+	if err != nil {
+		return fmt.Errorf("unable to load quotas: %w", err)
+	}
+	client.RateLimiter = limiter
+	read.apply()
+	return nil
+}
+
+// configFile is config.yaml as the gateway found it at start.
+func configFile() string {
+	if file := viper.ConfigFileUsed(); file != "" {
+		return file
+	}
+	return "config.yaml"
+}
+
+// configData returns the content of config.yaml, nothing if there is none.
+func configData() ([]byte, error) {
+	data, err := os.ReadFile(configFile())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("unable to read config: %w", err)
+	}
+	return data, nil
+}
+
+// readConfig reads config.yaml into a viper of its own, set up like the one
+// of the gateway, so the configuration in use stays untouched until the new
+// one is found valid.
+func readConfig() (*viper.Viper, []byte, error) {
+	data, err := os.ReadFile(configFile())
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read config: %w", err)
+	}
+	config := viper.New()
+	config.SetConfigType("yaml")
+	config.AutomaticEnv()
+	config.SetEnvPrefix("env")
+	config.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	if err := config.ReadConfig(bytes.NewReader(data)); err != nil {
+		return nil, nil, fmt.Errorf("unable to read config: %w", err)
+	}
+	return config, data, nil
+}
+
+// reloadConfig reads config.yaml again, applies its catalog sources and
+// policies and starts, stops and restarts upstreams to match it. An invalid
+// configuration is rejected as a whole and the gateway keeps running with the
+// previous one: everything is read and validated before any of it is used.
+func reloadConfig(serv *mcpserver.MCPServer) (client.Changes, error) {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	config, data, err := readConfig()
+	if err != nil {
+		return client.Changes{}, err
+	}
+	sources, err := catalogSources(config)
+	if err != nil {
+		return client.Changes{}, err
+	}
+	upstreams, err := repo.EntriesFromSources(config.Get("upstreams"), sources)
+	if err != nil {
+		return client.Changes{}, fmt.Errorf("invalid upstreams in config: %w", err)
+	}
+	read, err := readPolicies(config, data)
+	if err != nil {
+		return client.Changes{}, err
+	}
+
+	// only now the configuration in use is replaced, by the content checked above
+	if err := viper.ReadConfig(bytes.NewReader(data)); err != nil {
+		return client.Changes{}, fmt.Errorf("unable to read config: %w", err)
+	}
+	repo.SetSources(sources)
+	repo.SetPackageStore(packageStore(config))
+	read.apply()
+	changes := client.Reconcile(serv, upstreams)
+	log.Printf("configuration reloaded, added %v, removed %v, restarted %v", changes.Added, changes.Removed, changes.Restarted)
+	return changes, nil
+}
+
+func reloadConfigLogged(serv *mcpserver.MCPServer) {
+	if _, err := reloadConfig(serv); err != nil {
+		log.Printf("configuration not reloaded: %v", err)
+	}
+}
+
+// watchConfig reloads the configuration when config.yaml changes, unless
+// reload.watch is false, and when the process receives SIGHUP.
+func watchConfig(serv *mcpserver.MCPServer) {
+	if viper.GetBool("reload.watch") && viper.ConfigFileUsed() != "" {
+		// the watcher reads the changed file into a viper of its own
+		watcher := viper.New()
+		watcher.SetConfigFile(viper.ConfigFileUsed())
+		var pending *time.Timer
+		watcher.OnConfigChange(func(event fsnotify.Event) {
+			// editors write a file in several steps, reload once they are done
+			if pending != nil {
+				pending.Stop()
+			}
+			pending = time.AfterFunc(reloadDelay, func() {
+				log.Printf("%s changed", event.Name)
+				reloadConfigLogged(serv)
+			})
+		})
+		watcher.WatchConfig()
+	}
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			log.Println("SIGHUP received")
+			reloadConfigLogged(serv)
+		}
+	}()
+}
+
+func init() {
+	viper.SetDefault("reload.watch", true)
+}
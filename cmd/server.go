@@ -4,12 +4,24 @@ Copyright © 2025 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"context"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/ebamberg/mcp-gate/cache"
+	"github.com/ebamberg/mcp-gate/client"
+	"github.com/ebamberg/mcp-gate/control"
 	"github.com/ebamberg/mcp-gate/mcptools"
+	"github.com/ebamberg/mcp-gate/metrics"
+	"github.com/ebamberg/mcp-gate/repo"
+	"github.com/ebamberg/mcp-gate/sandbox"
 	"github.com/ebamberg/mcp-gate/server"
+	"github.com/ebamberg/mcp-gate/tracing"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 )
 
 // serverCmd represents the server command
@@ -19,40 +31,143 @@ var serverCmd = &cobra.Command{
 	Long:  `start the MCP Gate proxy as a server and allows Client to connect.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		redirectToStderr, _ := cmd.Flags().GetBool("redirect-to-stderr")
+		var logFile *os.File
 		if redirectToStderr {
 			redirectLoggingToStdErr()
 		} else {
-			redirectLoggingToFile()
+			logFile = redirectLoggingToFile()
 		}
 		withAdminTools, _ := cmd.Flags().GetBool("with-admin-tools")
 
+		if err := applyPolicies(); err != nil {
+			log.Fatalf("%v", err)
+		}
+		var cacheConfig cache.Config
+		if err := viper.UnmarshalKey("cache", &cacheConfig); err != nil {
+			log.Printf("invalid cache in config: %v", err)
+		} else if cacheConfig.Enabled {
+			responseCache, err := cache.New(cacheConfig)
+			if err != nil {
+				log.Fatalf("unable to create cache: %v", err)
+			}
+			client.ResponseCache = responseCache
+		}
+		if !viper.GetBool("catalog_cache.disabled") {
+			client.CatalogDir = viper.GetString("catalog_cache.dir")
+			if client.CatalogDir == "" {
+				client.CatalogDir = "mcp_gate_catalog"
+			}
+		}
+		shutdownTracing := func(context.Context) error { return nil }
+		var tracingConfig tracing.Config
+		if err := viper.UnmarshalKey("tracing", &tracingConfig); err != nil {
+			log.Printf("invalid tracing in config: %v", err)
+		} else if tracingConfig.Enabled {
+			shutdown, err := tracing.Setup(tracingConfig)
+			if err != nil {
+				log.Printf("tracing not available: %v", err)
+			} else {
+				shutdownTracing = shutdown
+			}
+		}
+		if err := configureCatalog(); err != nil {
+			log.Fatalf("%v", err)
+		}
+		configurePackages()
+		if root := viper.GetString("sandbox.cgroup_root"); root != "" {
+			sandbox.CgroupRoot = root
+		}
+		upstreams, err := repo.EntriesFromConfig(viper.Get("upstreams"))
+		if err != nil {
+			log.Fatalf("invalid upstreams in config: %v", err)
+		}
+
 		log.Println("Start MCP Gate server")
 		serv := server.NewServer()
 		if withAdminTools {
 			log.Println("Adding MCP Gate admin tools")
 			mcptools.RegisterAdminTool(serv)
 		}
-		server.StartServer(serv)
+		client.Reconcile(serv, upstreams)
+		watchConfig(serv)
+		api := &control.API{
+			Server: serv,
+			Token:  viper.GetString("control.token"),
+			Reload: func() (client.Changes, error) { return reloadConfig(serv) },
+		}
+		go func() {
+			if err := api.Serve(controlSocket()); err != nil {
+				log.Printf("control socket not available: %v", err)
+			}
+		}()
+		if address := viper.GetString("control.listen"); address != "" {
+			go func() {
+				if err := api.ListenAndServe(address); err != nil {
+					log.Printf("control api not available: %v", err)
+				}
+			}()
+		}
+		if address := viper.GetString("metrics.listen"); address != "" {
+			go func() {
+				if err := metrics.Serve(address); err != nil {
+					log.Printf("metrics endpoint not available: %v", err)
+				}
+			}()
+		}
+		if timeout := viper.GetDuration("shutdown.stop_timeout"); timeout > 0 {
+			client.StopTimeout = timeout
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-ctx.Done()
+			// a second signal ends the process right away
+			stop()
+		}()
 		log.Println("MCP Gate server started")
+		err = server.StartServer(ctx, serv, viper.GetDuration("shutdown.timeout"))
+		if err != nil {
+			log.Printf("Server error: %v", err)
+		}
+
+		client.Shutdown()
+		if err := client.RateLimiter.Close(); err != nil {
+			log.Printf("unable to save quotas: %v", err)
+		}
+		api.Close()
+		if err := shutdownTracing(context.Background()); err != nil {
+			log.Printf("unable to flush spans: %v", err)
+		}
+		log.Println("MCP Gate server stopped")
+		if logFile != nil {
+			logFile.Sync()
+			logFile.Close()
+		}
+		if err != nil {
+			os.Exit(1)
+		}
 	},
 }
 
 func init() {
+	viper.SetDefault("shutdown.timeout", 10*time.Second)
 	rootCmd.AddCommand(serverCmd)
 	serverCmd.PersistentFlags().BoolP("redirect-to-stderr", "", false, "whether to redirect alll log output to stderr. This is useful when the tool runs locally in Claude Desktop to redirct logging to the client log folder.")
 	serverCmd.PersistentFlags().BoolP("with-admin-tools", "", false, "add the mcg-gate admin tools which allows administration of mcp-gate out of you LLM client.")
 }
 
-func redirectLoggingToFile() {
+// redirectLoggingToFile returns the log file, which is closed when the server
+// stops.
+func redirectLoggingToFile() *os.File {
 	// Redirect log output to a file
 
 	f, err := os.OpenFile("mcp_gate.log", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
 	if err != nil {
 		log.Fatalf("error opening file: %v", err)
 	}
-	defer f.Close()
 
 	log.SetOutput(f)
+	return f
 }
 
 func redirectLoggingToStdErr() {
@@ -0,0 +1,58 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"log"
+	"os"
+
+	"github.com/ebamberg/mcp-gate/control"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// statusCmd represents the status command
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "show the status of all upstreams",
+	Long: `asks the running mcp-gate server for the state of every installed mcp-server:
+	state, health, pid, uptime, restarts, number of tools, ping latency and last error.
+	`,
+	Run: func(cmd *cobra.Command, args []string) {
+		statuses, err := controlConn().Status()
+		if err != nil {
+			log.Fatalf("Error reading status: %v\n", err)
+		}
+		if asJSON(cmd) {
+			printJSON(statuses)
+			return
+		}
+		if err := control.WriteStatus(os.Stdout, statuses); err != nil {
+			log.Fatalf("Error writing status: %v\n", err)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(statusCmd)
+	controlFlags(statusCmd)
+}
+
+// controlSocket is the unix socket the server answers the command line on.
+func controlSocket() string {
+	if socket := viper.GetString("control.socket"); socket != "" {
+		return socket
+	}
+	return control.DefaultSocket()
+}
+
+// controlConn connects to the control api of the running server, over http
+// if control.url is set and over the unix socket otherwise.
+func controlConn() *control.Conn {
+	token := viper.GetString("control.token")
+	if address := viper.GetString("control.url"); address != "" {
+		return control.DialHTTP(address, token)
+	}
+	return control.Dial(controlSocket(), token)
+}
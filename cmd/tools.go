@@ -0,0 +1,90 @@
+/*
+Copyright © 2025 NAME HERE <EMAIL ADDRESS>
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/ebamberg/mcp-gate/control"
+	"github.com/spf13/cobra"
+)
+
+// toolsCmd represents the tools command
+var toolsCmd = &cobra.Command{
+	Use:   "tools",
+	Short: "manage the installed mcp-servers",
+	Long: `lists, uninstalls, disables and enables the mcp-servers installed in the running gateway.
+	A disabled mcp-server keeps its configuration, but its process is stopped and its tools are
+	hidden until it is enabled again.
+	`,
+}
+
+// toolsListCmd represents the tools list command
+var toolsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "lists the installed mcp-servers and their tools",
+	Run: func(cmd *cobra.Command, args []string) {
+		installed, err := controlConn().Installed()
+		if err != nil {
+			log.Fatalf("Error listing installed tools: %v\n", err)
+		}
+		if asJSON(cmd) {
+			printJSON(installed)
+			return
+		}
+		if err := control.WriteInstalled(os.Stdout, installed); err != nil {
+			log.Fatalf("Error writing installed tools: %v\n", err)
+		}
+	},
+}
+
+// toolsUninstallCmd represents the tools uninstall command
+var toolsUninstallCmd = &cobra.Command{
+	Use:   "uninstall name",
+	Short: "stops an mcp-server and removes it with its tools",
+	Long: `stops an mcp-server and removes it with its tools from the running gateway.
+	An mcp-server of config.yaml is started again on the next reload unless it is removed there too.
+	`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := controlConn().Remove(args[0]); err != nil {
+			log.Fatalf("Error uninstalling %s: %v\n", args[0], err)
+		}
+		fmt.Printf("Tool %s uninstalled.\n", args[0])
+	},
+}
+
+// toolsDisableCmd represents the tools disable command
+var toolsDisableCmd = &cobra.Command{
+	Use:   "disable name",
+	Short: "stops an mcp-server and hides its tools until it is enabled",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if _, err := controlConn().Disable(args[0]); err != nil {
+			log.Fatalf("Error disabling %s: %v\n", args[0], err)
+		}
+		fmt.Printf("Tool %s disabled.\n", args[0])
+	},
+}
+
+// toolsEnableCmd represents the tools enable command
+var toolsEnableCmd = &cobra.Command{
+	Use:   "enable name",
+	Short: "starts a disabled mcp-server again",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if _, err := controlConn().Enable(args[0]); err != nil {
+			log.Fatalf("Error enabling %s: %v\n", args[0], err)
+		}
+		fmt.Printf("Tool %s enabled.\n", args[0])
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(toolsCmd)
+	toolsCmd.AddCommand(toolsListCmd, toolsUninstallCmd, toolsDisableCmd, toolsEnableCmd)
+	controlFlags(toolsCmd)
+}
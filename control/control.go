@@ -0,0 +1,371 @@
+package control
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ebamberg/mcp-gate/client"
+	"github.com/ebamberg/mcp-gate/metrics"
+	"github.com/ebamberg/mcp-gate/repo"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// DefaultSocket is the unix socket a running gateway answers the mcp-gate
+// command line on: mcp_gate.sock in $XDG_RUNTIME_DIR, or in the mcp-gate
+// directory of the user configuration without it.
+func DefaultSocket() string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		config, err := os.UserConfigDir()
+		if err != nil {
+			return "mcp_gate.sock"
+		}
+		dir = filepath.Join(config, "mcp-gate")
+	}
+	return filepath.Join(dir, "mcp_gate.sock")
+}
+
+// installTimeout bounds how long an install request waits for the upstream
+// to connect.
+const installTimeout = 2 * time.Minute
+
+// API is the control plane of a running gateway. It lets the command line and
+// scripts manage the upstreams without going through an LLM client.
+type API struct {
+	Server *server.MCPServer
+	Token  string                         // bearer token every request has to send, empty for none
+	Reload func() (client.Changes, error) // reloads the configuration, nil if not supported
+
+	mu       sync.Mutex
+	listener net.Listener // of the socket being served
+	socket   string
+}
+
+// errorResponse is the body of every failed request.
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Handler returns the http handler of the API.
+func (api *API) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", api.handleStatus)
+	mux.HandleFunc("GET /upstreams", api.handleStatus)
+	mux.HandleFunc("POST /upstreams", api.handleInstall)
+	mux.HandleFunc("DELETE /upstreams/{name}", api.handleRemove)
+	mux.HandleFunc("POST /upstreams/{name}/restart", api.handleRestart)
+	mux.HandleFunc("POST /upstreams/{name}/disable", api.handleDisable)
+	mux.HandleFunc("POST /upstreams/{name}/enable", api.handleEnable)
+	mux.HandleFunc("GET /installed", api.handleInstalled)
+	mux.HandleFunc("POST /reload", api.handleReload)
+	mux.HandleFunc("GET /sessions", api.handleSessions)
+	mux.HandleFunc("DELETE /cache", api.handleClearCache)
+	mux.Handle("GET /metrics", metrics.Handler())
+	return api.authenticate(mux)
+}
+
+func (api *API) authenticate(next http.Handler) http.Handler {
+	if api.Token == "" {
+		return next
+	}
+	expected := []byte("Bearer " + api.Token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			writeError(w, http.StatusUnauthorized, errors.New("missing or wrong control token"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Serve answers requests on a unix socket only the current user can connect
+// to. A socket left behind by a gateway that is gone is replaced, the one of a
+// running gateway is not. It only returns on error or when the API is closed.
+func (api *API) Serve(socket string) error {
+	if conn, err := net.DialTimeout("unix", socket, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("another gateway answers on %s", socket)
+	}
+	if err := os.Remove(socket); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(socket), 0700); err != nil {
+		return err
+	}
+	listener, err := listenPrivate(socket)
+	if err != nil {
+		return err
+	}
+	api.mu.Lock()
+	api.listener, api.socket = listener, socket
+	api.mu.Unlock()
+	err = http.Serve(ownerListener{listener}, api.Handler())
+	if errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+// Close stops answering on the socket and removes it, if Serve created one.
+func (api *API) Close() error {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	if api.listener == nil {
+		return nil
+	}
+	err := api.listener.Close()
+	os.Remove(api.socket)
+	api.listener = nil
+	return err
+}
+
+// ownerListener only accepts connections of processes of the user running
+// the gateway, where the system tells who is connecting.
+type ownerListener struct {
+	net.Listener
+}
+
+func (listener ownerListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := listener.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if err := checkOwner(conn); err != nil {
+			log.Printf("control socket: %v", err)
+			conn.Close()
+			continue
+		}
+		return conn, nil
+	}
+}
+
+// listenPrivate creates the socket in a directory only the current user can
+// enter and moves it into place once its mode is 0600, so nobody else can
+// connect in between.
+func listenPrivate(socket string) (net.Listener, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(socket), ".mcp_gate_sock")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	created := filepath.Join(dir, filepath.Base(socket))
+	listener, err := net.Listen("unix", created)
+	if err != nil {
+		return nil, err
+	}
+	// the socket is moved, closing the listener must not remove the path it was created at
+	listener.(*net.UnixListener).SetUnlinkOnClose(false)
+	if err := os.Chmod(created, 0600); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	if err := os.Rename(created, socket); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// ListenAndServe answers requests over tcp. As anybody who can reach the
+// address could manage the gateway, a token is required.
+func (api *API) ListenAndServe(address string) error {
+	if api.Token == "" {
+		return errors.New("control.token has to be set to serve the control api over http")
+	}
+	return http.ListenAndServe(address, api.Handler())
+}
+
+func (api *API) handleStatus(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, client.Statuses())
+}
+
+func (api *API) handleSessions(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, client.Sessions())
+}
+
+// handleInstall starts the upstream in the body, an entry of the catalog is
+// installed by its name alone.
+func (api *API) handleInstall(w http.ResponseWriter, r *http.Request) {
+	var raw map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid upstream: %w", err))
+		return
+	}
+	entries, err := repo.EntriesFromConfig([]any{raw})
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	entry := entries[0]
+	if entry.Name == "" {
+		writeError(w, http.StatusBadRequest, errors.New("upstream has no name"))
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), installTimeout)
+	defer cancel()
+	if err := client.Install(ctx, api.Server, entry); err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, client.Statuses())
+}
+
+func (api *API) handleRemove(w http.ResponseWriter, r *http.Request) {
+	if err := client.Uninstall(r.PathValue("name")); err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (api *API) handleRestart(w http.ResponseWriter, r *http.Request) {
+	if err := client.RestartUpstream(r.PathValue("name")); err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, client.Statuses())
+}
+
+func (api *API) handleDisable(w http.ResponseWriter, r *http.Request) {
+	if err := client.Disable(r.PathValue("name")); err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, client.Installed())
+}
+
+func (api *API) handleEnable(w http.ResponseWriter, r *http.Request) {
+	if err := client.Enable(r.PathValue("name")); err != nil {
+		writeError(w, statusOf(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, client.Installed())
+}
+
+func (api *API) handleInstalled(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, client.Installed())
+}
+
+func (api *API) handleClearCache(w http.ResponseWriter, r *http.Request) {
+	if err := client.ResponseCache.Clear(); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (api *API) handleReload(w http.ResponseWriter, r *http.Request) {
+	if api.Reload == nil {
+		writeError(w, http.StatusNotImplemented, errors.New("the gateway cannot reload its configuration"))
+		return
+	}
+	changes, err := api.Reload()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, changes)
+}
+
+func statusOf(err error) int {
+	var missing *repo.MissingInputsError
+	switch {
+	case errors.As(err, &missing):
+		return http.StatusBadRequest
+	case errors.Is(err, client.ErrUnknownUpstream):
+		return http.StatusNotFound
+	case errors.Is(err, client.ErrAlreadyInstalled), errors.Is(err, client.ErrDisabled), errors.Is(err, client.ErrConfigured):
+		return http.StatusConflict
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
+
+// WriteStatus prints the status of the upstreams as a table.
+func WriteStatus(w io.Writer, statuses []client.UpstreamStatus) error {
+	if len(statuses) == 0 {
+		_, err := fmt.Fprintln(w, "no upstreams installed")
+		return err
+	}
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "NAME\tSTATE\tHEALTHY\tPID\tUPTIME\tRESTARTS\tTOOLS\tLATENCY\tLAST ERROR")
+	for _, status := range statuses {
+		name := status.Name
+		if status.Replica > 0 {
+			name = fmt.Sprintf("%s#%d", status.Name, status.Replica)
+		}
+		pid := "-"
+		if status.PID > 0 {
+			pid = fmt.Sprint(status.PID)
+		}
+		fmt.Fprintf(table, "%s\t%s\t%v\t%s\t%s\t%d\t%d\t%s\t%s\n",
+			name, status.State, status.Healthy, pid, status.Uptime, status.Restarts, status.Tools,
+			status.Latency.Round(time.Microsecond), status.LastError)
+	}
+	return table.Flush()
+}
+
+// WriteInstalled prints the installed upstreams and their tools as a table.
+func WriteInstalled(w io.Writer, installed []client.InstalledUpstream) error {
+	if len(installed) == 0 {
+		_, err := fmt.Fprintln(w, "no upstreams installed")
+		return err
+	}
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "NAME\tTRANSPORT\tSTATE\tFROM\tTOOLS")
+	for _, upstream := range installed {
+		from := "runtime"
+		if upstream.Configured {
+			from = "config"
+		}
+		tools := strings.Join(upstream.Tools, ", ")
+		if tools == "" {
+			tools = "-"
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%s\t%s\n", upstream.Name, upstream.Transport, upstream.State, from, tools)
+	}
+	return table.Flush()
+}
+
+// WriteSessions prints the client sessions as a table.
+func WriteSessions(w io.Writer, sessions []client.SessionInfo) error {
+	if len(sessions) == 0 {
+		_, err := fmt.Fprintln(w, "no client connected")
+		return err
+	}
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "ID\tCLIENT\tCONNECTED\tIN FLIGHT")
+	for _, session := range sessions {
+		name := strings.TrimSpace(session.Client + " " + session.ClientVersion)
+		if name == "" {
+			name = "-"
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\t%d\n",
+			session.ID, name, time.Since(session.Connected).Round(time.Second), session.InFlight)
+	}
+	return table.Flush()
+}
@@ -0,0 +1,193 @@
+package control
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ebamberg/mcp-gate/cache"
+	"github.com/ebamberg/mcp-gate/client"
+)
+
+func TestStatusOverSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "mcp_gate.sock")
+	go (&API{}).Serve(socket)
+
+	var err error
+	for i := 0; i < 50; i++ {
+		if _, err = Dial(socket, "").Status(); err == nil {
+			if info, err := os.Stat(socket); err != nil || info.Mode().Perm() != 0600 {
+				t.Errorf("Expected the socket to be private, got %v, %v", info.Mode(), err)
+			}
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Failed to read status from the socket: %v", err)
+}
+
+func TestServeKeepsTheSocketOfARunningGateway(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "mcp_gate.sock")
+	running := &API{}
+	go running.Serve(socket)
+	for i := 0; i < 50; i++ {
+		if _, err := Dial(socket, "").Status(); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := (&API{}).Serve(socket); err == nil || !strings.Contains(err.Error(), "another gateway") {
+		t.Errorf("Expected the socket of the running gateway to be kept, got %v", err)
+	}
+	if _, err := Dial(socket, "").Status(); err != nil {
+		t.Errorf("Expected the running gateway to still answer, got %v", err)
+	}
+	if err := running.Close(); err != nil {
+		t.Errorf("Failed to close the api: %v", err)
+	}
+	if _, err := os.Stat(socket); !os.IsNotExist(err) {
+		t.Errorf("Expected the socket to be removed on close, got %v", err)
+	}
+}
+
+func TestDefaultSocket(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_RUNTIME_DIR", dir)
+	if socket := DefaultSocket(); socket != filepath.Join(dir, "mcp_gate.sock") {
+		t.Errorf("Expected the socket in the runtime directory, got %s", socket)
+	}
+	t.Setenv("XDG_RUNTIME_DIR", "")
+	if socket := DefaultSocket(); !filepath.IsAbs(socket) {
+		t.Errorf("Expected an absolute path without a runtime directory, got %s", socket)
+	}
+}
+
+func TestWriteStatus(t *testing.T) {
+	var output strings.Builder
+	err := WriteStatus(&output, []client.UpstreamStatus{
+		{Name: "docs", State: "connected", Healthy: true, PID: 42, Tools: 3},
+		{Name: "compute", Replica: 2, State: "failed", LastError: "exit status 1"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to write status: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected a header and 2 upstreams, got %q", output.String())
+	}
+	if !strings.HasPrefix(lines[1], "docs ") || !strings.Contains(lines[1], "42") {
+		t.Errorf("Unexpected line for docs: %q", lines[1])
+	}
+	if !strings.HasPrefix(lines[2], "compute#2 ") || !strings.HasSuffix(lines[2], "exit status 1") {
+		t.Errorf("Unexpected line for the compute replica: %q", lines[2])
+	}
+}
+
+func TestWriteInstalled(t *testing.T) {
+	var output strings.Builder
+	err := WriteInstalled(&output, []client.InstalledUpstream{
+		{Name: "docs", Transport: "ipc", State: "connected", Enabled: true, Configured: true, Tools: []string{"lookup", "search"}},
+		{Name: "fetch", Transport: "http", State: "disabled", Tools: []string{}},
+	})
+	if err != nil {
+		t.Fatalf("Failed to write installed upstreams: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected a header and 2 upstreams, got %q", output.String())
+	}
+	if !strings.Contains(lines[1], "config") || !strings.HasSuffix(lines[1], "lookup, search") {
+		t.Errorf("Unexpected line for docs: %q", lines[1])
+	}
+	if !strings.Contains(lines[2], "disabled") || !strings.Contains(lines[2], "runtime") {
+		t.Errorf("Unexpected line for fetch: %q", lines[2])
+	}
+}
+
+func TestTokenIsRequired(t *testing.T) {
+	api := httptest.NewServer((&API{Token: "secret"}).Handler())
+	defer api.Close()
+
+	if _, err := DialHTTP(api.URL, "").Status(); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Expected the request without token to be rejected, got %v", err)
+	}
+	if _, err := DialHTTP(api.URL, "wrong").Status(); err == nil {
+		t.Error("Expected the request with a wrong token to be rejected")
+	}
+	if _, err := DialHTTP(api.URL, "secret").Status(); err != nil {
+		t.Errorf("Expected the request with the token to pass, got %v", err)
+	}
+}
+
+func TestListenAndServeNeedsToken(t *testing.T) {
+	if err := (&API{}).ListenAndServe("127.0.0.1:0"); err == nil {
+		t.Error("Expected the control api not to be served over http without a token")
+	}
+}
+
+func TestErrors(t *testing.T) {
+	api := httptest.NewServer((&API{}).Handler())
+	defer api.Close()
+	conn := DialHTTP(api.URL, "")
+
+	if err := conn.Remove("unknown"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Expected removing an unknown upstream to fail with 404, got %v", err)
+	}
+	if _, err := conn.Restart("unknown"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Expected restarting an unknown upstream to fail with 404, got %v", err)
+	}
+	if _, err := conn.Install(map[string]any{"name": "not-in-the-catalog"}); err == nil || !strings.Contains(err.Error(), "not in the catalog") {
+		t.Errorf("Expected installing an unknown catalog entry to fail, got %v", err)
+	}
+	if _, err := conn.Disable("unknown"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Expected disabling an unknown upstream to fail with 404, got %v", err)
+	}
+	if _, err := conn.Enable("unknown"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Expected enabling an unknown upstream to fail with 404, got %v", err)
+	}
+	if _, err := conn.Reload(); err == nil || !strings.Contains(err.Error(), "501") {
+		t.Errorf("Expected reload to be unsupported, got %v", err)
+	}
+
+	response, err := http.Post(api.URL+"/upstreams", "application/json", strings.NewReader("not json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	if response.StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid body, got %s", response.Status)
+	}
+}
+
+func TestClearCache(t *testing.T) {
+	responses, err := cache.New(cache.Config{Enabled: true, Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to create the cache: %v", err)
+	}
+	previous := client.ResponseCache
+	client.ResponseCache = responses
+	defer func() { client.ResponseCache = previous }()
+	responses.Put("docs/lookup", []byte("cached"), 0)
+
+	api := httptest.NewServer((&API{}).Handler())
+	defer api.Close()
+	if err := DialHTTP(api.URL, "").ClearCache(); err != nil {
+		t.Fatalf("Failed to clear the cache: %v", err)
+	}
+	if _, ok := responses.Get("docs/lookup"); ok {
+		t.Error("Expected the cached response to be removed")
+	}
+}
+
+func TestNoGateway(t *testing.T) {
+	err := Dial(filepath.Join(t.TempDir(), "missing.sock"), "").ClearCache()
+	if !errors.Is(err, ErrNoGateway) {
+		t.Errorf("Expected ErrNoGateway without a running gateway, got %v", err)
+	}
+}
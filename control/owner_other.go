@@ -0,0 +1,11 @@
+//go:build !linux && !darwin
+
+package control
+
+import "net"
+
+// checkOwner accepts every connection, only the mode of the socket keeps
+// other users out.
+func checkOwner(conn net.Conn) error {
+	return nil
+}
@@ -0,0 +1,161 @@
+package control
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ebamberg/mcp-gate/client"
+)
+
+// ErrNoGateway is returned when no gateway answers on the socket or url.
+var ErrNoGateway = errors.New("no running gateway found")
+
+// Conn talks to the control API of a running gateway.
+type Conn struct {
+	base   string
+	token  string
+	http   *http.Client
+	target string // for error messages
+}
+
+// Dial connects to the gateway answering on a unix socket.
+func Dial(socket string, token string) *Conn {
+	return &Conn{
+		base:   "http://mcp-gate",
+		token:  token,
+		target: socket,
+		http: &http.Client{
+			Timeout: installTimeout + 10*time.Second,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var dialer net.Dialer
+					return dialer.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+	}
+}
+
+// DialHTTP connects to the gateway serving the control API at a http url.
+func DialHTTP(address string, token string) *Conn {
+	return &Conn{
+		base:   strings.TrimSuffix(address, "/"),
+		token:  token,
+		target: address,
+		http:   &http.Client{Timeout: installTimeout + 10*time.Second},
+	}
+}
+
+func (c *Conn) do(method string, path string, body any, result any) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	request, err := http.NewRequest(method, c.base+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		request.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	response, err := c.http.Do(request)
+	if err != nil {
+		return fmt.Errorf("%w on %s: %w", ErrNoGateway, c.target, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode >= 300 {
+		var failed errorResponse
+		if json.NewDecoder(response.Body).Decode(&failed) == nil && failed.Error != "" {
+			return fmt.Errorf("gateway answered %s: %s", response.Status, failed.Error)
+		}
+		return fmt.Errorf("gateway answered %s", response.Status)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(response.Body).Decode(result)
+}
+
+// Status returns the status of the upstreams of the gateway.
+func (c *Conn) Status() ([]client.UpstreamStatus, error) {
+	var statuses []client.UpstreamStatus
+	err := c.do(http.MethodGet, "/upstreams", nil, &statuses)
+	return statuses, err
+}
+
+// Install starts an upstream on the gateway. The entry is a catalog entry as
+// in config.yaml, one with only a name is taken from the catalog.
+func (c *Conn) Install(entry map[string]any) ([]client.UpstreamStatus, error) {
+	var statuses []client.UpstreamStatus
+	err := c.do(http.MethodPost, "/upstreams", entry, &statuses)
+	return statuses, err
+}
+
+// Remove stops an upstream and withdraws its tools from the gateway.
+func (c *Conn) Remove(name string) error {
+	return c.do(http.MethodDelete, "/upstreams/"+url.PathEscape(name), nil, nil)
+}
+
+// Restart restarts all replicas of an upstream.
+func (c *Conn) Restart(name string) ([]client.UpstreamStatus, error) {
+	var statuses []client.UpstreamStatus
+	err := c.do(http.MethodPost, "/upstreams/"+url.PathEscape(name)+"/restart", nil, &statuses)
+	return statuses, err
+}
+
+// Disable stops an upstream and withdraws its tools until it is enabled.
+func (c *Conn) Disable(name string) ([]client.InstalledUpstream, error) {
+	var installed []client.InstalledUpstream
+	err := c.do(http.MethodPost, "/upstreams/"+url.PathEscape(name)+"/disable", nil, &installed)
+	return installed, err
+}
+
+// Enable starts a disabled upstream again.
+func (c *Conn) Enable(name string) ([]client.InstalledUpstream, error) {
+	var installed []client.InstalledUpstream
+	err := c.do(http.MethodPost, "/upstreams/"+url.PathEscape(name)+"/enable", nil, &installed)
+	return installed, err
+}
+
+// Installed returns the upstreams installed in the gateway and their tools.
+func (c *Conn) Installed() ([]client.InstalledUpstream, error) {
+	var installed []client.InstalledUpstream
+	err := c.do(http.MethodGet, "/installed", nil, &installed)
+	return installed, err
+}
+
+// ClearCache removes all cached responses of the gateway, in memory and on
+// disk.
+func (c *Conn) ClearCache() error {
+	return c.do(http.MethodDelete, "/cache", nil, nil)
+}
+
+// Reload makes the gateway read its configuration again.
+func (c *Conn) Reload() (client.Changes, error) {
+	var changes client.Changes
+	err := c.do(http.MethodPost, "/reload", nil, &changes)
+	return changes, err
+}
+
+// Sessions returns the client sessions connected to the gateway.
+func (c *Conn) Sessions() ([]client.SessionInfo, error) {
+	var sessions []client.SessionInfo
+	err := c.do(http.MethodGet, "/sessions", nil, &sessions)
+	return sessions, err
+}
@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/ebamberg/mcp-gate/cmd"
+	"github.com/ebamberg/mcp-gate/sandbox"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -59,6 +60,10 @@ func configLogging() {
 }
 
 func main() {
+	// the sandbox helper runs before anything else is set up
+	if len(os.Args) > 1 && os.Args[1] == sandbox.HelperArg {
+		sandbox.Run()
+	}
 
 	configLogging()
 	cobra.OnInitialize(initConfig)
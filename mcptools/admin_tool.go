@@ -3,8 +3,10 @@ package mcptools
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/ebamberg/mcp-gate/client"
+	"github.com/ebamberg/mcp-gate/control"
 	"github.com/ebamberg/mcp-gate/repo"
 
 	"github.com/mark3labs/mcp-go/mcp"
@@ -19,16 +21,95 @@ func adminInstallToolSchema() mcp.Tool {
 			mcp.Required(),
 			mcp.Description("The name of the tool to install in mcp-gate"),
 		),
+		mcp.WithObject("inputs",
+			mcp.Description("values for the inputs of the tool by their name, as listed by mcp-gate-list-available. Missing ones are asked from the user if the client supports elicitation"),
+		),
 	)
 }
 
 func listAvailableToolsSchema() mcp.Tool {
 	// Add a admin tool
 	return mcp.NewTool("mcp-gate-list-available",
-		mcp.WithDescription("returns a list of available tools that can be installed in mcp-gate"),
+		mcp.WithDescription("searches the catalog of mcp-servers that can be installed in mcp-gate, the best matches first. Without arguments every entry is returned."),
+		mcp.WithString("query",
+			mcp.Description("words that all have to appear in the name, description, tags or author, for example \"weather forecast\""),
+		),
+		mcp.WithArray("tags",
+			mcp.Description("tags the mcp-server has to have"),
+			mcp.WithStringItems(),
+		),
+		mcp.WithString("platform",
+			mcp.Description("only mcp-servers that run on this os or os/arch, for example linux or darwin/arm64"),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("maximum number of entries to return, defaults to 20"),
+		),
+		mcp.WithOutputSchema[catalogSearchResult](),
+		mcp.WithReadOnlyHintAnnotation(true),
+	)
+}
+
+// catalogSearchResult is the structured result of mcp-gate-list-available.
+type catalogSearchResult struct {
+	Total   int            `json:"total"` // matching entries, more than returned if the limit was reached
+	Entries []repo.Listing `json:"entries"`
+}
+
+func statusToolSchema() mcp.Tool {
+	return mcp.NewTool("mcp-gate-status",
+		mcp.WithDescription("returns the state, health, pid, uptime, restarts, number of tools and last error of every installed mcp-server"),
+		mcp.WithReadOnlyHintAnnotation(true),
+	)
+}
+
+func uninstallToolSchema() mcp.Tool {
+	return mcp.NewTool("mcp-gate-uninstall-tool",
+		mcp.WithDescription("stops a mcp-server installed at runtime and removes it with its tools from mcp-gate, one of the configuration can only be disabled"),
+		mcp.WithString("toolname",
+			mcp.Required(),
+			mcp.Description("The name of the installed mcp-server, as listed by mcp-gate-list-installed"),
+		),
+		mcp.WithDestructiveHintAnnotation(true),
+	)
+}
+
+func disableToolSchema() mcp.Tool {
+	return mcp.NewTool("mcp-gate-disable-tool",
+		mcp.WithDescription("stops an installed mcp-server and hides its tools, it keeps its configuration until mcp-gate-enable-tool starts it again"),
+		mcp.WithString("toolname",
+			mcp.Required(),
+			mcp.Description("The name of the installed mcp-server, as listed by mcp-gate-list-installed"),
+		),
+		mcp.WithDestructiveHintAnnotation(false),
+		mcp.WithIdempotentHintAnnotation(true),
 	)
 }
 
+func enableToolSchema() mcp.Tool {
+	return mcp.NewTool("mcp-gate-enable-tool",
+		mcp.WithDescription("starts a disabled mcp-server again and offers its tools"),
+		mcp.WithString("toolname",
+			mcp.Required(),
+			mcp.Description("The name of the disabled mcp-server, as listed by mcp-gate-list-installed"),
+		),
+		mcp.WithDestructiveHintAnnotation(false),
+		mcp.WithIdempotentHintAnnotation(true),
+	)
+}
+
+func listInstalledToolsSchema() mcp.Tool {
+	return mcp.NewTool("mcp-gate-list-installed",
+		mcp.WithDescription("lists the mcp-servers installed in mcp-gate, whether they are enabled and their tools"),
+		mcp.WithOutputSchema[installedResult](),
+		mcp.WithReadOnlyHintAnnotation(true),
+	)
+}
+
+// installedResult is the structured result of mcp-gate-list-installed.
+type installedResult struct {
+	Installed []client.InstalledUpstream `json:"installed"`
+}
+
 func mcpGateVersionResourceSchema() mcp.Resource {
 	return mcp.NewResource("mcpgate://version", "mcp-gate-version",
 		mcp.WithResourceDescription("The version of the installed mcp-gate."),
@@ -41,6 +122,11 @@ func RegisterAdminTool(server *server.MCPServer) {
 	// Add the install a tool handler
 	server.AddTool(listAvailableToolsSchema(), listAvailableToolsHandler)
 	server.AddTool(adminInstallToolSchema(), createInstallToolHandler(server))
+	server.AddTool(statusToolSchema(), statusToolHandler)
+	server.AddTool(listInstalledToolsSchema(), listInstalledToolsHandler)
+	server.AddTool(uninstallToolSchema(), manageToolHandler(client.Uninstall, "uninstalled"))
+	server.AddTool(disableToolSchema(), manageToolHandler(client.Disable, "disabled"))
+	server.AddTool(enableToolSchema(), manageToolHandler(client.Enable, "enabled"))
 }
 
 func mcpGateVersionResourceHandler(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
@@ -59,13 +145,47 @@ func listAvailableToolsHandler(ctx context.Context, request mcp.CallToolRequest)
 	if err != nil {
 		return mcp.NewToolResultError(err.Error()), nil
 	}
-	var result string
-	for _, entry := range repoEntries {
-		result += fmt.Sprintf("Tool: %s\nDescription: %s\nCommand: %s\nArgs: %v\nDependencies: %v\nPlatforms: %v\n\n",
-			entry.Name, entry.Description, entry.Command, entry.Args, entry.Dependencies, entry.Platforms)
+	matches := repo.Search(repoEntries, repo.Query{
+		Text:     request.GetString("query", ""),
+		Tags:     request.GetStringSlice("tags", nil),
+		Platform: request.GetString("platform", ""),
+	})
+	result := catalogSearchResult{Total: len(matches), Entries: []repo.Listing{}}
+	limit := request.GetInt("limit", 20)
+	for i, entry := range matches {
+		if limit > 0 && i == limit {
+			break
+		}
+		result.Entries = append(result.Entries, entry.Listing())
+	}
+	return mcp.NewToolResultJSON(result)
+}
 
+func statusToolHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	var result strings.Builder
+	if err := control.WriteStatus(&result, client.Statuses()); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	return mcp.NewToolResultText(result.String()), nil
+}
+
+func listInstalledToolsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	return mcp.NewToolResultJSON(installedResult{Installed: client.Installed()})
+}
+
+// manageToolHandler applies the action to the named mcp-server. The clients
+// are notified of its withdrawn or added tools by the gateway.
+func manageToolHandler(action func(name string) error, done string) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		toolname, err := request.RequireString("toolname")
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		if err := action(toolname); err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("Tool %s %s successfully.", toolname, done)), nil
 	}
-	return mcp.NewToolResultText(fmt.Sprintf("List of mcp-server-tools than can be installed and can be used.\n\n %s ", result)), nil
 }
 
 func createInstallToolHandler(server *server.MCPServer) func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
@@ -82,8 +202,20 @@ func createInstallToolHandler(server *server.MCPServer) func(ctx context.Context
 		}
 		for _, entry := range repoEntries {
 			if entry.Name == toolname {
+				entry.With = map[string]string{}
+				if inputs, ok := request.GetArguments()["inputs"].(map[string]any); ok {
+					for name, value := range inputs {
+						entry.With[name] = fmt.Sprint(value)
+					}
+				}
+				if err := elicitInputs(ctx, server, &entry); err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
+				if _, err := entry.Resolve(); err != nil {
+					return mcp.NewToolResultError(err.Error()), nil
+				}
 				// Register the tool in the server
-				err := client.RegisterMCPTool(server, entry)
+				err := client.RegisterMCPTool(ctx, server, entry)
 				if err != nil {
 					return mcp.NewToolResultError(err.Error()), nil
 				}
@@ -94,3 +226,47 @@ func createInstallToolHandler(server *server.MCPServer) func(ctx context.Context
 		return mcp.NewToolResultText(fmt.Sprintf("The tool %s is not available. I was unable to install the tool.", toolname)), nil
 	}
 }
+
+// elicitInputs asks the user for the inputs the entry misses, if the client
+// supports elicitation. Otherwise the entry is left as it is.
+func elicitInputs(ctx context.Context, s *server.MCPServer, entry *repo.RepositoryEntry) error {
+	missing := entry.Missing()
+	if len(missing) == 0 {
+		return nil
+	}
+	session, ok := server.ClientSessionFromContext(ctx).(server.SessionWithClientInfo)
+	if !ok || session.GetClientCapabilities().Elicitation == nil {
+		return nil
+	}
+	properties := map[string]any{}
+	var required []string
+	for _, input := range missing {
+		property := map[string]any{"type": "string", "title": input.Name}
+		if input.Description != "" {
+			property["description"] = input.Description
+		}
+		if input.Type == repo.INPUT_ENUM {
+			property["enum"] = input.Options
+		}
+		properties[input.Name] = property
+		required = append(required, input.Name)
+	}
+	result, err := s.RequestElicitation(ctx, mcp.ElicitationRequest{
+		Params: mcp.ElicitationParams{
+			Message:         fmt.Sprintf("%s needs some settings to be installed", entry.Name),
+			RequestedSchema: map[string]any{"type": "object", "properties": properties, "required": required},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to ask for the inputs of %s: %w", entry.Name, err)
+	}
+	if result.Action != mcp.ElicitationResponseActionAccept {
+		return fmt.Errorf("%s was not installed, the user chose to %s", entry.Name, result.Action)
+	}
+	if content, ok := result.Content.(map[string]any); ok {
+		for name, value := range content {
+			entry.With[name] = fmt.Sprint(value)
+		}
+	}
+	return nil
+}
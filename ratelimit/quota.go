@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// quotaFlushInterval is how often changed counts are written to the quota
+// file.
+const quotaFlushInterval = 5 * time.Second
+
+type quotaCount struct {
+	Day   string `json:"day"`
+	Count int    `json:"count"`
+}
+
+// quotaStore keeps the daily call counts and persists them to a JSON file, so
+// quotas survive restarts of the gateway. Without a file counts are in memory.
+// counts and dirty are guarded by the mutex of the limiter, the file is
+// written outside of it.
+type quotaStore struct {
+	fileName string
+	counts   map[string]quotaCount
+	dirty    bool // counts changed since the last snapshot
+
+	writeMu sync.Mutex // keeps snapshots written in the order they were taken
+}
+
+func loadQuotaStore(fileName string) (*quotaStore, error) {
+	store := &quotaStore{fileName: fileName, counts: map[string]quotaCount{}}
+	if fileName == "" {
+		return store, nil
+	}
+	data, err := os.ReadFile(fileName)
+	if errors.Is(err, os.ErrNotExist) {
+		return store, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &store.counts); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+func (store *quotaStore) count(key, day string) int {
+	if counted, ok := store.counts[key]; ok && counted.Day == day {
+		return counted.Count
+	}
+	return 0
+}
+
+func (store *quotaStore) increment(key, day string) {
+	store.counts[key] = quotaCount{Day: day, Count: store.count(key, day) + 1}
+	store.dirty = store.fileName != ""
+}
+
+// snapshot returns the counts to write, nil if they did not change since the
+// last snapshot.
+func (store *quotaStore) snapshot() ([]byte, error) {
+	if !store.dirty {
+		return nil, nil
+	}
+	data, err := json.MarshalIndent(store.counts, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	store.dirty = false
+	return data, nil
+}
+
+// write writes a snapshot to a temporary file first, so a crash never leaves
+// a truncated quota file behind.
+func (store *quotaStore) write(data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(store.fileName), filepath.Base(store.fileName)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), store.fileName)
+}
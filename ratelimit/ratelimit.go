@@ -0,0 +1,244 @@
+package ratelimit
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rule limits the calls that match its patterns. Only the dimensions a rule
+// names are used to key its buckets, so a rule with just an upstream limits
+// all calls to that upstream together while adding `principal: "*"` gives
+// every principal a bucket of its own.
+type Rule struct {
+	Principal  string        `mapstructure:"principal"` // pattern for the calling client
+	Upstream   string        `mapstructure:"upstream"`  // pattern for the upstream server
+	Tool       string        `mapstructure:"tool"`      // pattern for the tool name
+	Calls      int           `mapstructure:"calls"`     // calls allowed per interval, 0 disables the rate limit
+	Per        time.Duration `mapstructure:"per"`       // the interval, defaults to a minute
+	Burst      int           `mapstructure:"burst"`     // defaults to calls
+	DailyQuota int           `mapstructure:"daily_quota"`
+}
+
+// Config is read from the `ratelimits` section of the gateway config.
+type Config struct {
+	Rules     []Rule `mapstructure:"rules"`
+	QuotaFile string `mapstructure:"quota_file"`
+}
+
+// LimitError is returned for a call that exceeds a rate limit or quota.
+type LimitError struct {
+	Scope      string
+	Quota      bool
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string {
+	kind := "rate limit"
+	if e.Quota {
+		kind = "daily quota"
+	}
+	return fmt.Sprintf("%s exceeded for %s, retry after %s", kind, e.Scope, e.RetryAfter.Round(time.Second))
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter enforces rate limits and daily quotas.
+type Limiter struct {
+	rules  []Rule
+	quotas *quotaStore
+	now    func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+
+	done      chan struct{} // stops the periodic flush of the quotas
+	closeOnce sync.Once
+}
+
+// NewLimiter creates a limiter. With a quota file the daily counts are written
+// to it every few seconds and by Close.
+func NewLimiter(config Config) (*Limiter, error) {
+	quotas, err := loadQuotaStore(config.QuotaFile)
+	if err != nil {
+		return nil, err
+	}
+	l := &Limiter{rules: withDefaults(config.Rules), quotas: quotas, now: time.Now, buckets: map[string]*bucket{}}
+	if config.QuotaFile != "" {
+		l.done = make(chan struct{})
+		go l.flushEvery(quotaFlushInterval)
+	}
+	return l, nil
+}
+
+// Flush writes the daily counts to the quota file if they changed. The file
+// is written outside the lock calls are counted under.
+func (l *Limiter) Flush() error {
+	if l == nil {
+		return nil
+	}
+	l.quotas.writeMu.Lock()
+	defer l.quotas.writeMu.Unlock()
+	l.mu.Lock()
+	data, err := l.quotas.snapshot()
+	l.mu.Unlock()
+	if err != nil || data == nil {
+		return err
+	}
+	if err := l.quotas.write(data); err != nil {
+		// written again with the next flush
+		l.mu.Lock()
+		l.quotas.dirty = true
+		l.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (l *Limiter) flushEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := l.Flush(); err != nil {
+				log.Printf("failed to save quotas: %v", err)
+			}
+		case <-l.done:
+			return
+		}
+	}
+}
+
+// Close stops the periodic flush and writes the daily counts a last time.
+func (l *Limiter) Close() error {
+	if l == nil {
+		return nil
+	}
+	if l.done != nil {
+		l.closeOnce.Do(func() { close(l.done) })
+	}
+	return l.Flush()
+}
+
+func withDefaults(configured []Rule) []Rule {
+	rules := make([]Rule, len(configured))
+	for i, rule := range configured {
+		if rule.Per <= 0 {
+			rule.Per = time.Minute
+		}
+		if rule.Burst <= 0 {
+			rule.Burst = rule.Calls
+		}
+		rules[i] = rule
+	}
+	return rules
+}
+
+// SetRules replaces the rules of a running limiter. The rate limits start
+// over with full buckets, the daily quotas already used are kept.
+func (l *Limiter) SetRules(rules []Rule) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.rules = withDefaults(rules)
+	l.buckets = map[string]*bucket{}
+}
+
+// Allow records a call of tool on upstream by principal, or returns a
+// LimitError if any matching rule does not allow it. A denied call is not
+// counted against any rule.
+func (l *Limiter) Allow(principal, upstream, tool string) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	day := now.UTC().Format(time.DateOnly)
+	var buckets []*bucket
+	var quotaKeys []string
+	for i, rule := range l.rules {
+		if !rule.matches(principal, upstream, tool) {
+			continue
+		}
+		scope := rule.scope(principal, upstream, tool)
+		if rule.Calls > 0 {
+			b := l.refill(fmt.Sprintf("%d:%s", i, scope), rule, now)
+			if b.tokens < 1 {
+				retryAfter := time.Duration((1 - b.tokens) / rate(rule) * float64(time.Second))
+				return &LimitError{Scope: scope, RetryAfter: retryAfter}
+			}
+			buckets = append(buckets, b)
+		}
+		if rule.DailyQuota > 0 {
+			// quota keys are persisted, so they use the patterns instead of the rule index
+			key := fmt.Sprintf("%s|%s|%s:%s", rule.Principal, rule.Upstream, rule.Tool, scope)
+			if l.quotas.count(key, day) >= rule.DailyQuota {
+				tomorrow := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+				return &LimitError{Scope: scope, Quota: true, RetryAfter: tomorrow.Sub(now)}
+			}
+			quotaKeys = append(quotaKeys, key)
+		}
+	}
+
+	for _, b := range buckets {
+		b.tokens--
+	}
+	for _, key := range quotaKeys {
+		l.quotas.increment(key, day)
+	}
+	return nil
+}
+
+func (l *Limiter) refill(key string, rule Rule, now time.Time) *bucket {
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(rule.Burst), last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(float64(rule.Burst), b.tokens+now.Sub(b.last).Seconds()*rate(rule))
+	b.last = now
+	return b
+}
+
+// rate returns the tokens a rule adds per second.
+func rate(rule Rule) float64 {
+	return float64(rule.Calls) / rule.Per.Seconds()
+}
+
+func (rule Rule) matches(principal, upstream, tool string) bool {
+	return match(rule.Principal, principal) && match(rule.Upstream, upstream) && match(rule.Tool, tool)
+}
+
+func (rule Rule) scope(principal, upstream, tool string) string {
+	var parts []string
+	if rule.Principal != "" {
+		parts = append(parts, "principal "+principal)
+	}
+	if rule.Upstream != "" {
+		parts = append(parts, "upstream "+upstream)
+	}
+	if rule.Tool != "" {
+		parts = append(parts, "tool "+tool)
+	}
+	if len(parts) == 0 {
+		return "all calls"
+	}
+	return strings.Join(parts, ", ")
+}
+
+func match(pattern, value string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(pattern, value)
+	return ok
+}
@@ -0,0 +1,148 @@
+package ratelimit
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestLimiter(t *testing.T, config Config, now *time.Time) *Limiter {
+	limiter, err := NewLimiter(config)
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	limiter.now = func() time.Time { return *now }
+	t.Cleanup(func() { limiter.Close() })
+	return limiter
+}
+
+func TestRateLimitRefillsOverTime(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter := newTestLimiter(t, Config{Rules: []Rule{{Upstream: "paid-api", Calls: 2, Per: time.Minute}}}, &now)
+
+	for i := 0; i < 2; i++ {
+		if err := limiter.Allow("claude", "paid-api", "search"); err != nil {
+			t.Fatalf("Expected call %d to be allowed: %v", i, err)
+		}
+	}
+	err := limiter.Allow("other-client", "paid-api", "fetch")
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) {
+		t.Fatalf("Expected a LimitError, got %v", err)
+	}
+	if limitErr.RetryAfter != 30*time.Second {
+		t.Errorf("Expected retry after 30s, got %s", limitErr.RetryAfter)
+	}
+
+	if err := limiter.Allow("claude", "other-api", "search"); err != nil {
+		t.Errorf("Expected calls to other upstreams to be allowed: %v", err)
+	}
+
+	now = now.Add(30 * time.Second)
+	if err := limiter.Allow("claude", "paid-api", "search"); err != nil {
+		t.Errorf("Expected the bucket to be refilled: %v", err)
+	}
+}
+
+func TestRateLimitPerPrincipal(t *testing.T) {
+	now := time.Now()
+	limiter := newTestLimiter(t, Config{Rules: []Rule{{Principal: "*", Upstream: "paid-api", Calls: 1}}}, &now)
+
+	if err := limiter.Allow("claude", "paid-api", "search"); err != nil {
+		t.Fatalf("Expected the first call to be allowed: %v", err)
+	}
+	if err := limiter.Allow("cursor", "paid-api", "search"); err != nil {
+		t.Errorf("Expected every principal to have its own bucket: %v", err)
+	}
+	if err := limiter.Allow("claude", "paid-api", "search"); err == nil {
+		t.Error("Expected the second call of the same principal to be limited")
+	}
+}
+
+func TestDailyQuotaIsPersisted(t *testing.T) {
+	quotaFile := filepath.Join(t.TempDir(), "quota.json")
+	config := Config{Rules: []Rule{{Upstream: "paid-api", DailyQuota: 1}}, QuotaFile: quotaFile}
+	now := time.Date(2025, 1, 1, 18, 0, 0, 0, time.UTC)
+
+	limiter := newTestLimiter(t, config, &now)
+	if err := limiter.Allow("claude", "paid-api", "search"); err != nil {
+		t.Fatalf("Expected the first call to be allowed: %v", err)
+	}
+
+	// the call is written when the gateway stops, a restarted one still knows about it
+	if err := limiter.Close(); err != nil {
+		t.Fatalf("Failed to save quotas: %v", err)
+	}
+	limiter = newTestLimiter(t, config, &now)
+	err := limiter.Allow("claude", "paid-api", "search")
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || !limitErr.Quota {
+		t.Fatalf("Expected a quota error, got %v", err)
+	}
+	if limitErr.RetryAfter != 6*time.Hour {
+		t.Errorf("Expected retry after 6h, got %s", limitErr.RetryAfter)
+	}
+
+	now = now.Add(6 * time.Hour)
+	if err := limiter.Allow("claude", "paid-api", "search"); err != nil {
+		t.Errorf("Expected the quota to be reset the next day: %v", err)
+	}
+}
+
+func TestQuotaFileIsWrittenByFlush(t *testing.T) {
+	quotaFile := filepath.Join(t.TempDir(), "quota.json")
+	now := time.Now()
+	limiter := newTestLimiter(t, Config{Rules: []Rule{{Upstream: "paid-api", DailyQuota: 5}}, QuotaFile: quotaFile}, &now)
+
+	limiter.Allow("claude", "paid-api", "search")
+	if _, err := os.Stat(quotaFile); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("Expected the call not to be written synchronously, got %v", err)
+	}
+	if err := limiter.Flush(); err != nil {
+		t.Fatalf("Failed to flush quotas: %v", err)
+	}
+	stored, err := loadQuotaStore(quotaFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count := stored.count("|paid-api|:upstream paid-api", now.UTC().Format(time.DateOnly)); count != 1 {
+		t.Errorf("Expected the flushed count to be 1, got %d", count)
+	}
+}
+
+func TestDeniedCallIsNotCounted(t *testing.T) {
+	now := time.Now()
+	limiter := newTestLimiter(t, Config{Rules: []Rule{
+		{Upstream: "paid-api", DailyQuota: 5},
+		{Tool: "search", Calls: 1},
+	}}, &now)
+
+	limiter.Allow("claude", "paid-api", "search")
+	limiter.Allow("claude", "paid-api", "search")
+	if count := limiter.quotas.count("|paid-api|:upstream paid-api", now.UTC().Format(time.DateOnly)); count != 1 {
+		t.Errorf("Expected only the allowed call to be counted, got %d", count)
+	}
+}
+
+func TestSetRules(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter := newTestLimiter(t, Config{}, &now)
+	if err := limiter.Allow("claude", "paid-api", "search"); err != nil {
+		t.Fatalf("Expected a limiter without rules to allow calls: %v", err)
+	}
+
+	limiter.SetRules([]Rule{{Upstream: "paid-api", Calls: 1}})
+	if err := limiter.Allow("claude", "paid-api", "search"); err != nil {
+		t.Fatalf("Expected the first call to be allowed: %v", err)
+	}
+	if err := limiter.Allow("claude", "paid-api", "search"); err == nil {
+		t.Error("Expected the new rule to limit the second call")
+	}
+
+	limiter.SetRules(nil)
+	if err := limiter.Allow("claude", "paid-api", "search"); err != nil {
+		t.Errorf("Expected the removed rule not to apply anymore: %v", err)
+	}
+}
@@ -0,0 +1,144 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	RUNTIME_DOCKER = "docker"
+	RUNTIME_PODMAN = "podman"
+)
+
+// Container is the image a container entry runs. The gateway starts it with
+// the docker or podman CLI and talks to it over stdin and stdout, the args of
+// the entry are passed to the image and its env into the container.
+type Container struct {
+	Image   string   `yaml:"image" json:"image"`
+	Runtime string   `yaml:"runtime,omitempty" json:"runtime,omitempty"` // docker or podman, the one installed if empty
+	Mounts  []string `yaml:"mounts,omitempty" json:"mounts,omitempty"`   // host path:container path, :ro appended for read only
+	Network string   `yaml:"network,omitempty" json:"network,omitempty"` // none, bridge, host or the name of a network, the default of the runtime if empty
+	Options []string `yaml:"options,omitempty" json:"options,omitempty"` // further options of run, for example --memory=512m
+}
+
+var errNoContainerRuntime = errors.New("neither docker nor podman is installed or on the PATH, " + installHints[RUNTIME_DOCKER] + " or " + installHints[RUNTIME_PODMAN])
+
+// CLI returns the runtime the container is started with.
+func (c Container) CLI() (string, error) {
+	if c.Runtime != "" {
+		return c.Runtime, nil
+	}
+	for _, runtime := range []string{RUNTIME_DOCKER, RUNTIME_PODMAN} {
+		if _, err := exec.LookPath(runtime); err == nil {
+			return runtime, nil
+		}
+	}
+	return "", errNoContainerRuntime
+}
+
+// checkMount returns what is wrong with a mount, empty if nothing.
+func checkMount(mount string) string {
+	parts := strings.Split(mount, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" {
+		return fmt.Sprintf("mount %q is not host path:container path[:ro]", mount)
+	}
+	if !strings.HasPrefix(parts[1], "/") {
+		return fmt.Sprintf("mount %q needs an absolute path in the container", mount)
+	}
+	if len(parts) == 3 && parts[2] != "ro" && parts[2] != "rw" {
+		return fmt.Sprintf("mount %q can only end with :ro or :rw", mount)
+	}
+	return ""
+}
+
+// hostOptions are options of run that open the host to the container.
+var hostOptions = []string{"--privileged", "--cap-add", "-v", "--volume", "--volumes-from", "--mount", "--device", "--security-opt", "--env-file"}
+
+// namespaceOptions share a namespace of the host with the value host.
+var namespaceOptions = []string{"--network", "--net", "--pid", "--ipc", "--uts", "--userns", "--cgroupns"}
+
+// checkOptions returns the first option that gives the container access to
+// the host, empty if there is none. Only entries of the configuration may use
+// them, not those of a catalog.
+func checkOptions(container Container) string {
+	if container.Network == "host" {
+		return "network host"
+	}
+	for i, option := range container.Options {
+		name, value, hasValue := strings.Cut(option, "=")
+		if slices.Contains(hostOptions, name) || (strings.HasPrefix(name, "-v") && !strings.HasPrefix(name, "--")) {
+			return option
+		}
+		if slices.Contains(namespaceOptions, name) {
+			if !hasValue && i+1 < len(container.Options) {
+				value = container.Options[i+1]
+			}
+			if value == "host" {
+				return option + " host"
+			}
+		}
+	}
+	return ""
+}
+
+// hostPath makes the host side of a bind mount absolute, the runtimes take a
+// bare name for a volume.
+func hostPath(source string) string {
+	source = expandHome(source)
+	if !strings.ContainsAny(source, `/\`) && !strings.HasPrefix(source, ".") {
+		return source
+	}
+	if absolute, err := filepath.Abs(source); err == nil {
+		return absolute
+	}
+	return source
+}
+
+// ContainerCommand returns the CLI and the arguments starting the container of
+// the entry as name, with stdin attached and removed when it exits. The
+// values of env are not put on the command line, the runtime takes them from
+// its own environment like the variables of required_config.
+func ContainerCommand(entry RepositoryEntry, name string) (string, []string, error) {
+	if entry.Container == nil || entry.Container.Image == "" {
+		return "", nil, fmt.Errorf("%s: a container entry needs container.image", entry.Name)
+	}
+	container := entry.Container
+	if entry.Source != "" {
+		if option := checkOptions(*container); option != "" {
+			return "", nil, fmt.Errorf("%s: %q gives the container access to the host, only an entry of the configuration may use it", entry.Name, option)
+		}
+	}
+	runtime, err := container.CLI()
+	if err != nil {
+		return "", nil, err
+	}
+	args := []string{"run", "-i", "--rm", "--name", name}
+	if container.Network != "" {
+		args = append(args, "--network", container.Network)
+	}
+	for _, mount := range container.Mounts {
+		source, target, _ := strings.Cut(mount, ":")
+		args = append(args, "-v", hostPath(source)+":"+target)
+	}
+	passed := map[string]bool{}
+	variables := make([]string, 0, len(entry.Env)+len(entry.RequiredConfig))
+	for _, variable := range entry.Env {
+		variable, _, _ = strings.Cut(variable, "=")
+		variables = append(variables, variable)
+	}
+	for _, required := range entry.RequiredConfig {
+		variables = append(variables, required.Name)
+	}
+	for _, variable := range variables {
+		if !passed[variable] {
+			passed[variable] = true
+			args = append(args, "-e", variable)
+		}
+	}
+	args = append(append(args, container.Options...), container.Image)
+	return runtime, append(args, entry.Args...), nil
+}
@@ -0,0 +1,108 @@
+package repo
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestContainerCommand(t *testing.T) {
+	dir := t.TempDir()
+	entry := RepositoryEntry{
+		Name:      "weather",
+		Transport: "container",
+		Args:      []string{"--units", "metric"},
+		Env:       []string{"REGION=eu", "API_KEY=${env:API_KEY}"},
+		Container: &Container{
+			Image:   "ghcr.io/example/weather:1.2.0",
+			Runtime: "podman",
+			Mounts:  []string{dir + ":/data:ro", "cache:/cache"},
+			Network: "none",
+			Options: []string{"--memory=512m"},
+		},
+		RequiredConfig: []ConfigRequirement{{Name: "API_KEY"}, {Name: "TOKEN"}},
+	}
+	command, args, err := ContainerCommand(entry, "mcp-gate-weather-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"run", "-i", "--rm", "--name", "mcp-gate-weather-1", "--network", "none",
+		"-v", filepath.Clean(dir) + ":/data:ro", "-v", "cache:/cache",
+		"-e", "REGION", "-e", "API_KEY", "-e", "TOKEN",
+		"--memory=512m", "ghcr.io/example/weather:1.2.0", "--units", "metric"}
+	if command != "podman" || !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected podman %v, got %s %v", expected, command, args)
+	}
+
+	t.Setenv("PATH", t.TempDir())
+	entry.Container.Runtime = ""
+	if _, _, err := ContainerCommand(entry, "mcp-gate-weather-1"); !errors.Is(err, errNoContainerRuntime) {
+		t.Errorf("expected no runtime to be found, got %v", err)
+	}
+}
+
+func TestValidateContainer(t *testing.T) {
+	_, err := parseEntries("catalog.yaml", []byte(`- name: weather
+  transport: container
+  container:
+    image: ghcr.io/example/weather
+    runtime: lxc
+    mounts: ["/data", "/data:data", "/data:/data:rx"]
+- name: fetch
+  transport: ipc
+  command: uvx
+  container:
+    image: ghcr.io/example/fetch
+`))
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	expected := []string{
+		`weather: unknown container runtime "lxc", use docker or podman`,
+		`weather: mount "/data" is not host path:container path[:ro]`,
+		`weather: mount "/data:data" needs an absolute path in the container`,
+		`weather: mount "/data:/data:rx" can only end with :ro or :rw`,
+		"fetch: container is only used by a container entry",
+	}
+	if len(invalid.Problems) != len(expected) {
+		t.Fatalf("expected %d problems, got %v", len(expected), invalid)
+	}
+	for i, problem := range invalid.Problems {
+		if problem.Message != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], problem.Message)
+		}
+	}
+}
+
+func TestCatalogContainerCannotOpenTheHost(t *testing.T) {
+	for _, options := range [][]string{{"--privileged"}, {"--cap-add=SYS_ADMIN"}, {"-v=/:/host"}, {"-v/:/host"}, {"--network", "host"}, {"--pid=host"}, {"--device", "/dev/kvm"}} {
+		entry := RepositoryEntry{
+			Name:      "weather",
+			Transport: "container",
+			Container: &Container{Image: "ghcr.io/example/weather", Runtime: "docker", Options: options},
+			Source:    "https://registry.example.com",
+		}
+		if _, _, err := ContainerCommand(entry, "mcp-gate-weather-1"); err == nil || !strings.Contains(err.Error(), "access to the host") {
+			t.Errorf("%v: expected the option to be refused for a catalog entry, got %v", options, err)
+		}
+		// the configuration may use them
+		entry.Source = ""
+		if _, _, err := ContainerCommand(entry, "mcp-gate-weather-1"); err != nil {
+			t.Errorf("%v: expected the option to be allowed in the configuration, got %v", options, err)
+		}
+	}
+
+	_, err := parseEntries("catalog.yaml", []byte(`- name: weather
+  transport: container
+  container:
+    image: ghcr.io/example/weather
+    options: ["--memory=512m", "--ipc", "host"]
+`))
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) || len(invalid.Problems) != 1 || !strings.Contains(invalid.Problems[0].Message, `"--ipc host" gives the container access`) {
+		t.Errorf("expected the option to be reported, got %v", err)
+	}
+}
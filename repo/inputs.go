@@ -0,0 +1,197 @@
+package repo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const (
+	INPUT_STRING = "string"
+	INPUT_PATH   = "path"
+	INPUT_SECRET = "secret"
+	INPUT_ENUM   = "enum"
+)
+
+// Input is a value the user supplies when installing an entry, referenced as
+// `${input:name}` in its args, env, url, headers, container and sandbox paths.
+type Input struct {
+	Name        string   `yaml:"name" json:"name"`
+	Type        string   `yaml:"type,omitempty" json:"type,omitempty"` // string (default), path, secret or enum
+	Description string   `yaml:"description,omitempty" json:"description,omitempty"`
+	Default     string   `yaml:"default,omitempty" json:"default,omitempty"`
+	Options     []string `yaml:"options,omitempty" json:"options,omitempty"`   // values of an enum
+	Optional    bool     `yaml:"optional,omitempty" json:"optional,omitempty"` // may stay empty, otherwise an input without default is required
+}
+
+var (
+	inputReference = regexp.MustCompile(`\$\{input:([^}]*)\}`)
+	validInputName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// Required reports whether the user has to supply a value.
+func (input Input) Required() bool {
+	return input.Default == "" && !input.Optional
+}
+
+// Check returns why the value is not valid for the input, nil if it is.
+func (input Input) Check(value string) error {
+	if input.Type == INPUT_ENUM && value != "" && !slices.Contains(input.Options, value) {
+		return fmt.Errorf("%s has to be one of %s, not %q", input.Name, strings.Join(input.Options, ", "), value)
+	}
+	return nil
+}
+
+// value returns the value the entry was installed with, the default
+// otherwise. Names are compared ignoring case, as viper lowercases the keys of
+// the configuration.
+func (input Input) value(with map[string]string) (string, bool) {
+	for name, value := range with {
+		if strings.EqualFold(name, input.Name) {
+			return value, true
+		}
+	}
+	return input.Default, input.Default != ""
+}
+
+// MissingInputsError lists the inputs an entry needs and was not installed
+// with.
+type MissingInputsError struct {
+	Name   string
+	Inputs []Input
+}
+
+func (e *MissingInputsError) Error() string {
+	var missing []string
+	for _, input := range e.Inputs {
+		described := input.Name
+		if input.Description != "" {
+			described += " (" + input.Description + ")"
+		}
+		missing = append(missing, described)
+	}
+	return fmt.Sprintf("%s needs the inputs %s, set them under with: of the upstream", e.Name, strings.Join(missing, ", "))
+}
+
+// Missing returns the required inputs the entry has no value for.
+func (entry RepositoryEntry) Missing() []Input {
+	var missing []Input
+	for _, input := range entry.Inputs {
+		if value, _ := input.value(entry.With); value == "" && input.Required() {
+			missing = append(missing, input)
+		}
+	}
+	return missing
+}
+
+// Resolve returns the entry as it is started: `${input:name}` references are
+// replaced with the inputs the entry was installed with and `${env:NAME}`
+// references with the environment of the gateway.
+func (entry RepositoryEntry) Resolve() (RepositoryEntry, error) {
+	if missing := entry.Missing(); len(missing) > 0 {
+		return entry, &MissingInputsError{Name: entry.Name, Inputs: missing}
+	}
+	values := map[string]string{}
+	for _, input := range entry.Inputs {
+		value, _ := input.value(entry.With)
+		if err := input.Check(value); err != nil {
+			return entry, fmt.Errorf("%s: %w", entry.Name, err)
+		}
+		if input.Type == INPUT_PATH {
+			value = expandHome(value)
+		}
+		values[input.Name] = value
+	}
+	undeclared := ""
+	resolve := func(value string) string {
+		value = inputReference.ReplaceAllStringFunc(value, func(reference string) string {
+			return values[inputReference.FindStringSubmatch(reference)[1]]
+		})
+		// the defaults of inputs come from the catalog as well
+		if name, ok := entry.undeclaredEnv(value); ok && undeclared == "" {
+			undeclared = name
+		}
+		return ExpandEnv(value)
+	}
+
+	resolved := entry
+	resolved.Args = mapValues(entry.Args, resolve)
+	resolved.Env = mapValues(entry.Env, resolve)
+	resolved.Replicas.URLs = mapValues(entry.Replicas.URLs, resolve)
+	if entry.URL != nil {
+		url := resolve(*entry.URL)
+		resolved.URL = &url
+	}
+	if entry.Container != nil {
+		container := *entry.Container
+		container.Image = resolve(container.Image)
+		container.Mounts = mapValues(container.Mounts, resolve)
+		container.Options = mapValues(container.Options, resolve)
+		resolved.Container = &container
+	}
+	if entry.Sandbox != nil {
+		sandbox := *entry.Sandbox
+		sandbox.Paths = mapValues(sandbox.Paths, resolve)
+		resolved.Sandbox = &sandbox
+	}
+	if entry.Headers != nil {
+		resolved.Headers = make(map[string]string, len(entry.Headers))
+		for name, value := range entry.Headers {
+			resolved.Headers[name] = resolve(value)
+		}
+	}
+	if undeclared != "" {
+		return entry, fmt.Errorf("%s: ${env:%s} is not declared in required_config, an entry of catalog %s only gets the variables it declares", entry.Name, undeclared, entry.Source)
+	}
+	return resolved, nil
+}
+
+func mapValues(values []string, mapping func(string) string) []string {
+	if values == nil {
+		return nil
+	}
+	mapped := make([]string, len(values))
+	for i, value := range values {
+		mapped[i] = mapping(value)
+	}
+	return mapped
+}
+
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[1:])
+}
+
+// inputReferences returns the names of the inputs the values reference.
+func (entry RepositoryEntry) inputReferences() []string {
+	values := append(append([]string{}, entry.Args...), entry.Env...)
+	values = append(values, entry.Replicas.URLs...)
+	if entry.URL != nil {
+		values = append(values, *entry.URL)
+	}
+	for _, value := range entry.Headers {
+		values = append(values, value)
+	}
+	if entry.Container != nil {
+		values = append(append(append(values, entry.Container.Image), entry.Container.Mounts...), entry.Container.Options...)
+	}
+	if entry.Sandbox != nil {
+		values = append(values, entry.Sandbox.Paths...)
+	}
+	var names []string
+	for _, value := range values {
+		for _, match := range inputReference.FindAllStringSubmatch(value, -1) {
+			names = append(names, match[1])
+		}
+	}
+	return names
+}
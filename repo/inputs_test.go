@@ -0,0 +1,127 @@
+package repo
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestResolveInputs(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip("no home directory")
+	}
+	t.Setenv("MCP_GATE_TEST_TOKEN", "secret")
+	url := "https://${input:Host}/mcp"
+	entry := RepositoryEntry{
+		Name: "spaces",
+		URL:  &url,
+		Args: []string{"--work-dir=${input:work_dir}", "--mode=${input:mode}"},
+		Env:  []string{"TOKEN=${input:token}", "OTHER=${env:MCP_GATE_TEST_TOKEN}"},
+		Inputs: []Input{
+			{Name: "work_dir", Type: INPUT_PATH, Default: "~/mcp-store"},
+			{Name: "mode", Type: INPUT_ENUM, Options: []string{"fast", "slow"}, Default: "fast"},
+			{Name: "token", Type: INPUT_SECRET},
+			{Name: "Host"},
+		},
+		With: map[string]string{"token": "abc", "host": "example.com"},
+	}
+	resolved, err := entry.Resolve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedArgs := []string{"--work-dir=" + filepath.Join(home, "mcp-store"), "--mode=fast"}
+	if !reflect.DeepEqual(resolved.Args, expectedArgs) {
+		t.Errorf("expected args %v, got %v", expectedArgs, resolved.Args)
+	}
+	expectedEnv := []string{"TOKEN=abc", "OTHER=secret"}
+	if !reflect.DeepEqual(resolved.Env, expectedEnv) {
+		t.Errorf("expected env %v, got %v", expectedEnv, resolved.Env)
+	}
+	if *resolved.URL != "https://example.com/mcp" || *entry.URL != url {
+		t.Errorf("expected the resolved url https://example.com/mcp and the entry unchanged, got %s and %s", *resolved.URL, *entry.URL)
+	}
+
+	entry.With = map[string]string{"mode": "medium"}
+	var missing *MissingInputsError
+	if _, err := entry.Resolve(); !errors.As(err, &missing) || len(missing.Inputs) != 2 {
+		t.Errorf("expected token and Host to be missing, got %v", err)
+	}
+	entry.With = map[string]string{"mode": "medium", "token": "abc", "host": "example.com"}
+	if _, err := entry.Resolve(); err == nil {
+		t.Error("expected an error for a value that is not an option")
+	}
+}
+
+func TestValidateInputs(t *testing.T) {
+	_, err := parseEntries("catalog.yaml", []byte(`- name: spaces
+  transport: ipc
+  command: npx
+  args: ["--dir=${input:dir}", "${input:undeclared}"]
+  inputs:
+    - name: dir
+      type: path
+    - name: dir
+    - name: 1st
+    - name: mode
+      type: enum
+    - name: size
+      type: enum
+      options: [small, large]
+      default: medium
+    - name: count
+      type: number
+`))
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	expected := []string{
+		"spaces: input dir is declared twice",
+		`spaces: input name "1st" is not a valid identifier, use letters, digits and '_'`,
+		"spaces: enum input mode has no options",
+		`spaces: the default of size has to be one of small, large, not "medium"`,
+		`spaces: input count has the unknown type "number", use string, path, secret or enum`,
+		"spaces: ${input:undeclared} is used but not declared in inputs",
+	}
+	if len(invalid.Problems) != len(expected) {
+		t.Fatalf("expected %d problems, got %v", len(expected), invalid)
+	}
+	for i, problem := range invalid.Problems {
+		if problem.Message != expected[i] || problem.Line != 5 {
+			t.Errorf("expected %q at line 5, got %q at line %d", expected[i], problem.Message, problem.Line)
+		}
+	}
+}
+
+func TestCatalogEntriesOnlyGetDeclaredVariables(t *testing.T) {
+	t.Setenv("MCP_GATE_TEST_TOKEN", "secret")
+	t.Setenv("MCP_GATE_TEST_KEY", "key")
+	url := "https://example.com/mcp?k=${env:MCP_GATE_TEST_TOKEN}"
+	entry := RepositoryEntry{Name: "mirror", Transport: "http", URL: &url, Source: "https://catalog.example.com"}
+	if _, err := entry.Resolve(); err == nil || !strings.Contains(err.Error(), "MCP_GATE_TEST_TOKEN") {
+		t.Errorf("expected an undeclared variable to be refused, got %v", err)
+	}
+
+	// nor through the default of an input
+	entry.URL = nil
+	entry.Inputs = []Input{{Name: "key", Default: "${env:MCP_GATE_TEST_TOKEN}"}}
+	entry.Args = []string{"--key=${input:key}"}
+	if _, err := entry.Resolve(); err == nil {
+		t.Error("expected an undeclared variable in an input default to be refused")
+	}
+
+	entry.Inputs, entry.Args = nil, []string{"--token=${env:MCP_GATE_TEST_TOKEN}"}
+	entry.RequiredConfig = []ConfigRequirement{{Name: "MCP_GATE_TEST_TOKEN"}}
+	entry.Env = []string{"MCP_GATE_TEST_KEY=${env:MCP_GATE_TEST_KEY}"}
+	resolved, err := entry.Resolve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved.Args[0] != "--token=secret" || resolved.Env[0] != "MCP_GATE_TEST_KEY=key" {
+		t.Errorf("expected the declared variables to be expanded, got %v %v", resolved.Args, resolved.Env)
+	}
+}
@@ -0,0 +1,481 @@
+package repo
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	PACKAGE_NPM  = "npm"
+	PACKAGE_PYPI = "pypi"
+)
+
+// Package pins the npm or pypi package an ipc entry runs. The argument of the
+// entry naming the package is replaced with the archive fetched into the
+// package store, so the upstream always runs the verified files. Only the
+// package itself is pinned, npx and uvx resolve its dependencies at spawn.
+type Package struct {
+	Registry  string `yaml:"registry" json:"registry"`                       // npm or pypi
+	Name      string `yaml:"name" json:"name"`                               // name of the package in the registry
+	Version   string `yaml:"version,omitempty" json:"version,omitempty"`     // exact version, the latest at the first fetch if empty
+	Integrity string `yaml:"integrity,omitempty" json:"integrity,omitempty"` // sha512-<base64> or sha256-<base64> of the archive
+	Bin       string `yaml:"bin,omitempty" json:"bin,omitempty"`             // program of the package, defaults to its name
+}
+
+var integrityPattern = regexp.MustCompile(`^(sha256|sha384|sha512)-[A-Za-z0-9+/]+=*$`)
+
+// key identifies the package in the lock file.
+func (pkg Package) key() string {
+	return pkg.Registry + ":" + pkg.Name
+}
+
+func (pkg Package) bin() string {
+	if pkg.Bin != "" {
+		return pkg.Bin
+	}
+	return pkg.Name[strings.LastIndex(pkg.Name, "/")+1:]
+}
+
+// argIndex returns the index of the argument naming the package, -1 if there
+// is none.
+func (pkg Package) argIndex(args []string) int {
+	separator := "@"
+	if pkg.Registry == PACKAGE_PYPI {
+		separator = "=="
+	}
+	for i, arg := range args {
+		if strings.EqualFold(arg, pkg.Name) || strings.HasPrefix(strings.ToLower(arg), strings.ToLower(pkg.Name+separator)) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Locked is the release of a package the gateway fetched and runs.
+type Locked struct {
+	Version   string `yaml:"version"`
+	Integrity string `yaml:"integrity"`
+	File      string `yaml:"file"`             // archive in the package store
+	Pinned    string `yaml:"pinned,omitempty"` // version the entry pinned when it was locked
+}
+
+// Release is a version of a package in its registry.
+type Release struct {
+	Version   string
+	URL       string
+	Integrity string
+}
+
+// PackageStore fetches the packages of entries into Dir and records what it
+// fetched in Dir/packages.lock. An entry runs the locked release until it is
+// upgraded or the entry pins another version.
+type PackageStore struct {
+	Dir         string
+	NPMRegistry string // defaults to https://registry.npmjs.org
+	PyPIIndex   string // json api, defaults to https://pypi.org/pypi
+	Client      *http.Client
+
+	mu sync.Mutex
+}
+
+var (
+	packagesMu sync.RWMutex
+	packages   = &PackageStore{Dir: "mcp_gate_packages"}
+)
+
+// SetPackageStore replaces the store entries fetch their packages into.
+func SetPackageStore(store *PackageStore) {
+	packagesMu.Lock()
+	defer packagesMu.Unlock()
+	packages = store
+}
+
+// Packages returns the store entries fetch their packages into.
+func Packages() *PackageStore {
+	packagesMu.RLock()
+	defer packagesMu.RUnlock()
+	return packages
+}
+
+func (store *PackageStore) lockPath() string {
+	return filepath.Join(store.Dir, "packages.lock")
+}
+
+func (store *PackageStore) readLock() (map[string]Locked, error) {
+	locks := map[string]Locked{}
+	data, err := os.ReadFile(store.lockPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return locks, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(data, &locks); err != nil {
+		return nil, fmt.Errorf("%s: %w", store.lockPath(), err)
+	}
+	return locks, nil
+}
+
+func (store *PackageStore) writeLock(locks map[string]Locked) error {
+	data, err := yaml.Marshal(locks)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(store.Dir, 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(store.lockPath(), data, 0644)
+}
+
+// Locked returns the release of the package the store runs, false if it was
+// not fetched yet.
+func (store *PackageStore) Locked(pkg Package) (Locked, bool, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	locks, err := store.readLock()
+	if err != nil {
+		return Locked{}, false, err
+	}
+	locked, ok := locks[pkg.key()]
+	return locked, ok, nil
+}
+
+// Fetch makes sure the release of the package the entry runs is in the
+// store: the locked one, or the pinned one if the entry pins another version
+// or integrity than it did when the package was locked.
+func (store *PackageStore) Fetch(pkg Package) (Locked, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	locks, err := store.readLock()
+	if err != nil {
+		return Locked{}, err
+	}
+	locked, ok := locks[pkg.key()]
+	if ok && locked.Pinned == pkg.Version && (pkg.Integrity == "" || pkg.Integrity == locked.Integrity) {
+		if _, err := os.Stat(locked.File); err == nil {
+			return locked, nil
+		}
+		// the archive was removed, the locked release is fetched again
+		return store.fetch(pkg, locked.Version, locked.Integrity, locks)
+	}
+	return store.fetch(pkg, pkg.Version, pkg.Integrity, locks)
+}
+
+// Upgrade locks the latest release of the package.
+func (store *PackageStore) Upgrade(pkg Package) (Locked, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	locks, err := store.readLock()
+	if err != nil {
+		return Locked{}, err
+	}
+	return store.fetch(pkg, "", "", locks)
+}
+
+// fetch downloads the version of the package, the latest one if empty, and
+// locks it. The archive has to match integrity if it is given.
+func (store *PackageStore) fetch(pkg Package, version string, integrity string, locks map[string]Locked) (Locked, error) {
+	release, err := store.Release(pkg, version)
+	if err != nil {
+		return Locked{}, err
+	}
+	if integrity == "" {
+		integrity = release.Integrity
+	}
+	if integrity == "" {
+		return Locked{}, fmt.Errorf("%s %s: the registry publishes no hash of the archive, pin its integrity", pkg.Name, release.Version)
+	}
+	file := store.archiveFile(pkg, release.URL, integrity)
+	if err := store.download(release.URL, file, integrity); err != nil {
+		return Locked{}, fmt.Errorf("%s %s: %w", pkg.Name, release.Version, err)
+	}
+	locked := Locked{Version: release.Version, Integrity: integrity, File: file, Pinned: pkg.Version}
+	locks[pkg.key()] = locked
+	if err := store.writeLock(locks); err != nil {
+		return Locked{}, err
+	}
+	log.Printf("%s %s: fetched into %s", pkg.Name, release.Version, file)
+	return locked, nil
+}
+
+func (store *PackageStore) client() *http.Client {
+	if store.Client != nil {
+		return store.Client
+	}
+	return &http.Client{Timeout: 5 * time.Minute}
+}
+
+func (store *PackageStore) getJSON(location string, value any) error {
+	request, err := http.NewRequest(http.MethodGet, location, nil)
+	if err != nil {
+		return err
+	}
+	// the abbreviated metadata of npm is enough to find a release
+	request.Header.Set("Accept", "application/vnd.npm.install-v1+json; q=1.0, application/json; q=0.8")
+	response, err := store.client().Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %s", location, response.Status)
+	}
+	return json.NewDecoder(response.Body).Decode(value)
+}
+
+// Release looks up the version of the package in its registry, the latest
+// one if version is empty.
+func (store *PackageStore) Release(pkg Package, version string) (Release, error) {
+	switch pkg.Registry {
+	case PACKAGE_NPM:
+		return store.npmRelease(pkg.Name, version)
+	case PACKAGE_PYPI:
+		return store.pypiRelease(pkg.Name, version)
+	default:
+		return Release{}, fmt.Errorf("%s: unknown package registry %q, use npm or pypi", pkg.Name, pkg.Registry)
+	}
+}
+
+func (store *PackageStore) npmRelease(name string, version string) (Release, error) {
+	registry := store.NPMRegistry
+	if registry == "" {
+		registry = "https://registry.npmjs.org"
+	}
+	var packument struct {
+		DistTags map[string]string `json:"dist-tags"`
+		Versions map[string]struct {
+			Dist struct {
+				Tarball   string `json:"tarball"`
+				Integrity string `json:"integrity"`
+			} `json:"dist"`
+		} `json:"versions"`
+	}
+	if err := store.getJSON(strings.TrimSuffix(registry, "/")+"/"+url.PathEscape(name), &packument); err != nil {
+		return Release{}, err
+	}
+	if version == "" {
+		version = packument.DistTags["latest"]
+	}
+	found, ok := packument.Versions[version]
+	if !ok {
+		return Release{}, fmt.Errorf("%s has no version %q", name, version)
+	}
+	return Release{Version: version, URL: found.Dist.Tarball, Integrity: found.Dist.Integrity}, nil
+}
+
+func (store *PackageStore) pypiRelease(name string, version string) (Release, error) {
+	index := store.PyPIIndex
+	if index == "" {
+		index = "https://pypi.org/pypi"
+	}
+	location := strings.TrimSuffix(index, "/") + "/" + url.PathEscape(name)
+	if version != "" {
+		location += "/" + url.PathEscape(version)
+	}
+	var project struct {
+		Info struct {
+			Version string `json:"version"`
+		} `json:"info"`
+		URLs []struct {
+			PackageType string            `json:"packagetype"`
+			Filename    string            `json:"filename"`
+			URL         string            `json:"url"`
+			Digests     map[string]string `json:"digests"`
+		} `json:"urls"`
+	}
+	if err := store.getJSON(location+"/json", &project); err != nil {
+		return Release{}, err
+	}
+	// a pure python wheel runs everywhere, then any wheel, then the sources
+	best := -1
+	rank := func(packageType string, filename string) int {
+		switch {
+		case packageType == "bdist_wheel" && strings.HasSuffix(filename, "-none-any.whl"):
+			return 3
+		case packageType == "bdist_wheel":
+			return 2
+		case packageType == "sdist":
+			return 1
+		}
+		return 0
+	}
+	for i, file := range project.URLs {
+		if rank(file.PackageType, file.Filename) > 0 && (best < 0 || rank(file.PackageType, file.Filename) > rank(project.URLs[best].PackageType, project.URLs[best].Filename)) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return Release{}, fmt.Errorf("%s %s has no wheel or source archive", name, project.Info.Version)
+	}
+	release := Release{Version: project.Info.Version, URL: project.URLs[best].URL}
+	if digest, err := hex.DecodeString(project.URLs[best].Digests["sha256"]); err == nil && len(digest) > 0 {
+		release.Integrity = "sha256-" + base64.StdEncoding.EncodeToString(digest)
+	}
+	return release, nil
+}
+
+// maxArchiveSize bounds the download of an archive.
+var maxArchiveSize int64 = 256 << 20
+
+// archiveFile is where the archive of a release is kept. The directory is
+// named by its integrity, so archives of the same name, like those of npm
+// packages in different scopes, do not replace each other, and uvx still gets
+// the file name it reads the version of a wheel from.
+func (store *PackageStore) archiveFile(pkg Package, location string, integrity string) string {
+	sum := sha256.Sum256([]byte(integrity))
+	name := path.Base(location)
+	if name == "." || name == ".." || name == "/" {
+		name = "archive"
+	}
+	return filepath.Join(store.Dir, pkg.Registry, hex.EncodeToString(sum[:8]), name)
+}
+
+// download writes the archive to a temporary file next to file and only
+// moves it into place once it matches the integrity.
+func (store *PackageStore) download(location string, file string, integrity string) error {
+	response, err := store.client().Get(location)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered %s", location, response.Status)
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	out, err := os.CreateTemp(filepath.Dir(file), ".download-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name())
+	written, err := io.Copy(out, io.LimitReader(response.Body, maxArchiveSize+1))
+	if err == nil && written > maxArchiveSize {
+		err = fmt.Errorf("%s is larger than %d bytes", location, maxArchiveSize)
+	}
+	if err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(out.Name(), 0644); err != nil {
+		return err
+	}
+	if err := verify(out.Name(), integrity); err != nil {
+		var mismatch *IntegrityError
+		if errors.As(err, &mismatch) {
+			mismatch.File = location
+		}
+		return err
+	}
+	return os.Rename(out.Name(), file)
+}
+
+// IntegrityError reports an archive that does not match its hash.
+type IntegrityError struct {
+	File     string
+	Expected string
+	Actual   string
+}
+
+func (e *IntegrityError) Error() string {
+	return fmt.Sprintf("%s does not match its integrity hash, expected %s, got %s", e.File, e.Expected, e.Actual)
+}
+
+// verify checks the file against a subresource integrity value. Of several
+// space separated hashes one has to match.
+func verify(file string, integrity string) error {
+	var actual []string
+	for _, expected := range strings.Fields(integrity) {
+		if !integrityPattern.MatchString(expected) {
+			return fmt.Errorf("invalid integrity %q, use sha256-, sha384- or sha512- and the base64 hash", expected)
+		}
+		algorithm, _, _ := strings.Cut(expected, "-")
+		sum, err := fileHash(file, algorithm)
+		if err != nil {
+			return err
+		}
+		if sum == expected {
+			return nil
+		}
+		actual = append(actual, sum)
+	}
+	return &IntegrityError{File: file, Expected: integrity, Actual: strings.Join(actual, " ")}
+}
+
+func fileHash(file string, algorithm string) (string, error) {
+	var digest hash.Hash
+	switch algorithm {
+	case "sha256":
+		digest = sha256.New()
+	case "sha384":
+		digest = sha512.New384()
+	default:
+		digest = sha512.New()
+	}
+	in, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	if _, err := io.Copy(digest, in); err != nil {
+		return "", err
+	}
+	return algorithm + "-" + base64.StdEncoding.EncodeToString(digest.Sum(nil)), nil
+}
+
+// Prepare fetches the package of the entry if needed, verifies the archive
+// against the locked hash and returns the entry running it: npx runs the
+// tarball with --package, uvx the wheel or sources with --from.
+func (store *PackageStore) Prepare(entry RepositoryEntry) (RepositoryEntry, error) {
+	pkg := entry.Package
+	if pkg == nil {
+		return entry, nil
+	}
+	if err := checkSandboxedPackage(entry); err != nil {
+		return entry, err
+	}
+	locked, err := store.Fetch(*pkg)
+	if err != nil {
+		return entry, err
+	}
+	if err := verify(locked.File, locked.Integrity); err != nil {
+		return entry, fmt.Errorf("%s: %w, not starting it", entry.Name, err)
+	}
+	file, err := filepath.Abs(locked.File)
+	if err != nil {
+		return entry, err
+	}
+	i := pkg.argIndex(entry.Args)
+	if i < 0 {
+		return entry, fmt.Errorf("%s: no argument names the package %s", entry.Name, pkg.Name)
+	}
+	replacement := []string{"--package=" + file, pkg.bin()}
+	if pkg.Registry == PACKAGE_PYPI {
+		replacement = []string{"--from", file, pkg.bin()}
+	}
+	prepared := entry
+	prepared.Args = append(append(append([]string{}, entry.Args[:i]...), replacement...), entry.Args[i+1:]...)
+	return prepared, nil
+}
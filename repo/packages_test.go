@@ -0,0 +1,205 @@
+package repo
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func sri(data []byte) string {
+	sum := sha512.Sum512(data)
+	return "sha512-" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// npmRegistry serves the versions of @example/weather, latest is the last one.
+func npmRegistry(t *testing.T, versions ...string) *httptest.Server {
+	mux := http.NewServeMux()
+	var server *httptest.Server
+	mux.HandleFunc("/@example%2fweather", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"dist-tags": {"latest": %q}, "versions": {`, versions[len(versions)-1])
+		for i, version := range versions {
+			if i > 0 {
+				fmt.Fprint(w, ",")
+			}
+			fmt.Fprintf(w, `%q: {"dist": {"tarball": "%s/weather-%s.tgz", "integrity": %q}}`,
+				version, server.URL, version, sri([]byte("weather "+version)))
+		}
+		fmt.Fprint(w, "}}")
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		var version string
+		if _, err := fmt.Sscanf(r.URL.Path, "/weather-%s", &version); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, "weather "+version[:len(version)-len(".tgz")])
+	})
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestFetchAndPrepare(t *testing.T) {
+	registry := npmRegistry(t, "1.0.0", "1.1.0")
+	store := &PackageStore{Dir: t.TempDir(), NPMRegistry: registry.URL}
+	entry := RepositoryEntry{
+		Name:      "weather",
+		Transport: "ipc",
+		Command:   "npx",
+		Args:      []string{"-y", "@example/weather@1.0.0", "--units", "metric"},
+		Package:   &Package{Registry: PACKAGE_NPM, Name: "@example/weather", Version: "1.0.0"},
+	}
+	prepared, err := store.Prepare(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, _ := filepath.Abs(store.archiveFile(*entry.Package, registry.URL+"/weather-1.0.0.tgz", sri([]byte("weather 1.0.0"))))
+	if filepath.Base(file) != "weather-1.0.0.tgz" {
+		t.Errorf("expected the archive to keep its name, got %s", file)
+	}
+	expected := []string{"-y", "--package=" + file, "weather", "--units", "metric"}
+	if !reflect.DeepEqual(prepared.Args, expected) {
+		t.Errorf("expected args %v, got %v", expected, prepared.Args)
+	}
+
+	// a changed archive is not started
+	if err := os.WriteFile(file, []byte("tampered"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var mismatch *IntegrityError
+	if _, err := store.Prepare(entry); !errors.As(err, &mismatch) {
+		t.Errorf("expected an integrity error, got %v", err)
+	}
+
+	locked, err := store.Upgrade(*entry.Package)
+	if err != nil || locked.Version != "1.1.0" {
+		t.Fatalf("expected an upgrade to 1.1.0, got %v, %v", locked, err)
+	}
+	if locked, err := store.Fetch(*entry.Package); err != nil || locked.Version != "1.1.0" {
+		t.Errorf("expected the upgrade to be kept, got %v, %v", locked, err)
+	}
+	// the lock holds until the entry pins another version
+	entry.Package.Version = ""
+	if locked, err := store.Fetch(*entry.Package); err != nil || locked.Version != "1.1.0" {
+		t.Errorf("expected the latest version, got %v, %v", locked, err)
+	}
+	entry.Package.Version, entry.Package.Integrity = "1.0.0", sri([]byte("something else"))
+	if _, err := store.Fetch(*entry.Package); !errors.As(err, &mismatch) {
+		t.Errorf("expected the pinned integrity to be checked, got %v", err)
+	}
+	// a changed integrity of the locked version is checked as well
+	entry.Package.Integrity = sri([]byte("weather 1.0.0"))
+	if locked, err := store.Fetch(*entry.Package); err != nil || locked.Version != "1.0.0" {
+		t.Fatalf("expected 1.0.0 to be locked, got %v, %v", locked, err)
+	}
+	entry.Package.Integrity = sri([]byte("something else"))
+	if _, err := store.Fetch(*entry.Package); !errors.As(err, &mismatch) {
+		t.Errorf("expected the changed integrity to be checked, got %v", err)
+	}
+}
+
+func TestArchivesOfTheSameNameAreKeptApart(t *testing.T) {
+	store := &PackageStore{Dir: t.TempDir()}
+	scoped := store.archiveFile(Package{Registry: PACKAGE_NPM, Name: "@example/weather"}, "https://registry.npmjs.org/@example/weather/-/weather-1.0.0.tgz", sri([]byte("scoped")))
+	plain := store.archiveFile(Package{Registry: PACKAGE_NPM, Name: "weather"}, "https://registry.npmjs.org/weather/-/weather-1.0.0.tgz", sri([]byte("plain")))
+	if scoped == plain {
+		t.Errorf("expected the archives of different packages in different files, got %s", scoped)
+	}
+}
+
+func TestDownloadIsBounded(t *testing.T) {
+	registry := npmRegistry(t, "1.0.0")
+	store := &PackageStore{Dir: t.TempDir(), NPMRegistry: registry.URL}
+	defer func(size int64) { maxArchiveSize = size }(maxArchiveSize)
+	maxArchiveSize = 4
+
+	if _, err := store.Fetch(Package{Registry: PACKAGE_NPM, Name: "@example/weather"}); err == nil {
+		t.Fatal("expected an archive larger than the limit to be refused")
+	}
+	var files []string
+	filepath.WalkDir(store.Dir, func(path string, entry os.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if len(files) != 0 {
+		t.Errorf("expected no archive to be left behind, found %v", files)
+	}
+}
+
+func TestPyPIRelease(t *testing.T) {
+	wheel := []byte("wheel")
+	sum := sha256.Sum256(wheel)
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/mcp-server-time/json":
+			fmt.Fprintf(w, `{"info": {"version": "0.6.2"}, "urls": [
+				{"packagetype": "sdist", "filename": "mcp_server_time-0.6.2.tar.gz", "url": "%[1]s/files/mcp_server_time-0.6.2.tar.gz", "digests": {"sha256": "00"}},
+				{"packagetype": "bdist_wheel", "filename": "mcp_server_time-0.6.2-py3-none-any.whl", "url": "%[1]s/files/mcp_server_time-0.6.2-py3-none-any.whl", "digests": {"sha256": %[2]q}}]}`,
+				server.URL, hex.EncodeToString(sum[:]))
+		case "/files/mcp_server_time-0.6.2-py3-none-any.whl":
+			w.Write(wheel)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	store := &PackageStore{Dir: t.TempDir(), PyPIIndex: server.URL}
+	entry := RepositoryEntry{
+		Name:      "time",
+		Transport: "ipc",
+		Command:   "uvx",
+		Args:      []string{"mcp-server-time", "--local-timezone=UTC"},
+		Package:   &Package{Registry: PACKAGE_PYPI, Name: "mcp-server-time"},
+	}
+	prepared, err := store.Prepare(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	integrity := "sha256-" + base64.StdEncoding.EncodeToString(sum[:])
+	file, _ := filepath.Abs(store.archiveFile(*entry.Package, server.URL+"/files/mcp_server_time-0.6.2-py3-none-any.whl", integrity))
+	expected := []string{"--from", file, "mcp-server-time", "--local-timezone=UTC"}
+	if !reflect.DeepEqual(prepared.Args, expected) {
+		t.Errorf("expected args %v, got %v", expected, prepared.Args)
+	}
+}
+
+func TestValidatePackage(t *testing.T) {
+	_, err := parseEntries("catalog.yaml", []byte(`- name: weather
+  transport: ipc
+  command: npx
+  args: ["-y", "@example/other"]
+  package:
+    registry: npm
+    name: "@example/weather"
+    integrity: md5-abc
+`))
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	expected := []string{
+		"weather: no argument names the package @example/weather",
+		`weather: invalid integrity "md5-abc", use sha256-, sha384- or sha512- and the base64 hash`,
+		"weather: an integrity needs the version it belongs to",
+	}
+	if len(invalid.Problems) != len(expected) {
+		t.Fatalf("expected %d problems, got %v", len(expected), invalid)
+	}
+	for i, problem := range invalid.Problems {
+		if problem.Message != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], problem.Message)
+		}
+	}
+}
@@ -0,0 +1,356 @@
+package repo
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// ServerJSON is a server described in the server.json format of the MCP
+// Registry. Only the fields needed to start the server are read.
+type ServerJSON struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Version     string `json:"version"`
+	WebsiteURL  string `json:"websiteUrl"`
+	Repository  struct {
+		URL string `json:"url"`
+	} `json:"repository"`
+	Packages []RegistryPackage `json:"packages"`
+	Remotes  []RegistryRemote  `json:"remotes"`
+}
+
+// RegistryPackage is a package a server is distributed as.
+type RegistryPackage struct {
+	RegistryType         string             `json:"registryType"` // npm, pypi, oci, nuget or mcpb
+	Identifier           string             `json:"identifier"`
+	Version              string             `json:"version"`
+	RuntimeHint          string             `json:"runtimeHint"`
+	Transport            RegistryTransport  `json:"transport"`
+	RuntimeArguments     []RegistryArgument `json:"runtimeArguments"`
+	PackageArguments     []RegistryArgument `json:"packageArguments"`
+	EnvironmentVariables []RegistryInput    `json:"environmentVariables"`
+}
+
+// RegistryTransport is how a package or remote is connected to.
+type RegistryTransport struct {
+	Type string `json:"type"` // stdio, streamable-http or sse
+	URL  string `json:"url"`
+}
+
+// RegistryRemote is a hosted endpoint of a server.
+type RegistryRemote struct {
+	Type    string          `json:"type"` // streamable-http or sse
+	URL     string          `json:"url"`
+	Headers []RegistryInput `json:"headers"`
+}
+
+// RegistryInput is a value of an argument, environment variable or header.
+// `{name}` placeholders in the value are filled in from Variables.
+type RegistryInput struct {
+	Name        string                   `json:"name"`
+	Value       string                   `json:"value"`
+	Default     string                   `json:"default"`
+	Description string                   `json:"description"`
+	IsRequired  bool                     `json:"isRequired"`
+	IsSecret    bool                     `json:"isSecret"`
+	Variables   map[string]RegistryInput `json:"variables"`
+}
+
+// RegistryArgument is a positional or named command line argument.
+type RegistryArgument struct {
+	RegistryInput
+	Type      string `json:"type"` // positional or named
+	ValueHint string `json:"valueHint"`
+}
+
+// errUnsupportedServer is returned for servers that only come as packages or
+// remotes the gateway cannot start.
+var errUnsupportedServer = errors.New("no npm, pypi or oci package with stdio transport and no streamable-http remote")
+
+var placeholder = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// resolve fills in the placeholders of the value. A placeholder without a
+// value or default becomes a reference to the environment variable of its
+// name, expanded when the server is started.
+func (input RegistryInput) resolve() string {
+	value := input.Value
+	if value == "" {
+		value = input.Default
+	}
+	return placeholder.ReplaceAllStringFunc(value, func(match string) string {
+		name := match[1 : len(match)-1]
+		variable, ok := input.Variables[name]
+		if !ok {
+			return match
+		}
+		if resolved := variable.resolve(); resolved != "" {
+			return resolved
+		}
+		return "${env:" + name + "}"
+	})
+}
+
+// requirements lists the placeholders of the value that are taken from the
+// environment of the gateway.
+func requirements(input RegistryInput) []ConfigRequirement {
+	var required []ConfigRequirement
+	value := input.Value
+	if value == "" {
+		value = input.Default
+	}
+	for _, match := range placeholder.FindAllStringSubmatch(value, -1) {
+		if variable, ok := input.Variables[match[1]]; ok && variable.resolve() == "" {
+			required = append(required, ConfigRequirement{Name: match[1], Description: variable.Description, Secret: variable.IsSecret})
+		}
+	}
+	return required
+}
+
+func (argument RegistryArgument) args() []string {
+	value := argument.resolve()
+	switch argument.Type {
+	case "named":
+		if value == "" {
+			return []string{argument.Name}
+		}
+		return []string{argument.Name, value}
+	default:
+		if value == "" && argument.IsRequired && argument.ValueHint != "" {
+			value = "${env:" + argument.ValueHint + "}"
+		}
+		if value == "" {
+			return nil
+		}
+		return []string{value}
+	}
+}
+
+func registryArgs(arguments []RegistryArgument) []string {
+	var args []string
+	for _, argument := range arguments {
+		args = append(args, argument.args()...)
+	}
+	return args
+}
+
+// EntryName derives the catalog name of a registry server from the last part
+// of its reverse-DNS name, `io.github.example/weather` becomes `weather`.
+func EntryName(serverName string) string {
+	return serverName[strings.LastIndex(serverName, "/")+1:]
+}
+
+// Entry maps the server onto a catalog entry. The first package that can be
+// run locally is used, a streamable-http remote otherwise.
+func (server ServerJSON) Entry() (RepositoryEntry, error) {
+	entry := RepositoryEntry{Name: EntryName(server.Name), Description: server.Description, Version: server.Version, Homepage: server.WebsiteURL}
+	if entry.Name == "" {
+		return entry, errors.New("server has no name")
+	}
+	if entry.Homepage == "" {
+		entry.Homepage = server.Repository.URL
+	}
+	for _, pkg := range server.Packages {
+		if pkg.Transport.Type != "" && pkg.Transport.Type != "stdio" {
+			continue
+		}
+		if packageEntry(&entry, pkg) {
+			return entry, nil
+		}
+	}
+	for _, remote := range server.Remotes {
+		if remote.Type != "streamable-http" {
+			continue
+		}
+		url := RegistryInput{Value: remote.URL}.resolve()
+		entry.Transport, entry.URL = "http", &url
+		for _, header := range remote.Headers {
+			entry.RequiredConfig = append(entry.RequiredConfig, requirements(header)...)
+			if value := header.resolve(); value != "" {
+				if entry.Headers == nil {
+					entry.Headers = map[string]string{}
+				}
+				entry.Headers[header.Name] = value
+			}
+		}
+		return entry, nil
+	}
+	return entry, fmt.Errorf("%s: %w", server.Name, errUnsupportedServer)
+}
+
+// packageEntry sets the command of a package, it returns false for registry
+// types the gateway cannot run.
+func packageEntry(entry *RepositoryEntry, pkg RegistryPackage) bool {
+	var env []string
+	var required []ConfigRequirement
+	for _, variable := range pkg.EnvironmentVariables {
+		// variables without a value are taken from the environment of the gateway
+		if value := variable.resolve(); value != "" {
+			env = append(env, variable.Name+"="+value)
+			required = append(required, requirements(variable)...)
+		} else if variable.IsRequired {
+			required = append(required, ConfigRequirement{Name: variable.Name, Description: variable.Description, Secret: variable.IsSecret})
+		}
+	}
+	for _, argument := range append(pkg.RuntimeArguments, pkg.PackageArguments...) {
+		required = append(required, requirements(argument.RegistryInput)...)
+		if argument.Type != "named" && argument.resolve() == "" && argument.IsRequired && argument.ValueHint != "" {
+			// taken from the environment variable named by the hint
+			required = append(required, ConfigRequirement{Name: argument.ValueHint, Description: argument.Description, Secret: argument.IsSecret})
+		}
+	}
+	args := registryArgs(pkg.RuntimeArguments)
+	switch pkg.RegistryType {
+	case "npm":
+		entry.Command = "npx"
+		if !contains(args, "-y") && !contains(args, "--yes") {
+			args = append(args, "-y")
+		}
+		args = append(args, versioned(pkg.Identifier, "@", pkg.Version))
+		entry.Package = &Package{Registry: PACKAGE_NPM, Name: pkg.Identifier, Version: pinned(pkg.Version)}
+	case "pypi":
+		entry.Command = "uvx"
+		args = append(args, versioned(pkg.Identifier, "==", pkg.Version))
+		entry.Package = &Package{Registry: PACKAGE_PYPI, Name: pkg.Identifier, Version: pinned(pkg.Version)}
+	case "oci":
+		// the runtime arguments are options of docker run
+		image := pkg.Identifier
+		if pkg.Version != "" && !strings.Contains(image[strings.LastIndex(image, "/")+1:], ":") && !strings.Contains(image, "@") {
+			image += ":" + pkg.Version
+		}
+		// the container only sees the variables passed on to it
+		for _, variable := range pkg.EnvironmentVariables {
+			if variable.resolve() == "" && !variable.IsRequired {
+				env = append(env, variable.Name+"=${env:"+variable.Name+"}")
+			}
+		}
+		entry.Transport = "container"
+		entry.Container = &Container{Image: image, Options: args}
+		if pkg.RuntimeHint == RUNTIME_DOCKER || pkg.RuntimeHint == RUNTIME_PODMAN {
+			entry.Container.Runtime = pkg.RuntimeHint
+		}
+		entry.Args = registryArgs(pkg.PackageArguments)
+		entry.Env = env
+		entry.RequiredConfig = required
+		return true
+	default:
+		return false
+	}
+	if pkg.RuntimeHint != "" {
+		entry.Command = pkg.RuntimeHint
+	}
+	entry.Transport = "ipc"
+	entry.Args = append(args, registryArgs(pkg.PackageArguments)...)
+	entry.Env = env
+	entry.RequiredConfig = required
+	entry.Dependencies = []Dependency{{Name: entry.Command}}
+	return true
+}
+
+func versioned(identifier string, separator string, version string) string {
+	if version == "" || version == "latest" {
+		return identifier
+	}
+	return identifier + separator + version
+}
+
+// pinned returns the version a package entry pins, empty for the latest.
+func pinned(version string) string {
+	if version == "latest" {
+		return ""
+	}
+	return version
+}
+
+func contains(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+	return false
+}
+
+// registryResponse is a page of the server list of a registry, each server
+// either plain or wrapped with its registry metadata.
+type registryResponse struct {
+	Servers  []json.RawMessage `json:"servers"`
+	Metadata struct {
+		NextCursor string `json:"nextCursor"`
+	} `json:"metadata"`
+}
+
+type wrappedServer struct {
+	Server *ServerJSON    `json:"server"`
+	Meta   map[string]any `json:"_meta"`
+}
+
+// outdated reports whether the registry marks the server as deleted or a
+// later version of it exists.
+func (wrapped wrappedServer) outdated() bool {
+	official, _ := wrapped.Meta["io.modelcontextprotocol.registry/official"].(map[string]any)
+	return official["status"] == "deleted" || official["isLatest"] == false
+}
+
+// parseRegistry reads a server.json file or a server list of a registry.
+// Servers the gateway cannot start are skipped.
+func parseRegistry(data []byte) ([]RepositoryEntry, error) {
+	var page registryResponse
+	if err := json.Unmarshal(data, &page); err != nil {
+		return nil, err
+	}
+	if page.Servers == nil {
+		var server ServerJSON
+		if err := json.Unmarshal(data, &server); err != nil {
+			return nil, err
+		}
+		entry, err := server.Entry()
+		if err != nil {
+			return nil, err
+		}
+		return []RepositoryEntry{entry}, nil
+	}
+	return serverEntries(page.Servers)
+}
+
+func serverEntries(servers []json.RawMessage) ([]RepositoryEntry, error) {
+	var entries []RepositoryEntry
+	index := map[string]int{}
+	for _, raw := range servers {
+		var wrapped wrappedServer
+		if err := json.Unmarshal(raw, &wrapped); err != nil {
+			return nil, err
+		}
+		if wrapped.Server == nil {
+			wrapped.Server = &ServerJSON{}
+			if err := json.Unmarshal(raw, wrapped.Server); err != nil {
+				return nil, err
+			}
+		}
+		if wrapped.outdated() {
+			continue
+		}
+		entry, err := wrapped.Server.Entry()
+		if err != nil {
+			log.Printf("registry server skipped: %v", err)
+			continue
+		}
+		// the list holds every version, a later one replaces an earlier one
+		if i, ok := index[entry.Name]; ok {
+			entries[i] = entry
+		} else {
+			index[entry.Name] = len(entries)
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// isRegistryJSON tells a server.json or registry response from a yaml catalog.
+func isRegistryJSON(data []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(data), []byte("{"))
+}
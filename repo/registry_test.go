@@ -0,0 +1,226 @@
+package repo
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const weatherServer = `{
+  "$schema": "https://static.modelcontextprotocol.io/schemas/2025-09-29/server.schema.json",
+  "name": "io.github.example/weather",
+  "description": "Weather forecasts",
+  "version": "1.2.0",
+  "repository": {"url": "https://github.com/example/weather", "source": "github"},
+  "packages": [
+    {
+      "registryType": "nuget",
+      "identifier": "Example.Weather",
+      "version": "1.2.0",
+      "transport": {"type": "stdio"}
+    },
+    {
+      "registryType": "npm",
+      "identifier": "@example/weather",
+      "version": "1.2.0",
+      "transport": {"type": "stdio"},
+      "packageArguments": [
+        {"type": "named", "name": "--units", "value": "metric"},
+        {"type": "positional", "value": "{dir}", "variables": {"dir": {"default": "/tmp"}}},
+        {"type": "named", "name": "--verbose"}
+      ],
+      "environmentVariables": [
+        {"name": "WEATHER_API_KEY", "description": "API key of the weather service", "isRequired": true, "isSecret": true},
+        {"name": "WEATHER_REGION", "default": "eu"}
+      ]
+    }
+  ]
+}`
+
+func TestServerJSONPackage(t *testing.T) {
+	entries, err := parseEntries("weather.json", []byte(weatherServer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := RepositoryEntry{
+		Name:         "weather",
+		Description:  "Weather forecasts",
+		Transport:    "ipc",
+		Command:      "npx",
+		Args:         []string{"-y", "@example/weather@1.2.0", "--units", "metric", "/tmp", "--verbose"},
+		Env:          []string{"WEATHER_REGION=eu"},
+		Dependencies: []Dependency{{Name: "npx"}},
+		Package:      &Package{Registry: PACKAGE_NPM, Name: "@example/weather", Version: "1.2.0"},
+		Version:      "1.2.0",
+		Homepage:     "https://github.com/example/weather",
+		RequiredConfig: []ConfigRequirement{
+			{Name: "WEATHER_API_KEY", Description: "API key of the weather service", Secret: true},
+		},
+	}
+	if len(entries) != 1 || !reflect.DeepEqual(entries[0], expected) {
+		t.Errorf("expected %+v, got %+v", expected, entries)
+	}
+}
+
+func TestServerJSONPackageTypes(t *testing.T) {
+	tests := []struct {
+		pkg     RegistryPackage
+		command string
+		args    []string
+	}{
+		{RegistryPackage{RegistryType: "pypi", Identifier: "mcp-server-time", Version: "0.6.2"}, "uvx", []string{"mcp-server-time==0.6.2"}},
+		{RegistryPackage{RegistryType: "npm", Identifier: "weather", RuntimeHint: "bunx",
+			RuntimeArguments: []RegistryArgument{{Type: "named", RegistryInput: RegistryInput{Name: "--yes"}}}}, "bunx", []string{"--yes", "weather"}},
+	}
+	for _, test := range tests {
+		entry, err := ServerJSON{Name: "example/server", Packages: []RegistryPackage{test.pkg}}.Entry()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry.Command != test.command || !reflect.DeepEqual(entry.Args, test.args) {
+			t.Errorf("%s: expected %s %v, got %s %v", test.pkg.RegistryType, test.command, test.args, entry.Command, entry.Args)
+		}
+	}
+}
+
+func TestServerJSONContainer(t *testing.T) {
+	tests := []struct {
+		pkg      RegistryPackage
+		expected Container
+		env      []string
+	}{
+		{RegistryPackage{RegistryType: "oci", Identifier: "ghcr.io/example/weather", Version: "1.2.0",
+			EnvironmentVariables: []RegistryInput{{Name: "API_KEY"}}}, Container{Image: "ghcr.io/example/weather:1.2.0"}, []string{"API_KEY=${env:API_KEY}"}},
+		{RegistryPackage{RegistryType: "oci", Identifier: "localhost:5000/weather:edge", Version: "1.2.0", RuntimeHint: "podman",
+			RuntimeArguments: []RegistryArgument{{Type: "named", RegistryInput: RegistryInput{Name: "--memory", Value: "512m"}}}},
+			Container{Image: "localhost:5000/weather:edge", Runtime: "podman", Options: []string{"--memory", "512m"}}, nil},
+	}
+	for _, test := range tests {
+		entry, err := ServerJSON{Name: "example/server", Packages: []RegistryPackage{test.pkg}}.Entry()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if entry.Transport != "container" || entry.Container == nil || !reflect.DeepEqual(*entry.Container, test.expected) || !reflect.DeepEqual(entry.Env, test.env) {
+			t.Errorf("%s: expected a container entry of %+v with env %v, got %+v", test.pkg.Identifier, test.expected, test.env, entry)
+		}
+	}
+}
+
+func TestServerJSONRemote(t *testing.T) {
+	server := ServerJSON{
+		Name: "com.example/search",
+		Packages: []RegistryPackage{
+			{RegistryType: "npm", Identifier: "search", Transport: RegistryTransport{Type: "streamable-http"}},
+		},
+		Remotes: []RegistryRemote{
+			{Type: "sse", URL: "https://example.com/sse"},
+			{Type: "streamable-http", URL: "https://{tenant}.example.com/mcp", Headers: []RegistryInput{
+				{Name: "Authorization", Value: "Bearer {token}", Variables: map[string]RegistryInput{"token": {IsRequired: true, IsSecret: true}}},
+			}},
+		},
+	}
+	entry, err := server.Entry()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.Transport != "http" || *entry.URL != "https://{tenant}.example.com/mcp" {
+		t.Errorf("unexpected remote %+v", entry)
+	}
+	if entry.Headers["Authorization"] != "Bearer ${env:token}" {
+		t.Errorf("unexpected headers %v", entry.Headers)
+	}
+	if len(entry.RequiredConfig) != 1 || entry.RequiredConfig[0] != (ConfigRequirement{Name: "token", Secret: true}) {
+		t.Errorf("unexpected required config %v", entry.RequiredConfig)
+	}
+
+	if _, err := (ServerJSON{Name: "example/bundle", Packages: []RegistryPackage{{RegistryType: "mcpb"}}}).Entry(); err == nil {
+		t.Error("expected an error for a server that cannot be started")
+	}
+}
+
+func TestRegistrySource(t *testing.T) {
+	pages := map[string]string{
+		"": `{"servers": [
+			{"server": {"name": "example/time", "version": "1.0.0", "packages": [{"registryType": "pypi", "identifier": "time", "version": "1.0.0"}]},
+			 "_meta": {"io.modelcontextprotocol.registry/official": {"isLatest": false}}},
+			{"server": {"name": "example/bundle", "packages": [{"registryType": "mcpb", "identifier": "bundle"}]}}
+		], "metadata": {"nextCursor": "2"}}`,
+		"2": `{"servers": [
+			{"server": {"name": "example/time", "version": "1.1.0", "packages": [{"registryType": "pypi", "identifier": "time", "version": "1.1.0"}]},
+			 "_meta": {"io.modelcontextprotocol.registry/official": {"isLatest": true}}},
+			{"server": {"name": "example/gone", "packages": [{"registryType": "npm", "identifier": "gone"}]},
+			 "_meta": {"io.modelcontextprotocol.registry/official": {"status": "deleted"}}}
+		], "metadata": {}}`,
+	}
+	available := true
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !available || r.URL.Path != "/v0/servers" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(pages[r.URL.Query().Get("cursor")]))
+	}))
+	defer registry.Close()
+
+	// read the registry on every load to use the kept list only while it is unavailable
+	sources, err := SourcesFromConfig([]SourceConfig{{Type: SOURCE_REGISTRY, URL: registry.URL + "/", Refresh: time.Nanosecond}}, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, state := range []string{"available", "unavailable"} {
+		available = state == "available"
+		entries, err := sources[0].Load()
+		if err != nil {
+			t.Fatalf("%s: %v", state, err)
+		}
+		if len(entries) != 1 || entries[0].Name != "time" || entries[0].Args[0] != "time==1.1.0" {
+			t.Errorf("%s: unexpected entries %+v", state, entries)
+		}
+	}
+}
+
+func TestRegistryListIsKeptUntilRefresh(t *testing.T) {
+	requests := 0
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`{"servers": [{"server": {"name": "example/time", "packages": [{"registryType": "pypi", "identifier": "time"}]}}], "metadata": {}}`))
+	}))
+	defer registry.Close()
+
+	sources, err := SourcesFromConfig([]SourceConfig{{Type: SOURCE_REGISTRY, URL: registry.URL}}, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if entries, err := sources[0].Load(); err != nil || len(entries) != 1 {
+			t.Fatalf("unexpected entries %+v, %v", entries, err)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("Expected the registry to be read once within refresh, got %d requests", requests)
+	}
+}
+
+func TestServerJSONInDir(t *testing.T) {
+	dir := t.TempDir()
+	writeCatalog(t, dir, "weather.json", weatherServer)
+	writeCatalog(t, dir, "local.yaml", "- name: fetch\n  transport: ipc\n  command: uvx\n")
+	entries, err := loadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Name != "fetch" || entries[1].Name != "weather" {
+		data, _ := json.Marshal(entries)
+		t.Errorf("unexpected entries %s", data)
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("WEATHER_TOKEN", "secret")
+	if expanded := ExpandEnv("Bearer ${env:WEATHER_TOKEN} $HOME ${HOME}"); expanded != "Bearer secret $HOME ${HOME}" {
+		t.Errorf("unexpected expansion %q", expanded)
+	}
+}
@@ -2,6 +2,10 @@ package repo
 
 import (
 	_ "embed"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -10,25 +14,218 @@ import (
 var repo_tools_yaml []byte
 
 type RepositoryEntry struct {
-	Name         string   `yaml:"name"`
-	Description  string   `yaml:"description"`
-	Transport    string   `yaml:"transport"`
-	URL          *string  `yaml:"url,omitempty"`     // Optional, used for HTTP transport
-	Command      string   `yaml:"command,omitempty"` // Optional, used for ipc transport
-	Args         []string `yaml:"args,omitempty"`    // Optional, used for ipc transport
-	Dependencies []string `yaml:"dependencies,omitempty"`
-	Platforms    []string `yaml:"platforms,omitempty"`
+	Name           string              `yaml:"name"`
+	Description    string              `yaml:"description"`
+	Transport      string              `yaml:"transport"`
+	URL            *string             `yaml:"url,omitempty"`                       // Optional, used for HTTP transport
+	Command        string              `yaml:"command,omitempty"`                   // Optional, used for ipc transport
+	Args           []string            `yaml:"args,omitempty"`                      // Optional, used for ipc transport
+	Env            []string            `yaml:"env,omitempty" json:",omitempty"`     // Optional, NAME=value environment of an ipc upstream
+	Headers        map[string]string   `yaml:"headers,omitempty" json:",omitempty"` // Optional, sent with every request to a http upstream
+	Dependencies   []Dependency        `yaml:"dependencies,omitempty"`
+	Container      *Container          `yaml:"container,omitempty" json:",omitempty"` // Optional, the image of a container upstream
+	Sandbox        *Sandbox            `yaml:"sandbox,omitempty" json:",omitempty"`   // Optional, confines an ipc upstream on linux
+	Package        *Package            `yaml:"package,omitempty" json:",omitempty"`   // Optional, the npm or pypi package an ipc upstream runs, fetched and verified by the gateway
+	Platforms      []string            `yaml:"platforms,omitempty"`
+	Timeouts       Timeouts            `yaml:"timeouts,omitempty"`
+	Concurrency    Concurrency         `yaml:"concurrency,omitempty"`
+	Breaker        Breaker             `yaml:"circuit_breaker,omitempty"`
+	Cache          Cache               `yaml:"cache,omitempty"`
+	Replicas       Replicas            `yaml:"replicas,omitempty"`
+	HealthCheck    HealthCheck         `yaml:"health_check,omitempty"`
+	Version        string              `yaml:"version,omitempty" json:",omitempty"`
+	Tags           []string            `yaml:"tags,omitempty" json:",omitempty"`
+	Homepage       string              `yaml:"homepage,omitempty" json:",omitempty"`
+	License        string              `yaml:"license,omitempty" json:",omitempty"`
+	Author         string              `yaml:"author,omitempty" json:",omitempty"`
+	RequiredConfig []ConfigRequirement `yaml:"required_config,omitempty" json:",omitempty"` // settings the user has to provide
+	Inputs         []Input             `yaml:"inputs,omitempty" json:",omitempty"`          // values the user supplies when installing the entry
+	With           map[string]string   `yaml:"with,omitempty" json:",omitempty"`            // the values of the inputs
+	Source         string              `yaml:"-" json:"-"`                                  // catalog source the entry was read from
 }
 
+// ConfigRequirement is an environment variable a server needs, for example
+// an API key.
+type ConfigRequirement struct {
+	Name        string `yaml:"name" json:"name"`
+	Description string `yaml:"description,omitempty" json:"description,omitempty"`
+	Secret      bool   `yaml:"secret,omitempty" json:"secret,omitempty"`
+}
+
+// Timeouts configures how long the gateway waits for an upstream server.
+// A zero value falls back to the gateway default.
+type Timeouts struct {
+	Connect    time.Duration            `yaml:"connect,omitempty" mapstructure:"connect"`
+	Initialize time.Duration            `yaml:"initialize,omitempty" mapstructure:"initialize"`
+	List       time.Duration            `yaml:"list,omitempty" mapstructure:"list"`
+	Call       time.Duration            `yaml:"call,omitempty" mapstructure:"call"`
+	Tools      map[string]time.Duration `yaml:"tools,omitempty" mapstructure:"tools"` // call timeouts by tool name pattern
+}
+
+// Concurrency limits how many calls the gateway sends to an upstream at once.
+// Calls above the limit wait in a FIFO queue of QueueSize entries.
+type Concurrency struct {
+	MaxInFlight  int           `yaml:"max_in_flight,omitempty"` // 0 means unlimited
+	QueueSize    int           `yaml:"queue_size,omitempty"`
+	QueueTimeout time.Duration `yaml:"queue_timeout,omitempty"` // 0 means wait as long as the call may take
+}
+
+// Replicas runs an upstream as a pool of equivalent endpoints, either several
+// urls of a http upstream or several processes of an ipc upstream.
+type Replicas struct {
+	Count    int      `yaml:"count,omitempty"`    // processes of an ipc upstream
+	URLs     []string `yaml:"urls,omitempty"`     // endpoints of a http upstream, replaces url
+	Strategy string   `yaml:"strategy,omitempty"` // round_robin (default) or least_loaded
+	Affinity bool     `yaml:"affinity,omitempty"` // keep each client session on one replica
+}
+
+// HealthCheck configures the pings the gateway sends to an upstream. A zero
+// value falls back to the gateway default.
+type HealthCheck struct {
+	Interval     time.Duration `yaml:"interval,omitempty" mapstructure:"interval"`           // time between pings
+	Timeout      time.Duration `yaml:"timeout,omitempty" mapstructure:"timeout"`             // defaults to the interval
+	RestartAfter int           `yaml:"restart_after,omitempty" mapstructure:"restart_after"` // failed pings before a restart, 0 never restarts
+}
+
+// Cache configures response caching for an upstream once the gateway cache is
+// enabled. Tools annotated as read-only or idempotent are always cached.
+type Cache struct {
+	Disabled  bool          `yaml:"disabled,omitempty"`
+	TTL       time.Duration `yaml:"ttl,omitempty"`
+	Tools     []string      `yaml:"tools,omitempty"`     // tool name patterns cached without annotations
+	Resources bool          `yaml:"resources,omitempty"` // cache resource reads
+}
+
+// Breaker configures the circuit breaker of an upstream. It opens when too
+// many of the recent calls failed or were slow, and lets a trial call through
+// after OpenFor to find out whether the upstream has recovered.
+type Breaker struct {
+	Enabled       bool          `yaml:"enabled,omitempty"`
+	Window        int           `yaml:"window,omitempty"`          // number of recent calls evaluated
+	MinCalls      int           `yaml:"min_calls,omitempty"`       // calls needed before the breaker can open
+	ErrorRate     float64       `yaml:"error_rate,omitempty"`      // share of failed calls that opens the breaker
+	SlowCall      time.Duration `yaml:"slow_call,omitempty"`       // calls slower than this count as failed
+	OpenFor       time.Duration `yaml:"open_for,omitempty"`        // time before a trial call is let through
+	HalfOpenCalls int           `yaml:"half_open_calls,omitempty"` // concurrent trial calls
+	HideTools     bool          `yaml:"hide_tools,omitempty"`      // remove the tools from tools/list while open
+}
+
+var envReference = regexp.MustCompile(`\$\{env:([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// ExpandEnv replaces the `${env:NAME}` references in a value of an entry with
+// the environment variables of the gateway. Other `$` are left alone.
+func ExpandEnv(value string) string {
+	return envReference.ReplaceAllStringFunc(value, func(reference string) string {
+		return os.Getenv(envReference.FindStringSubmatch(reference)[1])
+	})
+}
+
+// envDeclared reports whether the entry may reference the environment
+// variable of the gateway. An entry of the configuration may reference any,
+// an entry of a catalog source, which may be remote, only those it declares in
+// required_config or passes on under their own name in env.
+func (entry RepositoryEntry) envDeclared(name string) bool {
+	if entry.Source == "" {
+		return true
+	}
+	for _, required := range entry.RequiredConfig {
+		if required.Name == name {
+			return true
+		}
+	}
+	for _, variable := range entry.Env {
+		if variable == name+"=${env:"+name+"}" {
+			return true
+		}
+	}
+	return false
+}
+
+// undeclaredEnv returns the first variable the value references that the
+// entry does not declare.
+func (entry RepositoryEntry) undeclaredEnv(value string) (string, bool) {
+	for _, match := range envReference.FindAllStringSubmatch(value, -1) {
+		if !entry.envDeclared(match[1]) {
+			return match[1], true
+		}
+	}
+	return "", false
+}
+
+// ListAvailableTools returns the entries of all catalog sources.
 func ListAvailableTools() ([]RepositoryEntry, error) {
-	return loadEmbeddedRepo()
+	return mergeSources(Sources())
 }
 
 func loadEmbeddedRepo() ([]RepositoryEntry, error) {
-	var entries []RepositoryEntry
-	err := yaml.Unmarshal(repo_tools_yaml, &entries)
+	return parseEntries("repo_tools.yaml", repo_tools_yaml)
+}
+
+// ConfigTimeouts decodes the gateway wide timeouts of config.yaml on top of
+// the defaults. They are read from the file itself, viper would lowercase the
+// tool name patterns and split them on dots.
+func ConfigTimeouts(config []byte, defaults Timeouts) (Timeouts, error) {
+	read := struct {
+		Timeouts Timeouts `yaml:"timeouts"`
+	}{Timeouts: defaults}
+	if err := yaml.Unmarshal(config, &read); err != nil {
+		return Timeouts{}, err
+	}
+	return read.Timeouts, nil
+}
+
+// EntriesFromConfig decodes the upstreams listed in the gateway configuration.
+// An entry that only names a tool, the values of its inputs and optionally a
+// sandbox, is taken from the catalog.
+func EntriesFromConfig(raw any) ([]RepositoryEntry, error) {
+	return EntriesFromSources(raw, Sources())
+}
+
+// EntriesFromSources decodes the upstreams like EntriesFromConfig, but takes
+// the entries that only name a tool from the given sources instead of the
+// catalog the gateway currently uses.
+func EntriesFromSources(raw any, configured []Source) ([]RepositoryEntry, error) {
+	data, err := yaml.Marshal(raw)
 	if err != nil {
 		return nil, err
 	}
+	var entries []RepositoryEntry
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	var available []RepositoryEntry
+	listed := false
+	for i, entry := range entries {
+		if entry.Transport != "" {
+			continue
+		}
+		if !listed {
+			// read the catalog once, and only when an entry needs it
+			if available, err = mergeSources(configured); err != nil {
+				return nil, err
+			}
+			listed = true
+		}
+		found := false
+		for _, candidate := range available {
+			if candidate.Name == entry.Name {
+				candidate.With = entry.With
+				if entry.Sandbox != nil {
+					candidate.Sandbox = entry.Sandbox
+				}
+				entries[i], found = candidate, true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("upstream %s is not in the catalog", entry.Name)
+		}
+	}
+	for _, entry := range entries {
+		// a catalog entry can be given a sandbox in the configuration
+		if err := checkSandboxedPackage(entry); err != nil {
+			return nil, err
+		}
+	}
 	return entries, nil
 }
@@ -2,6 +2,9 @@ package repo
 
 import (
 	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
 func TestListAvailableTools(t *testing.T) {
@@ -42,3 +45,88 @@ func TestLoadEmbeddedRepo(t *testing.T) {
 		}
 	}
 }
+
+func TestTimeoutsFromYaml(t *testing.T) {
+	var entry RepositoryEntry
+	err := yaml.Unmarshal([]byte(`
+name: build
+transport: ipc
+command: make
+timeouts:
+  initialize: 10s
+  call: 10m
+  tools:
+    "search*": 5s
+`), &entry)
+	if err != nil {
+		t.Fatalf("Failed to parse entry: %v", err)
+	}
+	if entry.Timeouts.Initialize != 10*time.Second {
+		t.Errorf("Expected initialize timeout 10s, got %s", entry.Timeouts.Initialize)
+	}
+	if entry.Timeouts.Call != 10*time.Minute {
+		t.Errorf("Expected call timeout 10m, got %s", entry.Timeouts.Call)
+	}
+	if entry.Timeouts.Tools["search*"] != 5*time.Second {
+		t.Errorf("Expected tool timeout 5s, got %s", entry.Timeouts.Tools["search*"])
+	}
+}
+
+func TestConfigTimeoutsKeepToolPatterns(t *testing.T) {
+	timeouts, err := ConfigTimeouts([]byte(`
+timeouts:
+  call: 10m
+  tools:
+    "Search*": 5s
+    "docs.fetch": 1m
+`), Timeouts{Connect: 30 * time.Second})
+	if err != nil {
+		t.Fatalf("Failed to parse config: %v", err)
+	}
+	if timeouts.Connect != 30*time.Second || timeouts.Call != 10*time.Minute {
+		t.Errorf("Expected the defaults with the call timeout 10m, got %+v", timeouts)
+	}
+	if timeouts.Tools["Search*"] != 5*time.Second || timeouts.Tools["docs.fetch"] != time.Minute {
+		t.Errorf("Expected the tool patterns as written, got %v", timeouts.Tools)
+	}
+}
+
+func TestEntriesFromConfig(t *testing.T) {
+	raw := []any{
+		map[string]any{"name": "run"},
+		map[string]any{"name": "search", "transport": "http", "url": "http://localhost:8080/mcp"},
+	}
+	entries, err := EntriesFromConfig(raw)
+	if err != nil {
+		t.Fatalf("Failed to read upstreams: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 upstreams, got %d", len(entries))
+	}
+	if entries[0].Command != "test" {
+		t.Errorf("Expected the run entry to be taken from the catalog, got %+v", entries[0])
+	}
+	if entries[1].URL == nil || *entries[1].URL != "http://localhost:8080/mcp" {
+		t.Errorf("Expected the url of the search entry, got %v", entries[1].URL)
+	}
+
+	if _, err := EntriesFromConfig([]any{map[string]any{"name": "unknown"}}); err == nil {
+		t.Error("Expected an error for an upstream that is not in the catalog")
+	}
+}
+
+func TestEntriesFromSourcesIgnoresTheCurrentCatalog(t *testing.T) {
+	dir := t.TempDir()
+	writeCatalog(t, dir, "team.yaml", "- name: fetch\n  transport: ipc\n  command: uvx\n")
+
+	entries, err := EntriesFromSources([]any{map[string]any{"name": "fetch"}}, []Source{dirSource{path: dir}})
+	if err != nil {
+		t.Fatalf("Failed to read upstreams: %v", err)
+	}
+	if entries[0].Command != "uvx" {
+		t.Errorf("Expected fetch to be taken from the given source, got %+v", entries[0])
+	}
+	if _, err := EntriesFromConfig([]any{map[string]any{"name": "fetch"}}); err == nil {
+		t.Error("Expected fetch not to be in the current catalog")
+	}
+}
@@ -0,0 +1,171 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Dependency is a program an entry needs. In a catalog it is either just the
+// name of the program or a mapping with a minimum version.
+type Dependency struct {
+	Name           string `yaml:"name" json:"name"`
+	MinVersion     string `yaml:"min_version,omitempty" json:"min_version,omitempty"`
+	VersionCommand string `yaml:"version_command,omitempty" json:"version_command,omitempty"` // defaults to `<name> --version`
+	Hint           string `yaml:"hint,omitempty" json:"hint,omitempty"`                       // how to install the program
+}
+
+func (d *Dependency) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		d.Name = node.Value
+		return nil
+	}
+	type plain Dependency
+	return node.Decode((*plain)(d))
+}
+
+// installHints tells how to get the programs catalog entries usually need.
+var installHints = map[string]string{
+	"node":   "install Node.js from https://nodejs.org",
+	"npm":    "install Node.js from https://nodejs.org",
+	"npx":    "install Node.js from https://nodejs.org",
+	"uv":     "install uv from https://docs.astral.sh/uv/",
+	"uvx":    "install uv from https://docs.astral.sh/uv/",
+	"python": "install Python from https://www.python.org",
+	"docker": "install Docker from https://docs.docker.com/get-docker/",
+	"podman": "install Podman from https://podman.io",
+	"git":    "install git from https://git-scm.com",
+}
+
+// versionCommandTimeout bounds how long a version command may run.
+const versionCommandTimeout = 5 * time.Second
+
+var versionNumber = regexp.MustCompile(`\d+(\.\d+)*`)
+
+func (d Dependency) hint() string {
+	if d.Hint != "" {
+		return d.Hint
+	}
+	if hint, ok := installHints[d.Name]; ok {
+		return hint
+	}
+	return "install it and make sure it is on the PATH of mcp-gate"
+}
+
+// check returns what is wrong with the dependency, empty if nothing.
+func (d Dependency) check() string {
+	if _, err := exec.LookPath(d.Name); err != nil {
+		return fmt.Sprintf("%s is not installed or not on the PATH, %s", d.Name, d.hint())
+	}
+	if d.MinVersion == "" {
+		return ""
+	}
+	version, err := d.version()
+	if err != nil {
+		return fmt.Sprintf("unable to find out the version of %s: %v", d.Name, err)
+	}
+	if compareVersions(version, d.MinVersion) < 0 {
+		return fmt.Sprintf("%s %s is older than the required %s, %s", d.Name, version, d.MinVersion, d.hint())
+	}
+	return ""
+}
+
+// version runs the version command and returns the first version number it
+// prints.
+func (d Dependency) version() (string, error) {
+	command := strings.Fields(d.VersionCommand)
+	if len(command) == 0 {
+		command = []string{d.Name, "--version"}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), versionCommandTimeout)
+	defer cancel()
+	output, err := exec.CommandContext(ctx, command[0], command[1:]...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", strings.Join(command, " "), err)
+	}
+	version := versionNumber.FindString(string(output))
+	if version == "" {
+		return "", fmt.Errorf("%s printed no version", strings.Join(command, " "))
+	}
+	return version, nil
+}
+
+// compareVersions compares dotted version numbers, a missing part counts as 0.
+func compareVersions(a string, b string) int {
+	partsA, partsB := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(partsA) || i < len(partsB); i++ {
+		var numberA, numberB int
+		if i < len(partsA) {
+			numberA, _ = strconv.Atoi(partsA[i])
+		}
+		if i < len(partsB) {
+			numberB, _ = strconv.Atoi(partsB[i])
+		}
+		if numberA != numberB {
+			if numberA < numberB {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// RequirementsError lists why an entry cannot run on this machine.
+type RequirementsError struct {
+	Name     string
+	Problems []string
+}
+
+func (e *RequirementsError) Error() string {
+	return fmt.Sprintf("%s cannot run here: %s", e.Name, strings.Join(e.Problems, "; "))
+}
+
+// Platform is the os/arch mcp-gate runs on.
+func Platform() string {
+	return runtime.GOOS + "/" + runtime.GOARCH
+}
+
+// CheckRequirements checks that the entry supports the platform and that its
+// dependencies, the command of an ipc entry and the runtime of a container
+// entry, are installed in the required versions. It returns a *RequirementsError listing everything
+// missing.
+func CheckRequirements(entry RepositoryEntry) error {
+	var problems []string
+	if !entry.SupportsPlatform(Platform()) {
+		problems = append(problems, fmt.Sprintf("it only runs on %s, not on %s", strings.Join(entry.Platforms, ", "), Platform()))
+	}
+	declared := false
+	for _, dependency := range entry.Dependencies {
+		declared = declared || dependency.Name == entry.Command
+		if problem := dependency.check(); problem != "" {
+			problems = append(problems, problem)
+		}
+	}
+	if entry.Transport == "ipc" && entry.Command != "" && !declared {
+		if problem := (Dependency{Name: entry.Command}).check(); problem != "" {
+			problems = append(problems, problem)
+		}
+	}
+	if entry.Sandbox != nil && runtime.GOOS != "linux" {
+		problems = append(problems, fmt.Sprintf("its sandbox only works on linux, not on %s", runtime.GOOS))
+	}
+	if entry.Transport == "container" && entry.Container != nil {
+		if runtime, err := entry.Container.CLI(); err != nil {
+			problems = append(problems, err.Error())
+		} else if problem := (Dependency{Name: runtime}).check(); problem != "" {
+			problems = append(problems, problem)
+		}
+	}
+	if len(problems) > 0 {
+		return &RequirementsError{Name: entry.Name, Problems: problems}
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package repo
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestDependencyFromYaml(t *testing.T) {
+	var entry RepositoryEntry
+	err := yaml.Unmarshal([]byte(`
+name: weather
+dependencies:
+  - npx
+  - name: node
+    min_version: "18"
+    version_command: node -v
+`), &entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Dependency{{Name: "npx"}, {Name: "node", MinVersion: "18", VersionCommand: "node -v"}}
+	if len(entry.Dependencies) != 2 || entry.Dependencies[0] != expected[0] || entry.Dependencies[1] != expected[1] {
+		t.Errorf("expected %v, got %v", expected, entry.Dependencies)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"18.19.0", "18", 1},
+		{"18.0", "18", 0},
+		{"18.19.0", "18.20", -1},
+		{"20", "18.20.1", 1},
+		{"1.10", "1.9", 1},
+	}
+	for _, test := range tests {
+		if got := compareVersions(test.a, test.b); got != test.expected {
+			t.Errorf("compareVersions(%s, %s) = %d, expected %d", test.a, test.b, got, test.expected)
+		}
+	}
+}
+
+func TestCheckRequirements(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script as version command")
+	}
+	dir := t.TempDir()
+	tool := filepath.Join(dir, "tool")
+	if err := os.WriteFile(tool, []byte("#!/bin/sh\necho tool version 2.4.1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	ok := RepositoryEntry{Name: "ok", Transport: "ipc", Command: "tool", Platforms: []string{runtime.GOOS},
+		Dependencies: []Dependency{{Name: "tool", MinVersion: "2.4"}}}
+	if err := CheckRequirements(ok); err != nil {
+		t.Errorf("expected the requirements to be met, got %v", err)
+	}
+
+	missing := RepositoryEntry{Name: "missing", Transport: "ipc", Command: "not-installed-command", Platforms: []string{"plan9/386"},
+		Dependencies: []Dependency{{Name: "tool", MinVersion: "3"}, {Name: "npx"}}}
+	t.Setenv("PATH", dir)
+	err := CheckRequirements(missing)
+	var requirements *RequirementsError
+	if !errors.As(err, &requirements) || len(requirements.Problems) != 4 {
+		t.Fatalf("expected four problems, got %v", err)
+	}
+	for i, expected := range []string{"only runs on plan9/386", "tool 2.4.1 is older than the required 3", "install Node.js", "not-installed-command is not installed"} {
+		if !strings.Contains(requirements.Problems[i], expected) {
+			t.Errorf("expected %q in %q", expected, requirements.Problems[i])
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SECCOMP_DEFAULT = "default"
+	SECCOMP_NONE    = "none"
+)
+
+// Sandbox confines an ipc upstream on linux: it only sees the system
+// directories and Paths, has no network unless Network is set, runs with the
+// limits and as User, and cannot use the syscalls the seccomp profile blocks.
+type Sandbox struct {
+	Paths   []string      `yaml:"paths,omitempty" json:"paths,omitempty"`     // host paths the upstream sees, read only unless :rw is appended
+	Network bool          `yaml:"network,omitempty" json:"network,omitempty"` // keep network access, the upstream only has loopback otherwise
+	User    string        `yaml:"user,omitempty" json:"user,omitempty"`       // user name or uid the upstream runs as, needs mcp-gate to run as root
+	Seccomp string        `yaml:"seccomp,omitempty" json:"seccomp,omitempty"` // default blocks syscalls like mount, ptrace and bpf, none allows all
+	Limits  SandboxLimits `yaml:"limits,omitempty" json:"limits,omitempty"`
+}
+
+// SandboxLimits are the resources a sandboxed upstream may use. Memory, CPUs
+// and Pids are enforced with a cgroup, OpenFiles and CPUTime with rlimits. A
+// zero value is unlimited.
+type SandboxLimits struct {
+	Memory    string        `yaml:"memory,omitempty" json:"memory,omitempty"`         // for example 512M or 2G
+	CPUs      float64       `yaml:"cpus,omitempty" json:"cpus,omitempty"`             // cores, 0.5 is half a core
+	Pids      int           `yaml:"pids,omitempty" json:"pids,omitempty"`             // processes and threads
+	OpenFiles uint64        `yaml:"open_files,omitempty" json:"open_files,omitempty"` // file descriptors of each process
+	CPUTime   time.Duration `yaml:"cpu_time,omitempty" json:"cpu_time,omitempty"`     // cpu time of each process
+}
+
+// NeedsCgroup reports whether the limits are enforced with a cgroup.
+func (l SandboxLimits) NeedsCgroup() bool {
+	return l.Memory != "" || l.CPUs > 0 || l.Pids > 0
+}
+
+// MemoryBytes returns the memory limit in bytes, 0 if there is none.
+func (l SandboxLimits) MemoryBytes() (int64, error) {
+	if l.Memory == "" {
+		return 0, nil
+	}
+	value := strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(l.Memory), "B"), "I")
+	unit := int64(1)
+	for i, suffix := range []string{"K", "M", "G", "T"} {
+		if strings.HasSuffix(value, suffix) {
+			unit = 1 << (10 * (i + 1))
+			value = strings.TrimSuffix(value, suffix)
+			break
+		}
+	}
+	number, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || number <= 0 {
+		return 0, fmt.Errorf("memory %q is not a size like 512M or 2G", l.Memory)
+	}
+	return number * unit, nil
+}
+
+// SandboxPath is a host path visible in the sandbox.
+type SandboxPath struct {
+	Path     string
+	Writable bool
+}
+
+// ParseSandboxPath splits a path of the sandbox into the path and its access.
+func ParseSandboxPath(path string) (SandboxPath, error) {
+	parsed := SandboxPath{Path: path}
+	if base, access, ok := strings.Cut(path, ":"); ok {
+		if access != "ro" && access != "rw" {
+			return parsed, fmt.Errorf("path %q can only end with :ro or :rw", path)
+		}
+		parsed.Path, parsed.Writable = base, access == "rw"
+	}
+	if !strings.HasPrefix(parsed.Path, "/") && parsed.Path != "~" && !strings.HasPrefix(parsed.Path, "~/") {
+		return parsed, fmt.Errorf("path %q has to be absolute or start with ~", path)
+	}
+	parsed.Path = expandHome(parsed.Path)
+	return parsed, nil
+}
+
+// errSandboxedPackage is why an entry cannot be sandboxed and run a package:
+// npx and uvx would neither see the package store nor have a writable cache
+// and the network to resolve the dependencies of the package.
+var errSandboxedPackage = errors.New("a sandboxed entry cannot run a package, npx and uvx need the package store, a writable cache and the network in it, remove sandbox or package")
+
+// checkSandboxedPackage rejects an entry that is sandboxed and runs a package.
+func checkSandboxedPackage(entry RepositoryEntry) error {
+	if entry.Sandbox != nil && entry.Package != nil {
+		return fmt.Errorf("%s: %w", entry.Name, errSandboxedPackage)
+	}
+	return nil
+}
+
+// checkSandbox returns what is wrong with the sandbox.
+func checkSandbox(sandbox Sandbox) []string {
+	var problems []string
+	for _, path := range sandbox.Paths {
+		// inputs are only known at the start
+		if inputReference.MatchString(path) {
+			continue
+		}
+		if _, err := ParseSandboxPath(path); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if sandbox.Seccomp != "" && sandbox.Seccomp != SECCOMP_DEFAULT && sandbox.Seccomp != SECCOMP_NONE {
+		problems = append(problems, fmt.Sprintf("unknown seccomp profile %q, use default or none", sandbox.Seccomp))
+	}
+	if _, err := sandbox.Limits.MemoryBytes(); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if sandbox.Limits.CPUs < 0 || sandbox.Limits.Pids < 0 || sandbox.Limits.CPUTime < 0 {
+		problems = append(problems, "limits cannot be negative")
+	}
+	return problems
+}
@@ -0,0 +1,94 @@
+package repo
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSandboxMemoryBytes(t *testing.T) {
+	for memory, expected := range map[string]int64{"": 0, "512M": 512 << 20, "2G": 2 << 30, "1gib": 1 << 30, "4096": 4096} {
+		bytes, err := SandboxLimits{Memory: memory}.MemoryBytes()
+		if err != nil || bytes != expected {
+			t.Errorf("%q: expected %d, got %d %v", memory, expected, bytes, err)
+		}
+	}
+	if _, err := (SandboxLimits{Memory: "lots"}).MemoryBytes(); err == nil {
+		t.Error("expected an error for an invalid memory limit")
+	}
+}
+
+func TestValidateSandbox(t *testing.T) {
+	_, err := parseEntries("catalog.yaml", []byte(`- name: files
+  transport: ipc
+  command: npx
+  inputs:
+    - name: dir
+      type: path
+  sandbox:
+    paths: ["${input:dir}", "~/notes:rw", "data", "/srv:rx"]
+    seccomp: strict
+    limits:
+      memory: lots
+      pids: -1
+- name: remote
+  transport: http
+  url: https://example.com/mcp
+  sandbox:
+    network: true
+`))
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	expected := []string{
+		`files: path "data" has to be absolute or start with ~`,
+		`files: path "/srv:rx" can only end with :ro or :rw`,
+		`files: unknown seccomp profile "strict", use default or none`,
+		`files: memory "lots" is not a size like 512M or 2G`,
+		"files: limits cannot be negative",
+		"remote: only an ipc entry can be sandboxed",
+	}
+	if len(invalid.Problems) != len(expected) {
+		t.Fatalf("expected %d problems, got %v", len(expected), invalid)
+	}
+	for i, problem := range invalid.Problems {
+		if problem.Message != expected[i] {
+			t.Errorf("expected %q, got %q", expected[i], problem.Message)
+		}
+	}
+}
+
+func TestSandboxedPackageIsRejected(t *testing.T) {
+	catalog := `- name: weather
+  transport: ipc
+  command: npx
+  args: ["-y", "@example/weather"]
+  package:
+    registry: npm
+    name: "@example/weather"
+`
+	_, err := parseEntries("catalog.yaml", []byte(catalog+"  sandbox:\n    network: true\n"))
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) || len(invalid.Problems) != 1 || !strings.Contains(invalid.Problems[0].Message, "cannot run a package") {
+		t.Fatalf("expected the sandboxed package to be rejected, got %v", err)
+	}
+
+	// nor can the configuration sandbox a catalog entry that runs a package
+	dir := t.TempDir()
+	writeCatalog(t, dir, "team.yaml", catalog)
+	raw := []any{map[string]any{"name": "weather", "sandbox": map[string]any{"network": true}}}
+	if _, err := EntriesFromSources(raw, []Source{dirSource{path: dir}}); !errors.Is(err, errSandboxedPackage) {
+		t.Errorf("expected the sandboxed package to be rejected, got %v", err)
+	}
+
+	entries, err := parseEntries("catalog.yaml", []byte(catalog))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := entries[0]
+	entry.Sandbox = &Sandbox{}
+	if _, err := (&PackageStore{Dir: t.TempDir()}).Prepare(entry); !errors.Is(err, errSandboxedPackage) {
+		t.Errorf("expected a sandboxed package not to be prepared, got %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package repo
+
+import (
+	"sort"
+	"strings"
+)
+
+// Query filters the catalog. Empty fields match every entry.
+type Query struct {
+	Text     string   // words that all have to appear in the name, description, tags or author
+	Tags     []string // tags the entry has to have, all of them
+	Platform string   // os or os/arch the entry has to run on, for example linux or darwin/arm64
+}
+
+// Listing is what the catalog tells about an entry, without how it is
+// started.
+type Listing struct {
+	Name           string              `json:"name"`
+	Description    string              `json:"description,omitempty"`
+	Version        string              `json:"version,omitempty"`
+	Tags           []string            `json:"tags,omitempty"`
+	Homepage       string              `json:"homepage,omitempty"`
+	License        string              `json:"license,omitempty"`
+	Author         string              `json:"author,omitempty"`
+	Transport      string              `json:"transport"`
+	Platforms      []string            `json:"platforms,omitempty"`
+	Dependencies   []Dependency        `json:"dependencies,omitempty"`
+	RequiredConfig []ConfigRequirement `json:"required_config,omitempty"`
+	Inputs         []Input             `json:"inputs,omitempty"`
+	Source         string              `json:"source,omitempty"`
+}
+
+// Listing returns what the catalog tells about the entry.
+func (entry RepositoryEntry) Listing() Listing {
+	return Listing{
+		Name:           entry.Name,
+		Description:    entry.Description,
+		Version:        entry.Version,
+		Tags:           entry.Tags,
+		Homepage:       entry.Homepage,
+		License:        entry.License,
+		Author:         entry.Author,
+		Transport:      entry.Transport,
+		Platforms:      entry.Platforms,
+		Dependencies:   entry.Dependencies,
+		RequiredConfig: entry.RequiredConfig,
+		Inputs:         entry.Inputs,
+		Source:         entry.Source,
+	}
+}
+
+// SupportsPlatform reports whether the entry runs on the platform, os or
+// os/arch. An entry without platforms runs everywhere, a platform of the
+// entry without an arch stands for every arch of the os.
+func (entry RepositoryEntry) SupportsPlatform(platform string) bool {
+	if len(entry.Platforms) == 0 || platform == "" {
+		return true
+	}
+	goos, arch, _ := strings.Cut(strings.ToLower(platform), "/")
+	for _, supported := range entry.Platforms {
+		supportedOS, supportedArch, _ := strings.Cut(strings.ToLower(supported), "/")
+		if supportedOS == goos && (supportedArch == "" || arch == "" || supportedArch == arch) {
+			return true
+		}
+	}
+	return false
+}
+
+// Search returns the entries matching the query, the best matches first: a
+// word in the name ranks above a tag, a tag above the description.
+func Search(entries []RepositoryEntry, query Query) []RepositoryEntry {
+	words := strings.Fields(strings.ToLower(query.Text))
+	type match struct {
+		entry RepositoryEntry
+		score int
+	}
+	var matches []match
+	for _, entry := range entries {
+		if !entry.SupportsPlatform(query.Platform) || !hasTags(entry, query.Tags) {
+			continue
+		}
+		score, matched := 0, true
+		for _, word := range words {
+			wordScore := scoreWord(entry, word)
+			if wordScore == 0 {
+				matched = false
+				break
+			}
+			score += wordScore
+		}
+		if matched {
+			matches = append(matches, match{entry, score})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+	result := make([]RepositoryEntry, len(matches))
+	for i, match := range matches {
+		result[i] = match.entry
+	}
+	return result
+}
+
+func scoreWord(entry RepositoryEntry, word string) int {
+	name := strings.ToLower(entry.Name)
+	switch {
+	case name == word:
+		return 8
+	case strings.Contains(name, word):
+		return 4
+	}
+	for _, tag := range entry.Tags {
+		if strings.Contains(strings.ToLower(tag), word) {
+			return 2
+		}
+	}
+	if strings.Contains(strings.ToLower(entry.Description), word) || strings.Contains(strings.ToLower(entry.Author), word) {
+		return 1
+	}
+	return 0
+}
+
+func hasTags(entry RepositoryEntry, tags []string) bool {
+	for _, tag := range tags {
+		found := false
+		for _, candidate := range entry.Tags {
+			if strings.EqualFold(candidate, tag) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,48 @@
+package repo
+
+import (
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	entries := []RepositoryEntry{
+		{Name: "forecast", Description: "Weather forecasts", Tags: []string{"weather", "api"}},
+		{Name: "weather", Description: "Current weather", Platforms: []string{"linux/amd64", "darwin"}},
+		{Name: "almanac", Description: "Sun and moon, no weather", Author: "weather-corp", Tags: []string{"astronomy"}},
+		{Name: "fetch", Description: "Fetches web pages", Tags: []string{"web", "API"}, Platforms: []string{"windows"}},
+	}
+	names := func(matches []RepositoryEntry) []string {
+		var result []string
+		for _, entry := range matches {
+			result = append(result, entry.Name)
+		}
+		return result
+	}
+	tests := []struct {
+		query    Query
+		expected []string
+	}{
+		{Query{}, []string{"forecast", "weather", "almanac", "fetch"}},
+		{Query{Text: "Weather"}, []string{"weather", "forecast", "almanac"}},
+		{Query{Text: "weather sun"}, []string{"almanac"}},
+		{Query{Tags: []string{"api"}}, []string{"forecast", "fetch"}},
+		{Query{Tags: []string{"api", "web"}}, []string{"fetch"}},
+		{Query{Platform: "linux"}, []string{"forecast", "weather", "almanac"}},
+		{Query{Platform: "linux/arm64"}, []string{"forecast", "almanac"}},
+		{Query{Platform: "darwin/arm64", Text: "weather"}, []string{"weather", "forecast", "almanac"}},
+		{Query{Text: "nothing"}, nil},
+	}
+	for _, test := range tests {
+		got := names(Search(entries, test.query))
+		if len(got) != len(test.expected) {
+			t.Errorf("%+v: expected %v, got %v", test.query, test.expected, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.expected[i] {
+				t.Errorf("%+v: expected %v, got %v", test.query, test.expected, got)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,500 @@
+package repo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SOURCE_EMBEDDED = "embedded"
+	SOURCE_DIR      = "dir"
+	SOURCE_HTTP     = "http"
+	SOURCE_GIT      = "git"
+	SOURCE_REGISTRY = "registry"
+)
+
+// SourceConfig is one entry of `catalog.sources` in the gateway config.
+type SourceConfig struct {
+	Type    string        `mapstructure:"type"`
+	Path    string        `mapstructure:"path"`    // directory of a dir source, subdirectory of a git source
+	URL     string        `mapstructure:"url"`     // of a http, git or registry source
+	Ref     string        `mapstructure:"ref"`     // branch or tag of a git source
+	Refresh time.Duration `mapstructure:"refresh"` // how often a git or registry source is read again, defaults to an hour
+}
+
+// Source is a place catalog entries are read from.
+type Source interface {
+	// Describe names the source for humans, for example its url.
+	Describe() string
+	Load() ([]RepositoryEntry, error)
+}
+
+var (
+	sourcesMu sync.RWMutex
+	sources   = []Source{embeddedSource{}}
+)
+
+// SetSources replaces the sources the catalog is read from, in order of
+// increasing precedence.
+func SetSources(configured []Source) {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	sources = configured
+}
+
+// Sources returns the sources the catalog is read from.
+func Sources() []Source {
+	sourcesMu.RLock()
+	defer sourcesMu.RUnlock()
+	return sources
+}
+
+// SourcesFromConfig creates the configured sources. Remote sources keep their
+// copy of the catalog in cacheDir. Without any configured source the
+// embedded catalog is used.
+func SourcesFromConfig(configs []SourceConfig, cacheDir string) ([]Source, error) {
+	if len(configs) == 0 {
+		return []Source{embeddedSource{}}, nil
+	}
+	var configured []Source
+	for i, config := range configs {
+		switch config.Type {
+		case SOURCE_EMBEDDED:
+			configured = append(configured, embeddedSource{})
+		case SOURCE_DIR:
+			if config.Path == "" {
+				return nil, fmt.Errorf("catalog source %d: a dir source needs a path", i+1)
+			}
+			configured = append(configured, dirSource{path: config.Path})
+		case SOURCE_HTTP:
+			if config.URL == "" {
+				return nil, fmt.Errorf("catalog source %d: a http source needs a url", i+1)
+			}
+			configured = append(configured, &httpSource{url: config.URL, cacheDir: cacheDir, client: &http.Client{Timeout: 10 * time.Second}})
+		case SOURCE_REGISTRY:
+			if config.URL == "" {
+				return nil, fmt.Errorf("catalog source %d: a registry source needs a url", i+1)
+			}
+			if config.Refresh <= 0 {
+				config.Refresh = time.Hour
+			}
+			configured = append(configured, &registrySource{url: strings.TrimSuffix(config.URL, "/"), refresh: config.Refresh, cacheDir: cacheDir, client: &http.Client{Timeout: 30 * time.Second}})
+		case SOURCE_GIT:
+			if config.URL == "" {
+				return nil, fmt.Errorf("catalog source %d: a git source needs a url", i+1)
+			}
+			if config.Refresh <= 0 {
+				config.Refresh = time.Hour
+			}
+			configured = append(configured, &gitSource{url: config.URL, ref: config.Ref, path: config.Path, refresh: config.Refresh, cacheDir: cacheDir})
+		default:
+			return nil, fmt.Errorf("catalog source %d: unknown type %q, use embedded, dir, http, git or registry", i+1, config.Type)
+		}
+	}
+	return configured, nil
+}
+
+// SourceResult is what a source contributed to the catalog.
+type SourceResult struct {
+	Source     Source
+	Entries    []RepositoryEntry
+	Overridden []string // names of entries replaced by a later source
+	Err        error
+}
+
+// LoadSources reads every source. An entry of a later source replaces the
+// entry of the same name from an earlier one.
+func LoadSources() []SourceResult {
+	return loadSources(Sources())
+}
+
+func loadSources(configured []Source) []SourceResult {
+	var results []SourceResult
+	origin := map[string]int{} // entry name -> index of the result it is taken from
+	for _, source := range configured {
+		result := SourceResult{Source: source}
+		result.Entries, result.Err = source.Load()
+		for _, entry := range result.Entries {
+			if previous, ok := origin[entry.Name]; ok && previous != len(results) {
+				results[previous].Overridden = append(results[previous].Overridden, entry.Name)
+			}
+			origin[entry.Name] = len(results)
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
+// mergeSources returns the entries of all sources, each name once. A source
+// that cannot be read is skipped.
+func mergeSources(configured []Source) ([]RepositoryEntry, error) {
+	results := loadSources(configured)
+	var merged []RepositoryEntry
+	index := map[string]int{}
+	var errs []error
+	for _, result := range results {
+		if result.Err != nil {
+			log.Printf("catalog source %s skipped: %v", result.Source.Describe(), result.Err)
+			errs = append(errs, result.Err)
+			continue
+		}
+		for _, entry := range result.Entries {
+			entry.Source = result.Source.Describe()
+			if i, ok := index[entry.Name]; ok {
+				merged[i] = entry
+			} else {
+				index[entry.Name] = len(merged)
+				merged = append(merged, entry)
+			}
+		}
+	}
+	if len(errs) == len(results) && len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return merged, nil
+}
+
+// parseEntries reads a yaml catalog, or servers in the server.json format of
+// the MCP Registry. The file names the catalog in problems.
+func parseEntries(file string, data []byte) ([]RepositoryEntry, error) {
+	if isRegistryJSON(data) {
+		return parseRegistry(data)
+	}
+	return checkCatalog(decodeCatalog(file, data))
+}
+
+// embeddedSource is the catalog compiled into mcp-gate.
+type embeddedSource struct{}
+
+func (embeddedSource) Describe() string { return SOURCE_EMBEDDED }
+
+func (embeddedSource) Load() ([]RepositoryEntry, error) {
+	return loadEmbeddedRepo()
+}
+
+// dirSource reads every yaml and server.json file of a directory, in the
+// order of their names.
+type dirSource struct {
+	path string
+}
+
+func (s dirSource) Describe() string { return s.path }
+
+func (s dirSource) Load() ([]RepositoryEntry, error) {
+	return loadDir(s.path)
+}
+
+func loadDir(dir string) ([]RepositoryEntry, error) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, file := range files {
+		if extension := filepath.Ext(file.Name()); !file.IsDir() && (extension == ".yaml" || extension == ".yml" || extension == ".json") {
+			names = append(names, file.Name())
+		}
+	}
+	sort.Strings(names)
+
+	var entries []locatedEntry
+	var problems []Problem
+	for _, name := range names {
+		file := filepath.Join(dir, name)
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if isRegistryJSON(data) {
+			registryEntries, err := parseRegistry(data)
+			if err != nil {
+				problems = append(problems, Problem{File: file, Message: err.Error()})
+			}
+			for _, entry := range registryEntries {
+				entries = append(entries, locatedEntry{entry: entry, file: file})
+			}
+			continue
+		}
+		fileEntries, fileProblems := decodeCatalog(file, data)
+		entries = append(entries, fileEntries...)
+		problems = append(problems, fileProblems...)
+	}
+	return checkCatalog(entries, problems)
+}
+
+// httpSource downloads a catalog file. The last download is kept with its
+// ETag, the server only sends the catalog again once it changed, and the
+// copy is used while the server cannot be reached.
+type httpSource struct {
+	url      string
+	cacheDir string
+	client   *http.Client
+}
+
+func (s *httpSource) Describe() string { return s.url }
+
+func (s *httpSource) cachePath() string {
+	sum := sha256.Sum256([]byte(s.url))
+	return filepath.Join(s.cacheDir, "http-"+hex.EncodeToString(sum[:8])+".yaml")
+}
+
+func (s *httpSource) Load() ([]RepositoryEntry, error) {
+	cached, cacheErr := os.ReadFile(s.cachePath())
+	etag, _ := os.ReadFile(s.cachePath() + ".etag")
+
+	data, err := s.download(cached, string(etag))
+	if err != nil {
+		if cacheErr != nil {
+			return nil, err
+		}
+		log.Printf("catalog %s: using the copy from the last download: %v", s.url, err)
+		data = cached
+	}
+	return parseEntries(s.url, data)
+}
+
+func (s *httpSource) download(cached []byte, etag string) ([]byte, error) {
+	request, err := http.NewRequest(http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if etag != "" && cached != nil {
+		request.Header.Set("If-None-Match", etag)
+	}
+	response, err := s.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	switch response.StatusCode {
+	case http.StatusNotModified:
+		return cached, nil
+	case http.StatusOK:
+	default:
+		return nil, fmt.Errorf("server answered %s", response.Status)
+	}
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if s.cacheDir != "" {
+		if err := s.save(data, response.Header.Get("ETag")); err != nil {
+			log.Printf("catalog %s: unable to keep a copy: %v", s.url, err)
+		}
+	}
+	return data, nil
+}
+
+func (s *httpSource) save(data []byte, etag string) error {
+	if err := os.MkdirAll(s.cacheDir, 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(s.cachePath(), data, 0644); err != nil {
+		return err
+	}
+	if etag == "" {
+		return os.Remove(s.cachePath() + ".etag")
+	}
+	return os.WriteFile(s.cachePath()+".etag", []byte(etag), 0644)
+}
+
+// gitSource reads the yaml and server.json files of a directory in a git repository. The
+// repository is cloned into the cache directory and fetched again once the
+// checkout is older than refresh.
+type gitSource struct {
+	url      string
+	ref      string
+	path     string
+	refresh  time.Duration
+	cacheDir string
+}
+
+func (s *gitSource) Describe() string {
+	description := s.url
+	if s.ref != "" {
+		description += "@" + s.ref
+	}
+	if s.path != "" {
+		description += "#" + s.path
+	}
+	return description
+}
+
+func (s *gitSource) checkout() string {
+	sum := sha256.Sum256([]byte(s.url + "@" + s.ref))
+	return filepath.Join(s.cacheDir, "git-"+hex.EncodeToString(sum[:8]))
+}
+
+func (s *gitSource) Load() ([]RepositoryEntry, error) {
+	checkout := s.checkout()
+	stamp := checkout + ".fetched" // time of the last clone or fetch
+	if _, err := os.Stat(filepath.Join(checkout, ".git")); os.IsNotExist(err) {
+		if err := s.clone(checkout); err != nil {
+			return nil, err
+		}
+		touch(stamp)
+	} else if err != nil {
+		return nil, err
+	} else if info, err := os.Stat(stamp); err != nil || time.Since(info.ModTime()) > s.refresh {
+		// a failed fetch is not tried again before the next refresh either
+		touch(stamp)
+		if err := s.fetch(checkout); err != nil {
+			log.Printf("catalog %s: using the last checkout: %v", s.Describe(), err)
+		}
+	}
+	return loadDir(filepath.Join(checkout, s.path))
+}
+
+func (s *gitSource) clone(checkout string) error {
+	if err := os.MkdirAll(filepath.Dir(checkout), 0755); err != nil {
+		return err
+	}
+	args := []string{"clone", "--depth", "1"}
+	if s.ref != "" {
+		args = append(args, "--branch", s.ref)
+	}
+	if err := git(append(args, s.url, checkout)...); err != nil {
+		os.RemoveAll(checkout)
+		return err
+	}
+	return nil
+}
+
+func (s *gitSource) fetch(checkout string) error {
+	ref := s.ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if err := git("-C", checkout, "fetch", "--depth", "1", "origin", ref); err != nil {
+		return err
+	}
+	return git("-C", checkout, "reset", "--hard", "FETCH_HEAD")
+}
+
+func git(args ...string) error {
+	output, err := exec.Command("git", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func touch(path string) {
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		log.Printf("unable to write %s: %v", path, err)
+	}
+}
+
+// registrySource reads the server list of an MCP Registry, the official one
+// or a mirror. The last list is kept, used until it is older than refresh and
+// while the registry cannot be reached.
+type registrySource struct {
+	url      string
+	refresh  time.Duration
+	cacheDir string
+	client   *http.Client
+}
+
+func (s *registrySource) Describe() string { return s.url }
+
+func (s *registrySource) cachePath() string {
+	sum := sha256.Sum256([]byte(s.url))
+	return filepath.Join(s.cacheDir, "registry-"+hex.EncodeToString(sum[:8])+".json")
+}
+
+func (s *registrySource) Load() ([]RepositoryEntry, error) {
+	if s.cacheDir != "" {
+		if info, err := os.Stat(s.cachePath()); err == nil && time.Since(info.ModTime()) <= s.refresh {
+			servers, err := s.cached()
+			if err == nil {
+				return serverEntries(servers)
+			}
+		}
+	}
+	servers, err := s.download()
+	if err != nil {
+		cached, cacheErr := s.cached()
+		if cacheErr != nil {
+			return nil, err
+		}
+		log.Printf("catalog %s: using the list from the last download: %v", s.url, err)
+		// a failed download is not tried again before the next refresh either
+		now := time.Now()
+		os.Chtimes(s.cachePath(), now, now)
+		servers = cached
+	} else if s.cacheDir != "" {
+		if err := s.save(servers); err != nil {
+			log.Printf("catalog %s: unable to keep a copy: %v", s.url, err)
+		}
+	}
+	return serverEntries(servers)
+}
+
+// cached reads the list of the last download.
+func (s *registrySource) cached() ([]json.RawMessage, error) {
+	data, err := os.ReadFile(s.cachePath())
+	if err != nil {
+		return nil, err
+	}
+	var page registryResponse
+	if err := json.Unmarshal(data, &page); err != nil {
+		return nil, err
+	}
+	return page.Servers, nil
+}
+
+// download reads every page of the server list.
+func (s *registrySource) download() ([]json.RawMessage, error) {
+	var servers []json.RawMessage
+	cursor := ""
+	for {
+		query := url.Values{"limit": {"100"}, "version": {"latest"}}
+		if cursor != "" {
+			query.Set("cursor", cursor)
+		}
+		response, err := s.client.Get(s.url + "/v0/servers?" + query.Encode())
+		if err != nil {
+			return nil, err
+		}
+		var page registryResponse
+		if response.StatusCode != http.StatusOK {
+			err = fmt.Errorf("registry answered %s", response.Status)
+		} else {
+			err = json.NewDecoder(response.Body).Decode(&page)
+		}
+		response.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		servers = append(servers, page.Servers...)
+		if page.Metadata.NextCursor == "" || page.Metadata.NextCursor == cursor {
+			return servers, nil
+		}
+		cursor = page.Metadata.NextCursor
+	}
+}
+
+func (s *registrySource) save(servers []json.RawMessage) error {
+	if err := os.MkdirAll(s.cacheDir, 0755); err != nil {
+		return err
+	}
+	data, err := json.Marshal(registryResponse{Servers: servers})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.cachePath(), data, 0644)
+}
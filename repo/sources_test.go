@@ -0,0 +1,153 @@
+package repo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeCatalog(t *testing.T, dir string, file string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, file), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func useSources(t *testing.T, configured ...Source) {
+	t.Helper()
+	previous := Sources()
+	SetSources(configured)
+	t.Cleanup(func() { SetSources(previous) })
+}
+
+func TestLaterSourcesOverride(t *testing.T) {
+	first, second := t.TempDir(), t.TempDir()
+	writeCatalog(t, first, "b.yaml", "- name: fetch\n  transport: ipc\n  command: uvx\n- name: time\n  transport: ipc\n  command: uvx\n")
+	writeCatalog(t, first, "a.yml", "- name: git\n  transport: ipc\n  command: uvx\n")
+	writeCatalog(t, first, "notes.txt", "not a catalog")
+	writeCatalog(t, second, "team.yaml", "- name: fetch\n  transport: ipc\n  command: docker\n")
+	useSources(t, dirSource{path: first}, dirSource{path: second})
+
+	entries, err := ListAvailableTools()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[0].Name != "git" || entries[1].Name != "fetch" || entries[2].Name != "time" {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+	if entries[1].Command != "docker" || entries[1].Source != second {
+		t.Errorf("fetch should come from %s, got %+v", second, entries[1])
+	}
+
+	results := LoadSources()
+	if len(results[0].Overridden) != 1 || results[0].Overridden[0] != "fetch" || len(results[1].Overridden) != 0 {
+		t.Errorf("unexpected overrides %v, %v", results[0].Overridden, results[1].Overridden)
+	}
+}
+
+func TestFailingSourceIsSkipped(t *testing.T) {
+	dir := t.TempDir()
+	writeCatalog(t, dir, "team.yaml", "- name: fetch\n  transport: ipc\n  command: uvx\n")
+	useSources(t, dirSource{path: filepath.Join(dir, "missing")}, dirSource{path: dir})
+
+	entries, err := ListAvailableTools()
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected the entry of the readable source, got %v, %v", entries, err)
+	}
+
+	useSources(t, dirSource{path: filepath.Join(dir, "missing")})
+	if _, err := ListAvailableTools(); err == nil {
+		t.Error("expected an error when no source can be read")
+	}
+}
+
+func TestHTTPSource(t *testing.T) {
+	requests, unavailable := 0, false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if unavailable {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		w.Write([]byte("- name: fetch\n  transport: ipc\n  command: uvx\n"))
+	}))
+	defer server.Close()
+
+	sources, err := SourcesFromConfig([]SourceConfig{{Type: SOURCE_HTTP, URL: server.URL}}, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := sources[0]
+	for i, state := range []string{"downloaded", "not modified", "unavailable"} {
+		unavailable = state == "unavailable"
+		entries, err := source.Load()
+		if err != nil || len(entries) != 1 || entries[0].Name != "fetch" {
+			t.Fatalf("%s: unexpected entries %v, %v", state, entries, err)
+		}
+		if requests != i+1 {
+			t.Fatalf("%s: expected %d requests, got %d", state, i+1, requests)
+		}
+	}
+}
+
+func TestGitSource(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	upstream := t.TempDir()
+	writeCatalog(t, filepath.Join(upstream, "catalog"), "tools.yaml", "- name: fetch\n  transport: ipc\n  command: uvx\n")
+	for _, args := range [][]string{
+		{"init", "-q", "-b", "main"},
+		{"add", "."},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "catalog"},
+	} {
+		if err := git(append([]string{"-C", upstream}, args...)...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sources, err := SourcesFromConfig([]SourceConfig{{Type: SOURCE_GIT, URL: "file://" + upstream, Ref: "main", Path: "catalog", Refresh: time.Nanosecond}}, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := sources[0].Load()
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("unexpected entries after clone %v, %v", entries, err)
+	}
+
+	writeCatalog(t, filepath.Join(upstream, "catalog"), "more.yaml", "- name: time\n  transport: ipc\n  command: uvx\n")
+	if err := git("-C", upstream, "add", "."); err != nil {
+		t.Fatal(err)
+	}
+	if err := git("-C", upstream, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "more"); err != nil {
+		t.Fatal(err)
+	}
+	entries, err = sources[0].Load()
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("unexpected entries after fetch %v, %v", entries, err)
+	}
+}
+
+func TestSourcesFromConfig(t *testing.T) {
+	sources, err := SourcesFromConfig(nil, "")
+	if err != nil || len(sources) != 1 || sources[0].Describe() != SOURCE_EMBEDDED {
+		t.Errorf("expected the embedded catalog by default, got %v, %v", sources, err)
+	}
+	for _, config := range []SourceConfig{{Type: "ftp"}, {Type: SOURCE_DIR}, {Type: SOURCE_HTTP}, {Type: SOURCE_GIT}} {
+		if _, err := SourcesFromConfig([]SourceConfig{config}, ""); err == nil {
+			t.Errorf("expected an error for %+v", config)
+		}
+	}
+}
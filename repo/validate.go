@@ -0,0 +1,320 @@
+package repo
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Problem is a mistake in a catalog file.
+type Problem struct {
+	File    string
+	Line    int // 0 if unknown
+	Message string
+}
+
+func (p Problem) String() string {
+	return p.position() + ": " + p.Message
+}
+
+func (p Problem) position() string {
+	if p.Line > 0 {
+		return fmt.Sprintf("%s:%d", p.File, p.Line)
+	}
+	return p.File
+}
+
+// ValidationError lists every problem found in a catalog.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, len(e.Problems))
+	for i, problem := range e.Problems {
+		lines[i] = problem.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// locatedEntry is an entry with the place it is defined at.
+type locatedEntry struct {
+	entry RepositoryEntry
+	file  string
+	line  int
+}
+
+var (
+	validName   = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+	yamlLine    = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+	entryFields = reflect.TypeOf(RepositoryEntry{})
+)
+
+// decodeCatalog strictly decodes a yaml catalog: unknown and empty fields,
+// values of the wrong type and incomplete entries are reported with their
+// line instead of being ignored.
+func decodeCatalog(file string, data []byte) ([]locatedEntry, []Problem) {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, yamlProblems(file, err)
+	}
+	if len(document.Content) == 0 {
+		return nil, nil
+	}
+	root := document.Content[0]
+	if root.Kind != yaml.SequenceNode {
+		return nil, []Problem{{File: file, Line: root.Line, Message: "a catalog is a list of entries"}}
+	}
+	var entries []locatedEntry
+	var problems []Problem
+	for _, item := range root.Content {
+		found := checkFields(file, item, entryFields, "")
+		var entry RepositoryEntry
+		// on type errors the other fields are still decoded and checked
+		if err := item.Decode(&entry); err != nil {
+			found = append(found, yamlProblems(file, err)...)
+		}
+		if item.Kind == yaml.MappingNode {
+			found = append(found, validateEntry(file, item, entry)...)
+		}
+		sort.SliceStable(found, func(i, j int) bool { return found[i].Line < found[j].Line })
+		problems = append(problems, found...)
+		entries = append(entries, locatedEntry{entry: entry, file: file, line: item.Line})
+	}
+	return entries, problems
+}
+
+// yamlProblems turns the errors of the yaml decoder into problems.
+func yamlProblems(file string, err error) []Problem {
+	messages := []string{err.Error()}
+	if typeErr, ok := err.(*yaml.TypeError); ok {
+		messages = typeErr.Errors
+	}
+	problems := make([]Problem, len(messages))
+	for i, message := range messages {
+		problems[i] = Problem{File: file, Message: message}
+		if match := yamlLine.FindStringSubmatch(message); match != nil {
+			problems[i].Line, _ = strconv.Atoi(match[1])
+			problems[i].Message = match[2]
+		}
+	}
+	return problems
+}
+
+// checkFields reports the keys of a mapping that are not fields of the type,
+// and fields without a value.
+func checkFields(file string, node *yaml.Node, t reflect.Type, path string) []Problem {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	var problems []Problem
+	switch {
+	case t.Kind() == reflect.Struct && node.Kind == yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			name := path + key.Value
+			field, ok := yamlField(t, key.Value)
+			if !ok {
+				problems = append(problems, Problem{File: file, Line: key.Line, Message: fmt.Sprintf("unknown field %q", name)})
+				continue
+			}
+			if value.Tag == "!!null" {
+				problems = append(problems, Problem{File: file, Line: key.Line, Message: fmt.Sprintf("%s has no value, remove it or set one", name)})
+				continue
+			}
+			problems = append(problems, checkFields(file, value, field.Type, name+".")...)
+		}
+	case t.Kind() == reflect.Slice && node.Kind == yaml.SequenceNode:
+		for _, item := range node.Content {
+			problems = append(problems, checkFields(file, item, t.Elem(), path)...)
+		}
+	case t.Kind() == reflect.Map && node.Kind == yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			problems = append(problems, checkFields(file, node.Content[i], t.Elem(), path+node.Content[i-1].Value+".")...)
+		}
+	}
+	return problems
+}
+
+func yamlField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if name, _, _ := strings.Cut(field.Tag.Get("yaml"), ","); name == key && name != "-" {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// validateEntry checks that the entry has a valid name and what its transport
+// needs.
+func validateEntry(file string, node *yaml.Node, entry RepositoryEntry) []Problem {
+	var problems []Problem
+	problem := func(key string, format string, args ...any) {
+		problems = append(problems, Problem{File: file, Line: keyLine(node, key), Message: fmt.Sprintf(format, args...)})
+	}
+	if entry.Name == "" {
+		problem("name", "entry has no name")
+	} else if !validName.MatchString(entry.Name) {
+		problem("name", "name %q is not a valid identifier, use letters, digits, '.', '-' and '_'", entry.Name)
+	}
+	for _, dependency := range entry.Dependencies {
+		if dependency.Name == "" {
+			problem("dependencies", "%s: every dependency needs a name", entry.Name)
+		}
+	}
+	for _, required := range entry.RequiredConfig {
+		if required.Name == "" {
+			problem("required_config", "%s: every required_config needs a name", entry.Name)
+		}
+	}
+	if pkg := entry.Package; pkg != nil {
+		switch {
+		case pkg.Registry != PACKAGE_NPM && pkg.Registry != PACKAGE_PYPI:
+			problem("package", "%s: unknown package registry %q, use npm or pypi", entry.Name, pkg.Registry)
+		case pkg.Name == "":
+			problem("package", "%s: the package needs a name", entry.Name)
+		case entry.Transport != "ipc":
+			problem("package", "%s: only an ipc entry can run a package", entry.Name)
+		case pkg.argIndex(entry.Args) < 0:
+			problem("package", "%s: no argument names the package %s", entry.Name, pkg.Name)
+		}
+		for _, integrity := range strings.Fields(pkg.Integrity) {
+			if !integrityPattern.MatchString(integrity) {
+				problem("package", "%s: invalid integrity %q, use sha256-, sha384- or sha512- and the base64 hash", entry.Name, integrity)
+			}
+		}
+		if pkg.Integrity != "" && pkg.Version == "" {
+			problem("package", "%s: an integrity needs the version it belongs to", entry.Name)
+		}
+	}
+	declared := map[string]bool{}
+	for _, input := range entry.Inputs {
+		switch {
+		case !validInputName.MatchString(input.Name):
+			problem("inputs", "%s: input name %q is not a valid identifier, use letters, digits and '_'", entry.Name, input.Name)
+		case declared[strings.ToLower(input.Name)]:
+			problem("inputs", "%s: input %s is declared twice", entry.Name, input.Name)
+		}
+		declared[strings.ToLower(input.Name)] = true
+		switch input.Type {
+		case "", INPUT_STRING, INPUT_PATH, INPUT_SECRET:
+		case INPUT_ENUM:
+			if len(input.Options) == 0 {
+				problem("inputs", "%s: enum input %s has no options", entry.Name, input.Name)
+			} else if err := input.Check(input.Default); err != nil {
+				problem("inputs", "%s: the default of %v", entry.Name, err)
+			}
+		default:
+			problem("inputs", "%s: input %s has the unknown type %q, use string, path, secret or enum", entry.Name, input.Name, input.Type)
+		}
+	}
+	for _, name := range entry.inputReferences() {
+		if !declared[strings.ToLower(name)] {
+			problem("inputs", "%s: ${input:%s} is used but not declared in inputs", entry.Name, name)
+			declared[strings.ToLower(name)] = true
+		}
+	}
+	switch entry.Transport {
+	case "":
+		problem("transport", "%s: transport is missing, use ipc, http or container", entry.Name)
+	case "ipc":
+		if entry.Command == "" {
+			problem("command", "%s: an ipc entry needs a command", entry.Name)
+		}
+	case "http":
+		if (entry.URL == nil || *entry.URL == "") && len(entry.Replicas.URLs) == 0 {
+			problem("url", "%s: a http entry needs a url", entry.Name)
+		}
+	case "container":
+		if entry.Container == nil || entry.Container.Image == "" {
+			problem("container", "%s: a container entry needs container.image", entry.Name)
+			break
+		}
+		if runtime := entry.Container.Runtime; runtime != "" && runtime != RUNTIME_DOCKER && runtime != RUNTIME_PODMAN {
+			problem("container", "%s: unknown container runtime %q, use docker or podman", entry.Name, runtime)
+		}
+		for _, mount := range entry.Container.Mounts {
+			if message := checkMount(mount); message != "" {
+				problem("container", "%s: %s", entry.Name, message)
+			}
+		}
+		if option := checkOptions(*entry.Container); option != "" {
+			problem("container", "%s: %q gives the container access to the host, only an entry of the configuration may use it", entry.Name, option)
+		}
+	default:
+		problem("transport", "%s: unknown transport %q, use ipc, http or container", entry.Name, entry.Transport)
+	}
+	if entry.Sandbox != nil {
+		if entry.Transport != "ipc" {
+			problem("sandbox", "%s: only an ipc entry can be sandboxed", entry.Name)
+		}
+		for _, message := range checkSandbox(*entry.Sandbox) {
+			problem("sandbox", "%s: %s", entry.Name, message)
+		}
+		if err := checkSandboxedPackage(entry); err != nil {
+			problem("sandbox", "%v", err)
+		}
+	}
+	if entry.Container != nil && entry.Transport != "container" {
+		problem("container", "%s: container is only used by a container entry", entry.Name)
+	}
+	return problems
+}
+
+// keyLine returns the line of a key of the mapping, the line of the mapping
+// if it does not have the key.
+func keyLine(node *yaml.Node, key string) int {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i].Line
+		}
+	}
+	return node.Line
+}
+
+// checkCatalog reports names defined more than once and returns the entries
+// if the catalog has no problems.
+func checkCatalog(entries []locatedEntry, problems []Problem) ([]RepositoryEntry, error) {
+	defined := map[string]locatedEntry{}
+	for _, located := range entries {
+		name := located.entry.Name
+		if first, ok := defined[name]; ok && name != "" {
+			problems = append(problems, Problem{File: located.file, Line: located.line,
+				Message: fmt.Sprintf("%s is already defined at %s", name, Problem{File: first.file, Line: first.line}.position())})
+			continue
+		}
+		defined[name] = located
+	}
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+	result := make([]RepositoryEntry, len(entries))
+	for i, located := range entries {
+		result[i] = located.entry
+	}
+	return result, nil
+}
+
+// ValidateFile checks a catalog file, or all catalog files of a directory,
+// and returns its entries.
+func ValidateFile(path string) ([]RepositoryEntry, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return loadDir(path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseEntries(path, data)
+}
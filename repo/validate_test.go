@@ -0,0 +1,66 @@
+package repo
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestValidateCatalog(t *testing.T) {
+	_, err := parseEntries("catalog.yaml", []byte(`- name: run
+  descriptionn: typo
+  transport: ipc
+  command: test
+  args:
+- name: "bad name"
+  transport: http
+  timeouts:
+    call: soon
+    calls: 1s
+- name: run
+  transport: grpc
+- name: search
+  transport: ipc
+`))
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	expected := []Problem{
+		{"catalog.yaml", 2, `unknown field "descriptionn"`},
+		{"catalog.yaml", 5, "args has no value, remove it or set one"},
+		{"catalog.yaml", 6, `name "bad name" is not a valid identifier, use letters, digits, '.', '-' and '_'`},
+		{"catalog.yaml", 6, "bad name: a http entry needs a url"},
+		{"catalog.yaml", 9, "cannot unmarshal !!str `soon` into time.Duration"},
+		{"catalog.yaml", 10, `unknown field "timeouts.calls"`},
+		{"catalog.yaml", 12, `run: unknown transport "grpc", use ipc, http or container`},
+		{"catalog.yaml", 13, "search: an ipc entry needs a command"},
+		{"catalog.yaml", 11, "run is already defined at catalog.yaml:1"},
+	}
+	if !reflect.DeepEqual(invalid.Problems, expected) {
+		t.Errorf("expected problems\n%v\ngot\n%v", &ValidationError{expected}, invalid)
+	}
+}
+
+func TestValidateDir(t *testing.T) {
+	dir := t.TempDir()
+	writeCatalog(t, dir, "a.yaml", "- name: fetch\n  transport: ipc\n  command: uvx\n")
+	writeCatalog(t, dir, "b.yaml", "- name: time\n  transport: ipc\n  command: uvx\n- name: fetch\n  transport: ipc\n  command: npx\n")
+	_, err := ValidateFile(dir)
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) || len(invalid.Problems) != 1 {
+		t.Fatalf("expected one problem, got %v", err)
+	}
+	expected := Problem{filepath.Join(dir, "b.yaml"), 4, "fetch is already defined at " + filepath.Join(dir, "a.yaml") + ":1"}
+	if invalid.Problems[0] != expected {
+		t.Errorf("expected %v, got %v", expected, invalid.Problems[0])
+	}
+
+	if _, err := parseEntries("catalog.yaml", []byte("name: fetch\n")); err == nil {
+		t.Error("expected an error for a catalog that is not a list")
+	}
+	if entries, err := parseEntries("catalog.yaml", nil); err != nil || len(entries) != 0 {
+		t.Errorf("expected an empty catalog, got %v, %v", entries, err)
+	}
+}
@@ -0,0 +1,52 @@
+// Package sandbox confines ipc upstreams on linux. mcp-gate starts itself as
+// a helper in new namespaces, the helper builds the filesystem view of the
+// upstream, applies its limits, user and seccomp profile and then executes
+// the upstream.
+package sandbox
+
+// HelperArg is the first argument of mcp-gate when it runs as the helper, see
+// Run.
+const HelperArg = "__sandbox"
+
+// execArg follows HelperArg when the helper runs as the child of the init of
+// the sandbox and executes the upstream.
+const execArg = "exec"
+
+// specVariable passes the spec from the gateway to the helper.
+const specVariable = "MCP_GATE_SANDBOX"
+
+// inheritedVariables are the variables of the gateway every sandboxed
+// upstream gets, the others are only passed when the entry names them.
+var inheritedVariables = []string{"PATH", "HOME", "LANG"}
+
+// CgroupRoot is the cgroup v2 directory the cgroups of sandboxes with memory,
+// cpu or pids limits are created in. mcp-gate needs write access to it.
+var CgroupRoot = "/sys/fs/cgroup/mcp-gate"
+
+// systemPaths are visible read only in every sandbox, if they exist.
+var systemPaths = []string{"/usr", "/bin", "/sbin", "/lib", "/lib32", "/lib64", "/etc"}
+
+// devices are visible in every sandbox.
+var devices = []string{"/dev/null", "/dev/zero", "/dev/full", "/dev/random", "/dev/urandom"}
+
+// spec is what the helper has to set up.
+type spec struct {
+	Mounts    []mount  `json:"mounts"`
+	Cgroup    string   `json:"cgroup,omitempty"`
+	User      bool     `json:"user,omitempty"`
+	UID       int      `json:"uid,omitempty"`
+	GID       int      `json:"gid,omitempty"`
+	Seccomp   bool     `json:"seccomp,omitempty"`
+	OpenFiles uint64   `json:"open_files,omitempty"`
+	CPUTime   uint64   `json:"cpu_time,omitempty"` // seconds
+	Dir       string   `json:"dir"`
+	Command   string   `json:"command"`
+	Args      []string `json:"args"`
+}
+
+// mount makes a host path visible at the same path in the sandbox.
+type mount struct {
+	Path     string `json:"path"`
+	Writable bool   `json:"writable,omitempty"`
+	Optional bool   `json:"optional,omitempty"` // skipped if it does not exist
+}
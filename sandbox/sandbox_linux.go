@@ -0,0 +1,456 @@
+//go:build linux
+
+package sandbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"os/signal"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/ebamberg/mcp-gate/repo"
+	"golang.org/x/sys/unix"
+)
+
+// Command returns the command starting command with args and env in the
+// sandbox. name identifies the sandbox, it names its cgroup. The command is
+// looked up on the PATH of the gateway and its directory is visible read only.
+// Of the environment of the gateway the upstream only gets PATH, HOME, LANG
+// and the variables named in inherit.
+func Command(ctx context.Context, name string, config repo.Sandbox, command string, env []string, inherit []string, args []string) (*exec.Cmd, error) {
+	path, err := exec.LookPath(command)
+	if err != nil {
+		return nil, err
+	}
+	if path, err = filepath.Abs(path); err != nil {
+		return nil, err
+	}
+	s := spec{
+		Seccomp:   config.Seccomp != repo.SECCOMP_NONE,
+		OpenFiles: config.Limits.OpenFiles,
+		CPUTime:   uint64(math.Ceil(config.Limits.CPUTime.Seconds())),
+		Command:   path,
+		Args:      args,
+	}
+	for _, dir := range systemPaths {
+		s.Mounts = append(s.Mounts, mount{Path: dir, Optional: true})
+	}
+	for _, device := range devices {
+		s.Mounts = append(s.Mounts, mount{Path: device, Writable: true, Optional: true})
+	}
+	s.Mounts = append(s.Mounts, mount{Path: filepath.Dir(path)})
+	for _, configured := range config.Paths {
+		parsed, err := repo.ParseSandboxPath(configured)
+		if err != nil {
+			return nil, err
+		}
+		s.Mounts = append(s.Mounts, mount{Path: filepath.Clean(parsed.Path), Writable: parsed.Writable})
+	}
+	if s.Dir, err = os.Getwd(); err != nil {
+		s.Dir = "/"
+	}
+
+	attr := &syscall.SysProcAttr{
+		Setpgid:    true,
+		Cloneflags: syscall.CLONE_NEWNS | syscall.CLONE_NEWPID | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS,
+	}
+	if !config.Network {
+		// a new network namespace only has loopback
+		attr.Cloneflags |= syscall.CLONE_NEWNET
+	}
+	if os.Geteuid() != 0 {
+		// the helper is root in a user namespace of its own to set up the mounts
+		attr.Cloneflags |= syscall.CLONE_NEWUSER
+		attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}}
+		attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}}
+		attr.GidMappingsEnableSetgroups = false
+	}
+	if config.User != "" {
+		if os.Geteuid() != 0 {
+			return nil, fmt.Errorf("running as user %s needs mcp-gate to run as root", config.User)
+		}
+		if s.UID, s.GID, err = lookupUser(config.User); err != nil {
+			return nil, err
+		}
+		s.User = true
+	}
+	if config.Limits.NeedsCgroup() {
+		if s.Cgroup, err = createCgroup(name, config.Limits); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.CommandContext(ctx, self, HelperArg)
+	cmd.Env = append(append(inherited(inherit), env...), specVariable+"="+string(data))
+	cmd.SysProcAttr = attr
+	return cmd, nil
+}
+
+// inherited returns the variables of the gateway a sandboxed upstream gets.
+func inherited(names []string) []string {
+	var env []string
+	for _, name := range append(append([]string{}, inheritedVariables...), names...) {
+		if value, ok := os.LookupEnv(name); ok {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
+
+func lookupUser(name string) (int, int, error) {
+	account, err := user.Lookup(name)
+	if err != nil {
+		if account, err = user.LookupId(name); err != nil {
+			return 0, 0, fmt.Errorf("unknown user %s", name)
+		}
+	}
+	uid, err := strconv.Atoi(account.Uid)
+	if err != nil {
+		return 0, 0, err
+	}
+	gid, err := strconv.Atoi(account.Gid)
+	return uid, gid, err
+}
+
+func cgroupPath(name string) string {
+	return filepath.Join(CgroupRoot, fmt.Sprintf("%s-%d", name, os.Getpid()))
+}
+
+// createCgroup creates the cgroup of the sandbox with its limits, the helper
+// moves itself into it.
+func createCgroup(name string, limits repo.SandboxLimits) (string, error) {
+	var controllers []string
+	settings := map[string]string{}
+	if memory, err := limits.MemoryBytes(); err != nil {
+		return "", err
+	} else if memory > 0 {
+		controllers = append(controllers, "+memory")
+		settings["memory.max"] = strconv.FormatInt(memory, 10)
+		settings["memory.swap.max"] = "0"
+	}
+	if limits.CPUs > 0 {
+		controllers = append(controllers, "+cpu")
+		settings["cpu.max"] = fmt.Sprintf("%d 100000", int64(limits.CPUs*100000))
+	}
+	if limits.Pids > 0 {
+		controllers = append(controllers, "+pids")
+		settings["pids.max"] = strconv.Itoa(limits.Pids)
+	}
+	failed := func(err error) (string, error) {
+		return "", fmt.Errorf("limits need cgroup v2 and write access to %s, set sandbox.cgroup_root to a delegated cgroup: %w", CgroupRoot, err)
+	}
+	if err := os.MkdirAll(CgroupRoot, 0755); err != nil {
+		return failed(err)
+	}
+	// the controllers have to be enabled on the way down to the cgroup
+	enable := []byte(strings.Join(controllers, " "))
+	os.WriteFile(filepath.Join(filepath.Dir(CgroupRoot), "cgroup.subtree_control"), enable, 0644)
+	if err := os.WriteFile(filepath.Join(CgroupRoot, "cgroup.subtree_control"), enable, 0644); err != nil {
+		return failed(err)
+	}
+	dir := cgroupPath(name)
+	os.Remove(dir) // left from an earlier start
+	if err := os.Mkdir(dir, 0755); err != nil && !errors.Is(err, os.ErrExist) {
+		return failed(err)
+	}
+	for file, value := range settings {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(value), 0644); err != nil && file != "memory.swap.max" {
+			return failed(err)
+		}
+	}
+	return dir, nil
+}
+
+// Cleanup removes the cgroup of the sandbox once its processes are gone.
+func Cleanup(name string) {
+	os.Remove(cgroupPath(name))
+}
+
+// Run is the helper: it sets up the sandbox the gateway passed in the
+// environment and executes the upstream in it. It only returns on failure,
+// then it exits.
+func Run() {
+	var s spec
+	err := json.Unmarshal([]byte(os.Getenv(specVariable)), &s)
+	if err == nil {
+		if len(os.Args) > 2 && os.Args[2] == execArg {
+			os.Unsetenv(specVariable)
+			err = s.enter()
+		} else {
+			err = s.init()
+		}
+	}
+	fmt.Fprintf(os.Stderr, "mcp-gate sandbox: %v\n", err)
+	os.Exit(126)
+}
+
+// init runs as PID 1 of the sandbox. The kernel ignores the signals a PID 1
+// has no handler for, so the upstream runs as its child: init forwards the
+// signals to it, reaps the processes orphaned in the sandbox and exits with
+// the status of the upstream.
+func (s spec) init() error {
+	if s.Cgroup != "" {
+		if err := os.WriteFile(filepath.Join(s.Cgroup, "cgroup.procs"), []byte("0"), 0644); err != nil {
+			return fmt.Errorf("joining cgroup %s: %w", s.Cgroup, err)
+		}
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	signals := make(chan os.Signal, 8)
+	signal.Notify(signals, unix.SIGTERM, unix.SIGINT, unix.SIGHUP, unix.SIGQUIT, unix.SIGUSR1, unix.SIGUSR2)
+	upstream := exec.Command(self, HelperArg, execArg)
+	upstream.Stdin, upstream.Stdout, upstream.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := upstream.Start(); err != nil {
+		return err
+	}
+	pid := upstream.Process.Pid
+	go func() {
+		for received := range signals {
+			unix.Kill(pid, received.(unix.Signal))
+		}
+	}()
+	for {
+		var status unix.WaitStatus
+		reaped, err := unix.Wait4(-1, &status, 0, nil)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if reaped != pid {
+			continue
+		}
+		if status.Signaled() {
+			os.Exit(128 + int(status.Signal()))
+		}
+		os.Exit(status.ExitStatus())
+	}
+}
+
+// enter builds the sandbox and executes the command, it only returns on
+// failure.
+func (s spec) enter() error {
+	runtime.LockOSThread()
+	// nothing mounted from here on is seen outside of the sandbox
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("making the mounts private: %w", err)
+	}
+
+	// the paths are opened before the new root hides them
+	type source struct {
+		mount
+		fd  int
+		dir bool
+	}
+	var sources []source
+	for _, m := range s.Mounts {
+		fd, err := unix.Open(m.Path, unix.O_PATH|unix.O_CLOEXEC, 0)
+		if err != nil {
+			if m.Optional && errors.Is(err, unix.ENOENT) {
+				continue
+			}
+			return fmt.Errorf("%s: %w", m.Path, err)
+		}
+		var stat unix.Stat_t
+		if err := unix.Fstat(fd, &stat); err != nil {
+			return fmt.Errorf("%s: %w", m.Path, err)
+		}
+		sources = append(sources, source{mount: m, fd: fd, dir: stat.Mode&unix.S_IFMT == unix.S_IFDIR})
+	}
+	// parents are mounted before the paths in them
+	sort.SliceStable(sources, func(i, j int) bool { return sources[i].Path < sources[j].Path })
+
+	root := os.TempDir()
+	if err := unix.Mount("tmpfs", root, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, "mode=0755"); err != nil {
+		return fmt.Errorf("mounting the root: %w", err)
+	}
+	if err := mountFresh(root, "/proc", "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC); err != nil {
+		return err
+	}
+	if err := mountFresh(root, "/tmp", "tmpfs", unix.MS_NOSUID|unix.MS_NODEV); err != nil {
+		return err
+	}
+	for _, source := range sources {
+		target := filepath.Join(root, source.Path)
+		if err := mountPoint(target, source.dir); err != nil {
+			return fmt.Errorf("%s: %w", source.Path, err)
+		}
+		if err := unix.Mount(fmt.Sprintf("/proc/self/fd/%d", source.fd), target, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+			return fmt.Errorf("mounting %s: %w", source.Path, err)
+		}
+		unix.Close(source.fd)
+		if !source.Writable {
+			if err := remountReadOnly(target); err != nil {
+				return fmt.Errorf("mounting %s read only: %w", source.Path, err)
+			}
+		}
+	}
+
+	if err := unix.Chdir(root); err != nil {
+		return err
+	}
+	// the old root ends up on top of the new one and is unmounted right away
+	if err := unix.PivotRoot(".", "."); err != nil {
+		return fmt.Errorf("changing the root: %w", err)
+	}
+	if err := unix.Unmount(".", unix.MNT_DETACH); err != nil {
+		return fmt.Errorf("unmounting the old root: %w", err)
+	}
+	if err := unix.Mount("", "/", "", unix.MS_REMOUNT|unix.MS_RDONLY|unix.MS_NOSUID|unix.MS_NODEV, ""); err != nil {
+		return fmt.Errorf("mounting the root read only: %w", err)
+	}
+	if err := unix.Chdir(s.Dir); err != nil {
+		unix.Chdir("/")
+	}
+
+	if s.OpenFiles > 0 {
+		if err := unix.Setrlimit(unix.RLIMIT_NOFILE, &unix.Rlimit{Cur: s.OpenFiles, Max: s.OpenFiles}); err != nil {
+			return fmt.Errorf("limiting open files: %w", err)
+		}
+	}
+	if s.CPUTime > 0 {
+		// SIGXCPU at the limit, SIGKILL a little later
+		if err := unix.Setrlimit(unix.RLIMIT_CPU, &unix.Rlimit{Cur: s.CPUTime, Max: s.CPUTime + 5}); err != nil {
+			return fmt.Errorf("limiting cpu time: %w", err)
+		}
+	}
+	// the bounding set keeps a root upstream from gaining capabilities on exec,
+	// dropping it needs CAP_SETPCAP, which a changed user no longer has
+	if err := dropBoundingSet(); err != nil {
+		return err
+	}
+	if s.User {
+		if err := syscall.Setgroups([]int{s.GID}); err != nil {
+			return err
+		}
+		if err := syscall.Setgid(s.GID); err != nil {
+			return err
+		}
+		if err := syscall.Setuid(s.UID); err != nil {
+			return err
+		}
+	}
+	if err := dropCapabilities(); err != nil {
+		return err
+	}
+	// neither setuid binaries nor file capabilities grant anything from here on
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("setting no_new_privs: %w", err)
+	}
+	if s.Seccomp {
+		if err := installSeccomp(); err != nil {
+			return err
+		}
+	}
+	return unix.Exec(s.Command, append([]string{s.Command}, s.Args...), os.Environ())
+}
+
+// lastCapability returns the highest capability the kernel knows.
+func lastCapability() int {
+	data, err := os.ReadFile("/proc/sys/kernel/cap_last_cap")
+	if err != nil {
+		return unix.CAP_LAST_CAP
+	}
+	last, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return unix.CAP_LAST_CAP
+	}
+	return last
+}
+
+// dropBoundingSet removes every capability from the bounding set of the
+// thread that executes the upstream.
+func dropBoundingSet() error {
+	for capability := 0; capability <= lastCapability(); capability++ {
+		if err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(capability), 0, 0, 0); err != nil && err != unix.EINVAL {
+			return fmt.Errorf("dropping capability %d: %w", capability, err)
+		}
+	}
+	return nil
+}
+
+// dropCapabilities clears the ambient, effective, permitted and inheritable
+// capabilities, so the upstream has none even if it runs as root.
+func dropCapabilities() error {
+	if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil && err != unix.EINVAL {
+		return fmt.Errorf("clearing the ambient capabilities: %w", err)
+	}
+	header := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	var data [2]unix.CapUserData
+	if err := unix.Capset(&header, &data[0]); err != nil {
+		return fmt.Errorf("dropping the capabilities: %w", err)
+	}
+	return nil
+}
+
+// mountFresh mounts a new filesystem of the type at path below root.
+func mountFresh(root string, path string, fstype string, flags uintptr) error {
+	target := filepath.Join(root, path)
+	if err := os.MkdirAll(target, 0755); err != nil {
+		return err
+	}
+	if err := unix.Mount(fstype, target, fstype, flags, ""); err != nil {
+		return fmt.Errorf("mounting %s: %w", path, err)
+	}
+	return nil
+}
+
+// mountPoint creates the directory or the empty file a path is mounted on.
+func mountPoint(target string, dir bool) error {
+	if dir {
+		return os.MkdirAll(target, 0755)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_RDONLY, 0644)
+	if err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// remountReadOnly makes a bind mount read only. The flags of the original
+// mount have to be kept, a user namespace may not clear them.
+func remountReadOnly(target string) error {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(target, &stat); err != nil {
+		return err
+	}
+	flags := uintptr(unix.MS_BIND | unix.MS_REMOUNT | unix.MS_RDONLY)
+	for st, ms := range map[int64]uintptr{
+		unix.ST_NOSUID:     unix.MS_NOSUID,
+		unix.ST_NODEV:      unix.MS_NODEV,
+		unix.ST_NOEXEC:     unix.MS_NOEXEC,
+		unix.ST_NOATIME:    unix.MS_NOATIME,
+		unix.ST_NODIRATIME: unix.MS_NODIRATIME,
+		unix.ST_RELATIME:   unix.MS_RELATIME,
+	} {
+		if int64(stat.Flags)&st != 0 {
+			flags |= ms
+		}
+	}
+	return unix.Mount("", target, "", flags, "")
+}
@@ -0,0 +1,187 @@
+package sandbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ebamberg/mcp-gate/repo"
+	"golang.org/x/sys/unix"
+)
+
+// probeArg makes the test binary report what the sandbox lets it do.
+const probeArg = "probe"
+
+// TestMain lets the test binary act as the helper, Command starts the running
+// executable, and as the probe run in the sandbox.
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == HelperArg {
+		Run()
+	}
+	if len(os.Args) > 1 && os.Args[1] == probeArg {
+		probe()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// probe prints the outcome of the syscalls the default profile restricts and
+// the effective capabilities.
+func probe() {
+	pid, _, errno := unix.RawSyscall(unix.SYS_CLONE, unix.CLONE_NEWUSER|uintptr(unix.SIGCHLD), 0, 0)
+	if errno == 0 && pid == 0 {
+		unix.RawSyscall(unix.SYS_EXIT_GROUP, 0, 0, 0)
+	}
+	if errno == 0 {
+		unix.Wait4(int(pid), nil, 0, nil)
+	}
+	fmt.Printf("clone newuser: %v\n", errno)
+	_, _, errno = unix.RawSyscall(unix.SYS_CLONE3, 0, 0, 0)
+	fmt.Printf("clone3: %v\n", errno)
+	_, err := unix.Fsopen("tmpfs", 0)
+	fmt.Printf("fsopen: %v\n", err)
+	status, _ := os.ReadFile("/proc/self/status")
+	for _, line := range strings.Split(string(status), "\n") {
+		if strings.HasPrefix(line, "Cap") || strings.HasPrefix(line, "NoNewPrivs") {
+			fmt.Println(strings.Join(strings.Fields(line), " "))
+		}
+	}
+}
+
+// runSandboxed runs a shell script in the sandbox and returns its output.
+func runSandboxed(t *testing.T, config repo.Sandbox, script string) (string, error) {
+	t.Helper()
+	return runCommand(t, config, "sh", "-c", script)
+}
+
+func runCommand(t *testing.T, config repo.Sandbox, command string, args ...string) (string, error) {
+	t.Helper()
+	cmd, err := Command(context.Background(), "test", config, command, []string{"GREETING=hello"}, []string{"SANDBOX_API_KEY"}, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := cmd.CombinedOutput()
+	if strings.Contains(string(output), "mcp-gate sandbox:") {
+		// namespaces are not available, for example in a container
+		t.Skipf("sandbox not available: %s", output)
+	}
+	return string(output), err
+}
+
+func TestSandboxView(t *testing.T) {
+	shared, hidden, writable := t.TempDir(), t.TempDir(), t.TempDir()
+	os.WriteFile(filepath.Join(shared, "notes.txt"), []byte("shared"), 0644)
+	os.WriteFile(filepath.Join(hidden, "secret.txt"), []byte("secret"), 0644)
+	config := repo.Sandbox{Paths: []string{shared, writable + ":rw"}}
+
+	output, err := runSandboxed(t, config, `echo $GREETING; cat `+shared+`/notes.txt; echo
+ls `+hidden+` 2>/dev/null || echo hidden
+touch `+shared+`/new.txt 2>/dev/null || echo read only
+touch `+writable+`/new.txt && echo writable
+grep -c : /proc/net/dev`)
+	if err != nil {
+		t.Fatalf("%v: %s", err, output)
+	}
+	// the header of /proc/net/dev has no colon, loopback is the only device
+	expected := "hello\nshared\nhidden\nread only\nwritable\n1\n"
+	if output != expected {
+		t.Errorf("expected %q, got %q", expected, output)
+	}
+	if _, err := os.Stat(filepath.Join(writable, "new.txt")); err != nil {
+		t.Errorf("expected the file written in the sandbox: %v", err)
+	}
+}
+
+func TestSandboxSeccomp(t *testing.T) {
+	output, err := runSandboxed(t, repo.Sandbox{}, "unshare --user true || echo blocked")
+	if err != nil {
+		t.Fatalf("%v: %s", err, output)
+	}
+	if !strings.HasSuffix(output, "blocked\n") {
+		t.Errorf("expected unshare to be blocked, got %q", output)
+	}
+
+	output, err = runSandboxed(t, repo.Sandbox{Seccomp: repo.SECCOMP_NONE}, "unshare --user true && echo allowed")
+	if err != nil {
+		t.Fatalf("%v: %s", err, output)
+	}
+	if output != "allowed\n" {
+		t.Errorf("expected unshare to be allowed without seccomp, got %q", output)
+	}
+}
+
+func TestSandboxRestrictions(t *testing.T) {
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := runCommand(t, repo.Sandbox{Network: true}, self, probeArg)
+	if err != nil {
+		t.Fatalf("%v: %s", err, output)
+	}
+	for _, expected := range []string{
+		"clone newuser: operation not permitted",
+		"clone3: function not implemented",
+		"fsopen: operation not permitted",
+		"CapInh: 0000000000000000",
+		"CapPrm: 0000000000000000",
+		"CapEff: 0000000000000000",
+		"CapBnd: 0000000000000000",
+		"CapAmb: 0000000000000000",
+		"NoNewPrivs: 1",
+	} {
+		if !strings.Contains(output, expected+"\n") {
+			t.Errorf("expected %q, got %q", expected, output)
+		}
+	}
+}
+
+func TestSandboxEnvironment(t *testing.T) {
+	t.Setenv("SANDBOX_API_KEY", "required")
+	t.Setenv("SANDBOX_SECRET", "hidden")
+	output, err := runSandboxed(t, repo.Sandbox{}, `echo $GREETING $SANDBOX_API_KEY ${SANDBOX_SECRET:-unset}; test -n "$PATH" && echo path`)
+	if err != nil {
+		t.Fatalf("%v: %s", err, output)
+	}
+	if expected := "hello required unset\npath\n"; output != expected {
+		t.Errorf("expected %q, got %q", expected, output)
+	}
+}
+
+func TestSandboxStopsOnSIGTERM(t *testing.T) {
+	cmd, err := Command(context.Background(), "test", repo.Sandbox{}, "sleep", nil, nil, []string{"60"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var output strings.Builder
+	cmd.Stdout, cmd.Stderr = &output, &output
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// give the sandbox time to execute sleep
+	time.Sleep(500 * time.Millisecond)
+	if err := cmd.Process.Signal(unix.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	select {
+	case err := <-exited:
+		if strings.Contains(output.String(), "mcp-gate sandbox:") {
+			t.Skipf("sandbox not available: %s", output.String())
+		}
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) || exitErr.ExitCode() != 128+int(unix.SIGTERM) {
+			t.Errorf("expected the upstream to be terminated by SIGTERM, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		cmd.Process.Kill()
+		t.Fatal("expected the sandbox to stop on SIGTERM")
+	}
+}
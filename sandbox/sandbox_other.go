@@ -0,0 +1,27 @@
+//go:build !linux
+
+package sandbox
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+
+	"github.com/ebamberg/mcp-gate/repo"
+)
+
+// Command fails, sandboxes need the namespaces of linux.
+func Command(ctx context.Context, name string, config repo.Sandbox, command string, env []string, inherit []string, args []string) (*exec.Cmd, error) {
+	return nil, fmt.Errorf("sandboxing only works on linux, not on %s", runtime.GOOS)
+}
+
+// Run fails, sandboxes need the namespaces of linux.
+func Run() {
+	fmt.Fprintf(os.Stderr, "mcp-gate sandbox: only works on linux, not on %s\n", runtime.GOOS)
+	os.Exit(126)
+}
+
+// Cleanup does nothing, there are no sandboxes to clean up.
+func Cleanup(name string) {}
@@ -0,0 +1,14 @@
+//go:build linux && !amd64 && !arm64
+
+package sandbox
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// installSeccomp fails, the default profile only knows the syscalls of amd64
+// and arm64.
+func installSeccomp() error {
+	return fmt.Errorf("the default seccomp profile is not available on %s, use seccomp: none", runtime.GOARCH)
+}
@@ -1,26 +1,133 @@
 package server
 
 import (
+	"context"
+	"errors"
+	"io"
 	"log"
+	"os"
+	"time"
 
+	"github.com/ebamberg/mcp-gate/client"
+	"github.com/ebamberg/mcp-gate/tracing"
 	"github.com/mark3labs/mcp-go/server"
 )
 
+// ErrCallsAborted is returned when calls were still running at the shutdown
+// deadline and had to be cancelled.
+var ErrCallsAborted = errors.New("calls in flight were cancelled at the shutdown deadline")
+
 func NewServer() *server.MCPServer {
+	hooks := client.NewProxyHooks()
+	tracing.AddHooks(hooks)
 	s := server.NewMCPServer(
 		"MCP Gate",
 		"1.0.0",
-		server.WithToolCapabilities(false),
+		server.WithToolCapabilities(true),
+		server.WithResourceCapabilities(false, true),
+		server.WithPromptCapabilities(true),
 		server.WithRecovery(),
+		server.WithHooks(hooks),
+		server.WithToolFilter(client.FilterTools),
+		server.WithToolHandlerMiddleware(tracing.ToolMiddleware),
+		server.WithResourceHandlerMiddleware(tracing.ResourceMiddleware),
 	)
+	client.RegisterProxyNotificationHandlers(s)
 
 	return s
 }
 
-func StartServer(s *server.MCPServer) {
-	// Start the server
+// StartServer serves the client on stdin/stdout until stdin is closed or ctx
+// is done. It stops reading requests then and waits up to drainTimeout for
+// the calls in flight to finish before it cancels them.
+func StartServer(ctx context.Context, s *server.MCPServer, drainTimeout time.Duration) error {
 	log.Println("listener on stdin/stdout")
-	if err := server.ServeStdio(s); err != nil {
-		log.Fatalf("Server error: %v\n", err)
+	stdin := newStoppableReader(os.Stdin)
+	listenCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- server.NewStdioServer(s).Listen(listenCtx, stdin, os.Stdout)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-stdin.eof:
+		log.Println("stdin closed, shutting down")
+	case <-ctx.Done():
+		log.Println("shutting down")
+		stdin.stop()
+	}
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(drainTimeout):
+	}
+	log.Printf("calls still running after %s, cancelling them", drainTimeout)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
 	}
+	return ErrCallsAborted
+}
+
+// stoppableReader reads stdin and ends with io.EOF once stopped, so the
+// server stops taking requests while it finishes those it has.
+type stoppableReader struct {
+	lines   chan []byte
+	pending []byte
+	eof     chan struct{} // closed when the input ended
+	stopped chan struct{}
+	err     error
+}
+
+func newStoppableReader(input io.Reader) *stoppableReader {
+	r := &stoppableReader{lines: make(chan []byte), eof: make(chan struct{}), stopped: make(chan struct{})}
+	go func() {
+		defer close(r.eof)
+		buffer := make([]byte, 64*1024)
+		for {
+			n, err := input.Read(buffer)
+			if n > 0 {
+				data := append([]byte(nil), buffer[:n]...)
+				select {
+				case r.lines <- data:
+				case <-r.stopped:
+					return
+				}
+			}
+			if err != nil {
+				r.err = err
+				return
+			}
+		}
+	}()
+	return r
+}
+
+func (r *stoppableReader) Read(p []byte) (int, error) {
+	if len(r.pending) == 0 {
+		select {
+		case data := <-r.lines:
+			r.pending = data
+		case <-r.eof:
+			if r.err != nil && r.err != io.EOF {
+				return 0, r.err
+			}
+			return 0, io.EOF
+		case <-r.stopped:
+			return 0, io.EOF
+		}
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+func (r *stoppableReader) stop() {
+	close(r.stopped)
 }
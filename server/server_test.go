@@ -0,0 +1,46 @@
+package server
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestStoppableReaderPassesInputThrough(t *testing.T) {
+	input, writer := io.Pipe()
+	reader := newStoppableReader(input)
+	go func() {
+		writer.Write([]byte("first\n"))
+		writer.Close()
+	}()
+
+	data, err := io.ReadAll(reader)
+	if err != nil || string(data) != "first\n" {
+		t.Fatalf("Expected the input until EOF, got %q, %v", data, err)
+	}
+	select {
+	case <-reader.eof:
+	case <-time.After(time.Second):
+		t.Error("Expected eof to be closed at the end of the input")
+	}
+}
+
+func TestStoppableReaderEndsWhenStopped(t *testing.T) {
+	input, _ := io.Pipe() // never written to, like an idle stdin
+	reader := newStoppableReader(input)
+
+	read := make(chan error, 1)
+	go func() {
+		_, err := reader.Read(make([]byte, 10))
+		read <- err
+	}()
+	reader.stop()
+	select {
+	case err := <-read:
+		if err != io.EOF {
+			t.Errorf("Expected io.EOF after stop, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the read to end when the reader is stopped")
+	}
+}
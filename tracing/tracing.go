@@ -0,0 +1,237 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Config configures where spans are exported to.
+type Config struct {
+	Enabled     bool    `mapstructure:"enabled"`
+	Endpoint    string  `mapstructure:"endpoint"` // OTLP/HTTP collector, for example localhost:4318
+	Insecure    bool    `mapstructure:"insecure"` // use http instead of https
+	File        string  `mapstructure:"file"`     // write spans as JSON to this file instead
+	ServiceName string  `mapstructure:"service_name"`
+	SampleRatio float64 `mapstructure:"sample_ratio"` // 0 samples every trace
+}
+
+var tracer = otel.Tracer("github.com/ebamberg/mcp-gate")
+
+// propagator reads and writes W3C trace context, both as HTTP headers and in
+// the _meta of MCP requests.
+var propagator = propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+
+// Setup installs the tracer provider for the configuration and returns the
+// function that flushes and stops it, and closes the span file.
+func Setup(config Config) (func(context.Context) error, error) {
+	var exporter sdktrace.SpanExporter
+	var file *os.File
+	var err error
+	if config.File != "" {
+		// spans can carry arguments of tool calls, only the user may read them
+		file, err = os.OpenFile(config.File, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, err
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+		}
+	} else {
+		options := []otlptracehttp.Option{}
+		if config.Endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpoint(config.Endpoint))
+		}
+		if config.Insecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		exporter, err = otlptracehttp.New(context.Background(), options...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to create span exporter: %w", err)
+	}
+
+	if config.ServiceName == "" {
+		config.ServiceName = "mcp-gate"
+	}
+	sampler := sdktrace.AlwaysSample()
+	if config.SampleRatio > 0 {
+		sampler = sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.SampleRatio))
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sampler),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(config.ServiceName))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagator)
+	return func(ctx context.Context) error {
+		// the exporter writes its last spans to the file while shutting down
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		return err
+	}, nil
+}
+
+// Start starts a span of the gateway.
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// StartUpstream starts the span of a request sent to an upstream.
+func StartUpstream(ctx context.Context, name string, upstream string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attribute.String("mcp.upstream", upstream)))
+}
+
+// End records the error, if any, and ends the span.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// metaCarrier lets the propagator read and write the _meta of a request.
+type metaCarrier map[string]any
+
+func (c metaCarrier) Get(key string) string {
+	if value, ok := c[key].(string); ok {
+		return value
+	}
+	return ""
+}
+
+func (c metaCarrier) Set(key string, value string) {
+	c[key] = value
+}
+
+func (c metaCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// InjectMeta adds the trace context of ctx to the _meta fields of a request
+// sent upstream.
+func InjectMeta(ctx context.Context, fields map[string]any) {
+	propagator.Inject(ctx, metaCarrier(fields))
+}
+
+// Headers returns the trace context of ctx as HTTP headers.
+func Headers(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	propagator.Inject(ctx, carrier)
+	return carrier
+}
+
+func extractMeta(ctx context.Context, meta *mcp.Meta) context.Context {
+	if meta == nil || meta.AdditionalFields == nil {
+		return ctx
+	}
+	return propagator.Extract(ctx, metaCarrier(meta.AdditionalFields))
+}
+
+func startServer(ctx context.Context, name string, meta *mcp.Meta, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	ctx = extractMeta(ctx, meta)
+	return tracer.Start(ctx, name, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(attributes...))
+}
+
+// ToolMiddleware starts a span for every tool call, continuing the trace of
+// the client if it sent one in _meta.
+func ToolMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		ctx, span := startServer(ctx, string(mcp.MethodToolsCall)+" "+request.Params.Name, request.Params.Meta,
+			attribute.String("mcp.method", string(mcp.MethodToolsCall)), attribute.String("mcp.tool", request.Params.Name))
+		result, err := next(ctx, request)
+		if err == nil && result != nil && result.IsError {
+			span.SetStatus(codes.Error, "tool returned an error")
+		}
+		End(span, err)
+		return result, err
+	}
+}
+
+// ResourceMiddleware starts a span for every resource read.
+func ResourceMiddleware(next server.ResourceHandlerFunc) server.ResourceHandlerFunc {
+	return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		ctx, span := startServer(ctx, string(mcp.MethodResourcesRead), nil,
+			attribute.String("mcp.method", string(mcp.MethodResourcesRead)), attribute.String("mcp.resource", request.Params.URI))
+		contents, err := next(ctx, request)
+		End(span, err)
+		return contents, err
+	}
+}
+
+// StartPrompt starts the span of a prompt request, the server has no
+// middleware for prompts.
+func StartPrompt(ctx context.Context, request mcp.GetPromptRequest) (context.Context, trace.Span) {
+	return startServer(ctx, string(mcp.MethodPromptsGet)+" "+request.Params.Name, nil,
+		attribute.String("mcp.method", string(mcp.MethodPromptsGet)), attribute.String("mcp.prompt", request.Params.Name))
+}
+
+// requestKey identifies an inbound request between the hooks.
+type requestKey struct {
+	session string
+	id      string
+}
+
+var requestSpans sync.Map // requestKey -> trace.Span
+
+// AddHooks records a span for the requests that are not covered by the
+// middlewares, like initialize and the list methods.
+func AddHooks(hooks *server.Hooks) {
+	hooks.AddBeforeAny(func(ctx context.Context, id any, method mcp.MCPMethod, message any) {
+		if traced(method) {
+			return
+		}
+		_, span := tracer.Start(ctx, string(method), trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(attribute.String("mcp.method", string(method))))
+		requestSpans.Store(keyOf(ctx, id), span)
+	})
+	hooks.AddOnSuccess(func(ctx context.Context, id any, method mcp.MCPMethod, message any, result any) {
+		endRequest(ctx, id, nil)
+	})
+	hooks.AddOnError(func(ctx context.Context, id any, method mcp.MCPMethod, message any, err error) {
+		endRequest(ctx, id, err)
+	})
+}
+
+func traced(method mcp.MCPMethod) bool {
+	return method == mcp.MethodToolsCall || method == mcp.MethodResourcesRead || method == mcp.MethodPromptsGet
+}
+
+func keyOf(ctx context.Context, id any) requestKey {
+	key := requestKey{id: fmt.Sprint(id)}
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		key.session = session.SessionID()
+	}
+	return key
+}
+
+func endRequest(ctx context.Context, id any, err error) {
+	if span, ok := requestSpans.LoadAndDelete(keyOf(ctx, id)); ok {
+		End(span.(trace.Span), err)
+	}
+}
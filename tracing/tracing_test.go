@@ -0,0 +1,70 @@
+package tracing
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestMetaPropagation(t *testing.T) {
+	provider := sdktrace.NewTracerProvider()
+	defer provider.Shutdown(context.Background())
+
+	ctx, span := provider.Tracer("test").Start(context.Background(), "client")
+	defer span.End()
+
+	fields := map[string]any{"other": 1}
+	InjectMeta(ctx, fields)
+	if _, ok := fields["traceparent"].(string); !ok {
+		t.Fatalf("Expected a traceparent in _meta, got %v", fields)
+	}
+
+	extracted := trace.SpanContextFromContext(extractMeta(context.Background(), &mcp.Meta{AdditionalFields: fields}))
+	if extracted.TraceID() != span.SpanContext().TraceID() {
+		t.Errorf("Expected trace %s, got %s", span.SpanContext().TraceID(), extracted.TraceID())
+	}
+	if !extracted.IsRemote() {
+		t.Error("Expected the extracted span context to be remote")
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	if headers := Headers(context.Background()); len(headers) != 0 {
+		t.Errorf("Expected no headers without a span, got %v", headers)
+	}
+
+	provider := sdktrace.NewTracerProvider()
+	defer provider.Shutdown(context.Background())
+	ctx, span := provider.Tracer("test").Start(context.Background(), "call")
+	defer span.End()
+	if headers := Headers(ctx); headers["traceparent"] == "" {
+		t.Errorf("Expected a traceparent header, got %v", headers)
+	}
+}
+
+func TestSpanFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "spans.json")
+	shutdown, err := Setup(Config{File: file})
+	if err != nil {
+		t.Fatalf("Failed to set up tracing: %v", err)
+	}
+	_, span := Start(context.Background(), "call")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("Failed to shut down tracing: %v", err)
+	}
+
+	info, err := os.Stat(file)
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("Expected a private span file, got %v, %v", info, err)
+	}
+	if data, _ := os.ReadFile(file); !strings.Contains(string(data), `"Name":"call"`) {
+		t.Errorf("Expected the span to be flushed to the file, got %s", data)
+	}
+}